@@ -0,0 +1,342 @@
+package flute
+
+import (
+	"crypto/hmac"
+	"crypto/sha256"
+	"crypto/subtle"
+	"encoding/base64"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"hash"
+	"net/http"
+	"strings"
+)
+
+type (
+	// Auth is the credential which the request must have such as Basic auth and Bearer token.
+	// Auth is created by BasicAuth, BearerToken, APIKeyHeader, APIKeyQuery, HMACSignature, and SigV4Signature.
+	// The failure message says which part of the credential is wrong, and secrets are masked in it.
+	Auth interface {
+		// String returns the description of the credential such as `Basic auth of the user "foo"`.
+		// The description doesn't include the secret.
+		String() string
+		// verify returns the part of the credential which the request doesn't meet.
+		// If the request has the credential, verify returns nil.
+		verify(req *http.Request) (*authFailure, error)
+	}
+
+	// HMAC is the condition of the HMAC request signature.
+	HMAC struct {
+		// Secret is the shared secret key.
+		Secret string
+		// Hash is the hash function such as sha1.New. The default is sha256.New.
+		Hash func() hash.Hash
+		// Header is the name of the request header which has the signature such as "X-Hub-Signature-256".
+		Header string
+		// Prefix is the prefix of the header value before the signature such as "sha256=".
+		Prefix string
+		// Encoding is the encoding of the signature, "hex" or "base64". The default is "hex".
+		Encoding string
+		// CanonicalString returns the string to be signed.
+		// The default is the request body.
+		// The body is signed as it was sent, so the body compressed with Content-Encoding is signed before it is decoded.
+		// req.Body given to CanonicalString is also the body as it was sent,
+		// and req.URL is the URL which the client sent, including the base path of the Service's endpoint.
+		CanonicalString func(req *http.Request) (string, error)
+	}
+
+	authFunc struct {
+		check       func(req *http.Request) (*authFailure, error)
+		description string
+	}
+
+	// authFailure is the part of the credential which the request doesn't meet.
+	authFailure struct {
+		// subject is the part of the credential such as "Basic auth password".
+		subject  string
+		expected string
+		actual   string
+		// detail is the additional information to find the cause such as the canonical string.
+		detail string
+	}
+)
+
+func (a authFunc) String() string {
+	return a.description
+}
+
+func (a authFunc) verify(req *http.Request) (*authFailure, error) {
+	return a.check(req)
+}
+
+func (f authFailure) String() string {
+	msg := fmt.Sprintf("the request %s should be %s\nactual: %s", f.subject, f.expected, f.actual)
+	if f.detail != "" {
+		msg += "\n" + f.detail
+	}
+	return msg
+}
+
+// maskSecret returns the secret whose characters are replaced with "*".
+// The first and last two characters are kept only if the secret is long enough,
+// so the failure message can tell which secret is used without printing it.
+func maskSecret(s string) string {
+	const minPartiallyShownLength = 12
+	if s == "" {
+		return `""`
+	}
+	if len(s) < minPartiallyShownLength {
+		return strings.Repeat("*", len(s))
+	}
+	return s[:2] + strings.Repeat("*", len(s)-4) + s[len(s)-2:]
+}
+
+// equalSecret compares the secrets in constant time.
+func equalSecret(expected, actual string) bool {
+	return subtle.ConstantTimeCompare([]byte(expected), []byte(actual)) == 1
+}
+
+// authorization returns the credentials of the Authorization header with the scheme.
+// The scheme is case-insensitive.
+func authorization(req *http.Request, scheme string) (string, *authFailure) {
+	v := req.Header.Get("Authorization")
+	if v == "" {
+		return "", &authFailure{
+			subject:  "Authorization header",
+			expected: scheme + " credentials",
+			actual:   "missing",
+		}
+	}
+	actualScheme, credentials, found := strings.Cut(v, " ")
+	if !strings.EqualFold(actualScheme, scheme) {
+		// the value without the scheme may be the credentials themselves, unless it is a known scheme
+		actual := maskSecret(v)
+		if found || isAuthScheme(v) {
+			actual = fmt.Sprintf("%q", actualScheme)
+		}
+		return "", &authFailure{
+			subject:  "Authorization scheme",
+			expected: fmt.Sprintf("%q", scheme),
+			actual:   actual,
+		}
+	}
+	credentials = strings.TrimSpace(credentials)
+	if credentials == "" {
+		// the scheme itself isn't a secret, so it is shown as it is
+		return "", &authFailure{
+			subject:  "Authorization credentials",
+			expected: scheme + " credentials",
+			actual:   fmt.Sprintf("%q without credentials", actualScheme),
+		}
+	}
+	return credentials, nil
+}
+
+// isAuthScheme returns whether s is an authentication scheme which flute verifies.
+func isAuthScheme(s string) bool {
+	for _, scheme := range []string{"Basic", "Bearer", sigV4Algorithm} {
+		if strings.EqualFold(s, scheme) {
+			return true
+		}
+	}
+	return false
+}
+
+// BasicAuth returns the Auth which requires the Basic authentication with the username and password.
+func BasicAuth(username, password string) Auth {
+	return authFunc{
+		check: func(req *http.Request) (*authFailure, error) {
+			credentials, f := authorization(req, "Basic")
+			if f != nil {
+				return f, nil
+			}
+			b, err := base64.StdEncoding.DecodeString(credentials)
+			if err != nil {
+				return &authFailure{
+					subject:  "Basic auth credentials",
+					expected: "base64 encoded username:password",
+					actual:   fmt.Sprintf("invalid base64: %v", err),
+				}, nil
+			}
+			user, pass, ok := strings.Cut(string(b), ":")
+			if !ok {
+				return &authFailure{
+					subject:  "Basic auth credentials",
+					expected: "username:password",
+					actual:   "no colon",
+				}, nil
+			}
+			if user != username {
+				return &authFailure{
+					subject:  "Basic auth username",
+					expected: fmt.Sprintf("%q", username),
+					actual:   fmt.Sprintf("%q", user),
+				}, nil
+			}
+			if !equalSecret(password, pass) {
+				return &authFailure{
+					subject:  "Basic auth password",
+					expected: maskSecret(password),
+					actual:   maskSecret(pass),
+				}, nil
+			}
+			return nil, nil
+		},
+		description: fmt.Sprintf("Basic auth of the user %q", username),
+	}
+}
+
+// BearerToken returns the Auth which requires the Authorization header "Bearer <token>".
+func BearerToken(token string) Auth {
+	return authFunc{
+		check: func(req *http.Request) (*authFailure, error) {
+			actual, f := authorization(req, "Bearer")
+			if f != nil {
+				return f, nil
+			}
+			if !equalSecret(token, actual) {
+				return &authFailure{
+					subject:  "Bearer token",
+					expected: maskSecret(token),
+					actual:   maskSecret(actual),
+				}, nil
+			}
+			return nil, nil
+		},
+		description: fmt.Sprintf("Bearer token %s", maskSecret(token)),
+	}
+}
+
+// APIKeyHeader returns the Auth which requires the API key in the request header.
+func APIKeyHeader(name, key string) Auth {
+	return authFunc{
+		check: func(req *http.Request) (*authFailure, error) {
+			values, ok := req.Header[http.CanonicalHeaderKey(name)]
+			return verifyAPIKey(fmt.Sprintf("API key header %q", name), key, values, ok), nil
+		},
+		description: fmt.Sprintf("API key %s in the header %q", maskSecret(key), name),
+	}
+}
+
+// APIKeyQuery returns the Auth which requires the API key in the query parameter.
+func APIKeyQuery(name, key string) Auth {
+	return authFunc{
+		check: func(req *http.Request) (*authFailure, error) {
+			values, ok := req.URL.Query()[name]
+			return verifyAPIKey(fmt.Sprintf("API key query %q", name), key, values, ok), nil
+		},
+		description: fmt.Sprintf("API key %s in the query %q", maskSecret(key), name),
+	}
+}
+
+func verifyAPIKey(subject, key string, values []string, ok bool) *authFailure {
+	if !ok {
+		return &authFailure{
+			subject:  subject,
+			expected: maskSecret(key),
+			actual:   "missing",
+		}
+	}
+	if len(values) != 1 || !equalSecret(key, values[0]) {
+		masked := make([]string, len(values))
+		for i, v := range values {
+			masked[i] = maskSecret(v)
+		}
+		return &authFailure{
+			subject:  subject,
+			expected: maskSecret(key),
+			actual:   strings.Join(masked, ", "),
+		}
+	}
+	return nil
+}
+
+// HMACSignature returns the Auth which requires the HMAC signature of the request signed with the shared secret.
+// If h.Header is empty or h.Encoding is unknown, the check fails with the error,
+// which is reported with T by the tester.
+func HMACSignature(h HMAC) Auth {
+	if h.Hash == nil {
+		h.Hash = sha256.New
+	}
+	var encode func([]byte) string
+	var decode func(string) ([]byte, error)
+	var configErr error
+	switch h.Encoding {
+	case "", "hex":
+		encode = hex.EncodeToString
+		decode = hex.DecodeString
+	case "base64":
+		encode = base64.StdEncoding.EncodeToString
+		decode = base64.StdEncoding.DecodeString
+	default:
+		configErr = fmt.Errorf("HMAC.Encoding must be hex or base64: %q", h.Encoding)
+	}
+	if h.Header == "" {
+		configErr = errors.New("HMAC.Header is required")
+	}
+	return authFunc{
+		check: func(req *http.Request) (*authFailure, error) {
+			if configErr != nil {
+				return nil, configErr
+			}
+			subject := fmt.Sprintf("HMAC signature header %q", h.Header)
+			v := req.Header.Get(h.Header)
+			if v == "" {
+				return &authFailure{
+					subject:  subject,
+					expected: "the signature",
+					actual:   "missing",
+				}, nil
+			}
+			s, err := h.canonicalString(req)
+			if err != nil {
+				return nil, err
+			}
+			mac := hmac.New(h.Hash, []byte(h.Secret))
+			mac.Write([]byte(s))
+			expected := mac.Sum(nil)
+			actual, err := decode(strings.TrimPrefix(v, h.Prefix))
+			if !strings.HasPrefix(v, h.Prefix) || err != nil || !hmac.Equal(expected, actual) {
+				return &authFailure{
+					subject:  subject,
+					expected: fmt.Sprintf("%q", h.Prefix+encode(expected)),
+					actual:   fmt.Sprintf("%q", v),
+					detail:   fmt.Sprintf("canonical string: %q", s),
+				}, nil
+			}
+			return nil, nil
+		},
+		description: fmt.Sprintf("HMAC signature in the header %q", h.Header),
+	}
+}
+
+// canonicalString returns the string to be signed.
+// Both the default and CanonicalString get the body as it was sent,
+// and CanonicalString gets the URL which the client sent.
+func (h HMAC) canonicalString(req *http.Request) (string, error) {
+	b, err := rawBody(req)
+	if err != nil {
+		return "", fmt.Errorf("failed to read the request body: %w", err)
+	}
+	if h.CanonicalString == nil {
+		return string(b), nil
+	}
+	// the shallow copy is given so that the body and URL of req aren't replaced
+	r := *req
+	r.URL = originalURL(req)
+	setBody(&r, b)
+	s, err := h.CanonicalString(&r)
+	if err != nil {
+		return "", fmt.Errorf("failed to get the canonical string of the HMAC signature: %w", err)
+	}
+	return s, nil
+}
+
+// findAuthFailure returns the part of the credential which the request doesn't meet.
+func findAuthFailure(req *http.Request, auth Auth) (*authFailure, error) {
+	if auth == nil {
+		return nil, nil
+	}
+	return auth.verify(req)
+}
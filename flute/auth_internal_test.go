@@ -0,0 +1,275 @@
+package flute
+
+import (
+	"crypto/hmac"
+	"crypto/sha1" //nolint:gosec
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/hex"
+	"io"
+	"net/http"
+	"net/url"
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/require"
+)
+
+func Test_maskSecret(t *testing.T) {
+	data := []struct {
+		secret string
+		exp    string
+	}{
+		{secret: "", exp: `""`},
+		{secret: "pass", exp: "****"},
+		{secret: "0123456789ab", exp: "01********ab"},
+	}
+	for _, d := range data {
+		d := d
+		t.Run(d.secret, func(t *testing.T) {
+			require.Equal(t, d.exp, maskSecret(d.secret))
+		})
+	}
+}
+
+func sign(secret, s string) string {
+	mac := hmac.New(sha256.New, []byte(secret))
+	mac.Write([]byte(s))
+	return hex.EncodeToString(mac.Sum(nil))
+}
+
+func Test_findAuthFailure(t *testing.T) { //nolint:funlen,maintidx
+	body := `{"action": "opened"}`
+	sha1Mac := hmac.New(sha1.New, []byte("webhook-secret"))
+	sha1Mac.Write([]byte("POST\n/hooks\n" + body))
+	data := []struct {
+		title   string
+		header  http.Header
+		query   url.Values
+		auth    Auth
+		subject string
+		hidden  string
+		shown   string
+	}{
+		{
+			title:  "basic auth",
+			header: http.Header{"Authorization": []string{"Basic " + base64.StdEncoding.EncodeToString([]byte("foo:p@ss:word"))}},
+			auth:   BasicAuth("foo", "p@ss:word"),
+		},
+		{
+			title:   "basic auth username",
+			header:  http.Header{"Authorization": []string{"Basic " + base64.StdEncoding.EncodeToString([]byte("bar:p@ss:word"))}},
+			auth:    BasicAuth("foo", "p@ss:word"),
+			subject: "Basic auth username",
+		},
+		{
+			title:   "basic auth password",
+			header:  http.Header{"Authorization": []string{"Basic " + base64.StdEncoding.EncodeToString([]byte("foo:wrong"))}},
+			auth:    BasicAuth("foo", "p@ss:word"),
+			subject: "Basic auth password",
+			hidden:  "wrong",
+		},
+		{
+			title:   "basic auth isn't base64",
+			header:  http.Header{"Authorization": []string{"Basic foo:bar"}},
+			auth:    BasicAuth("foo", "bar"),
+			subject: "Basic auth credentials",
+		},
+		{
+			title:   "authorization header is missing",
+			auth:    BasicAuth("foo", "bar"),
+			subject: "Authorization header",
+		},
+		{
+			title:  "bearer token",
+			header: http.Header{"Authorization": []string{"bearer secret-token-xyz"}},
+			auth:   BearerToken("secret-token-xyz"),
+		},
+		{
+			title:   "bearer token is wrong",
+			header:  http.Header{"Authorization": []string{"Bearer other-token-abc"}},
+			auth:    BearerToken("secret-token-xyz"),
+			subject: "Bearer token",
+			hidden:  "other-token-abc",
+		},
+		{
+			title:   "scheme is wrong",
+			header:  http.Header{"Authorization": []string{"Token secret-token-xyz"}},
+			auth:    BearerToken("secret-token-xyz"),
+			subject: "Authorization scheme",
+			hidden:  "secret-token-xyz",
+		},
+		{
+			title:   "no scheme",
+			header:  http.Header{"Authorization": []string{"secret-token-xyz"}},
+			auth:    BearerToken("secret-token-xyz"),
+			subject: "Authorization scheme",
+			hidden:  "secret-token-xyz",
+		},
+		{
+			title:   "scheme without credentials",
+			header:  http.Header{"Authorization": []string{"Basic"}},
+			auth:    BasicAuth("foo", "bar"),
+			subject: "Authorization credentials",
+			shown:   `"Basic" without credentials`,
+		},
+		{
+			title:   "lone scheme is different",
+			header:  http.Header{"Authorization": []string{"Basic"}},
+			auth:    BearerToken("secret-token-xyz"),
+			subject: "Authorization scheme",
+			shown:   `actual: "Basic"`,
+		},
+		{
+			title:  "api key header",
+			header: http.Header{"X-Api-Key": []string{"key-123"}},
+			auth:   APIKeyHeader("x-api-key", "key-123"),
+		},
+		{
+			title:   "api key header is wrong",
+			header:  http.Header{"X-Api-Key": []string{"key-456"}},
+			auth:    APIKeyHeader("X-API-Key", "key-123"),
+			subject: `API key header "X-API-Key"`,
+			hidden:  "key-456",
+		},
+		{
+			title: "api key query",
+			query: url.Values{"api_key": []string{"key-123"}},
+			auth:  APIKeyQuery("api_key", "key-123"),
+		},
+		{
+			title:   "api key query is missing",
+			auth:    APIKeyQuery("api_key", "key-123"),
+			subject: `API key query "api_key"`,
+		},
+		{
+			title:  "hmac of the body",
+			header: http.Header{"X-Hub-Signature-256": []string{"sha256=" + sign("webhook-secret", body)}},
+			auth: HMACSignature(HMAC{
+				Secret: "webhook-secret",
+				Header: "X-Hub-Signature-256",
+				Prefix: "sha256=",
+			}),
+		},
+		{
+			title:  "hmac of the canonical string",
+			header: http.Header{"X-Signature": []string{base64.StdEncoding.EncodeToString(sha1Mac.Sum(nil))}},
+			auth: HMACSignature(HMAC{
+				Secret:   "webhook-secret",
+				Hash:     sha1.New,
+				Header:   "X-Signature",
+				Encoding: "base64",
+				CanonicalString: func(req *http.Request) (string, error) {
+					b, err := io.ReadAll(req.Body)
+					if err != nil {
+						return "", err
+					}
+					return req.Method + "\n" + req.URL.Path + "\n" + string(b), nil
+				},
+			}),
+		},
+		{
+			title:  "hmac is signed with another secret",
+			header: http.Header{"X-Hub-Signature-256": []string{"sha256=" + sign("other-secret", body)}},
+			auth: HMACSignature(HMAC{
+				Secret: "webhook-secret",
+				Header: "X-Hub-Signature-256",
+				Prefix: "sha256=",
+			}),
+			subject: `HMAC signature header "X-Hub-Signature-256"`,
+			hidden:  "webhook-secret",
+		},
+		{
+			title: "hmac is missing",
+			auth: HMACSignature(HMAC{
+				Secret: "webhook-secret",
+				Header: "X-Hub-Signature-256",
+			}),
+			subject: `HMAC signature header "X-Hub-Signature-256"`,
+		},
+	}
+	for _, d := range data {
+		d := d
+		t.Run(d.title, func(t *testing.T) {
+			req := &http.Request{
+				Method: http.MethodPost,
+				URL:    &url.URL{Path: "/hooks", RawQuery: d.query.Encode()},
+				Header: d.header,
+				Body:   io.NopCloser(strings.NewReader(body)),
+			}
+			if req.Header == nil {
+				req.Header = http.Header{}
+			}
+			f, err := findAuthFailure(req, d.auth)
+			require.NoError(t, err)
+			if d.subject == "" {
+				require.Nil(t, f)
+				return
+			}
+			require.NotNil(t, f)
+			require.Equal(t, d.subject, f.subject)
+			if d.hidden != "" {
+				require.NotContains(t, f.String(), d.hidden)
+			}
+			if d.shown != "" {
+				require.Contains(t, f.String(), d.shown)
+			}
+		})
+	}
+}
+
+func Test_testAuth(t *testing.T) {
+	tb := newFakeTB(t)
+	req := &http.Request{Header: http.Header{}}
+	req.SetBasicAuth("foo", "wrong-password")
+	testAuth(tb, req, Service{Endpoint: "http://example.com"}, Route{
+		Name: "get the profile",
+		Tester: Tester{
+			Auth: BasicAuth("foo", "correct-password"),
+		},
+	})
+	errs := tb.Errors()
+	require.Len(t, errs, 1)
+	require.Contains(t, errs[0], "the request Basic auth password should be co************rd")
+	require.Contains(t, errs[0], "actual: wr**********rd")
+	require.NotContains(t, errs[0], "correct-password")
+}
+
+func Test_HMACSignature_invalidConfig(t *testing.T) {
+	data := []struct {
+		title string
+		hmac  HMAC
+		exp   string
+	}{
+		{
+			title: "header is empty",
+			hmac:  HMAC{Secret: "webhook-secret"},
+			exp:   "HMAC.Header is required",
+		},
+		{
+			title: "unknown encoding",
+			hmac:  HMAC{Secret: "webhook-secret", Header: "X-Signature", Encoding: "base32"},
+			exp:   `HMAC.Encoding must be hex or base64: "base32"`,
+		},
+	}
+	for _, d := range data {
+		d := d
+		t.Run(d.title, func(t *testing.T) {
+			auth := HMACSignature(d.hmac)
+			req := &http.Request{
+				Header: http.Header{"X-Signature": []string{"xxx"}},
+				Body:   io.NopCloser(strings.NewReader("{}")),
+			}
+			_, err := findAuthFailure(req, auth)
+			require.EqualError(t, err, d.exp)
+			tb := newFakeTB(t)
+			testAuth(tb, req, Service{Endpoint: "http://example.com"}, Route{
+				Name:   "receive the webhook",
+				Tester: Tester{Auth: auth},
+			})
+			errs := tb.Errors()
+			require.Len(t, errs, 1)
+			require.Contains(t, errs[0], d.exp)
+		})
+	}
+}
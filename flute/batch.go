@@ -0,0 +1,271 @@
+package flute
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"strconv"
+	"strings"
+
+	"github.com/stretchr/testify/assert"
+)
+
+type (
+	// batchProtocol is the protocol which sends the operations in a JSON array such as GraphQL and JSON-RPC.
+	batchProtocol struct {
+		// isRoute returns whether the route handles the operations of the protocol.
+		isRoute func(route Route) bool
+		// unmatched returns the result of the operation which no route matches.
+		// If unmatched returns nil, the operation is omitted from the batch response.
+		unmatched func(op json.RawMessage) json.RawMessage
+	}
+
+	// batchOperation is an operation of the batch request and the route which matches it.
+	batchOperation struct {
+		// req is the request whose body is the operation.
+		req  *http.Request
+		body json.RawMessage
+		// service, route, and routeReq are the result of findRoute.
+		// If no route matches the operation, they are nil.
+		service  *Service
+		route    *Route
+		routeReq *http.Request
+	}
+)
+
+// batchProtocols are the protocols whose batch request is split into the operations.
+var batchProtocols = [...]batchProtocol{ //nolint:gochecknoglobals
+	{
+		isRoute:   isGraphQLRoute,
+		unmatched: unmatchedGraphQLOperation,
+	},
+	{
+		isRoute:   isJSONRPCRoute,
+		unmatched: unmatchedJSONRPCCall,
+	},
+}
+
+// splitBatch returns the operations of the batch request and the protocol of the batch.
+// body is the request body decoded according to Content-Encoding.
+// The request is a batch if the body is a JSON array and the endpoint, path, and method of the request
+// match a route of the batched protocol such as GraphQL and JSON-RPC.
+func (transport Transport) splitBatch(req *http.Request, body []byte) ([]json.RawMessage, batchProtocol, bool) {
+	ops, ok := batchOperations(req, body)
+	if !ok {
+		return nil, batchProtocol{}, false
+	}
+	for _, protocol := range batchProtocols {
+		if transport.hasBatchRoute(req, protocol.isRoute) {
+			return ops, protocol, true
+		}
+	}
+	return nil, batchProtocol{}, false
+}
+
+// hasBatchRoute returns whether the request would be routed to a route of the batched protocol.
+// hasBatchRoute is also used to check whether a single call which no route matches is sent to a protocol route.
+// Only the endpoint, path, and method are compared because other conditions are checked for each operation.
+func (transport Transport) hasBatchRoute(req *http.Request, isRoute func(route Route) bool) bool {
+	for _, service := range transport.Services {
+		ep, f, _ := matchService(req, service)
+		if !f {
+			continue
+		}
+		routeReq := ep.relativeRequest(req)
+		for _, route := range service.Routes {
+			if !isRoute(route) {
+				continue
+			}
+			if f, err := matchPath(routeReq, route.Matcher); err != nil || !f {
+				continue
+			}
+			if f, _ := matchMethod(routeReq, route.Matcher); f {
+				return true
+			}
+		}
+	}
+	return false
+}
+
+// batchOperations returns the elements of the JSON array body.
+// If the request isn't POST or the body isn't a non-empty JSON array, batchOperations returns false.
+func batchOperations(req *http.Request, body []byte) ([]json.RawMessage, bool) {
+	if req.Method != http.MethodPost {
+		return nil, false
+	}
+	if !strings.HasPrefix(strings.TrimSpace(string(body)), "[") {
+		return nil, false
+	}
+	var ops []json.RawMessage
+	if err := json.Unmarshal(body, &ops); err != nil || len(ops) == 0 {
+		return nil, false
+	}
+	return ops, true
+}
+
+// operationRequest returns the shallow copy of the batch request whose body is the operation.
+// The operation is sent without Content-Encoding because it is decoded.
+func operationRequest(req *http.Request, op json.RawMessage) *http.Request {
+	sub := req.WithContext(req.Context())
+	sub.Header = req.Header.Clone()
+	if sub.Header != nil {
+		sub.Header.Del("Content-Encoding")
+		sub.Header.Set("Content-Length", strconv.Itoa(len(op)))
+	}
+	sub.ContentLength = int64(len(op))
+	setBody(sub, op)
+	return sub
+}
+
+// roundTripBatch routes each operation of the batch request separately,
+// and combines the responses into a response whose body is a JSON array in the order of the operations.
+// body is the request body as it was sent.
+// The batch request is recorded in Journal as a request with the route of each operation.
+func (transport Transport) roundTripBatch(
+	req *http.Request, body []byte, ops []json.RawMessage, protocol batchProtocol,
+) (*http.Response, error) {
+	var entry *Entry
+	if transport.Journal != nil {
+		entry = transport.Journal.newEntry(req, body)
+	}
+	operations := make([]batchOperation, len(ops))
+	matched := false
+	for i, op := range ops {
+		sub := operationRequest(req, op)
+		service, route, routeReq := transport.findRoute(sub, op)
+		operations[i] = batchOperation{
+			req:      sub,
+			body:     op,
+			service:  service,
+			route:    route,
+			routeReq: routeReq,
+		}
+		matched = matched || route != nil
+	}
+	var resp *http.Response
+	var err error
+	if !matched && transport.Transport != nil {
+		// no operation is mocked, so the batch request is sent as it is
+		setBody(req, body)
+		resp, err = transport.Transport.RoundTrip(req)
+	} else {
+		resp, err = transport.respondBatch(req, operations, protocol)
+	}
+	if entry != nil {
+		entry.recordOperations(operations)
+		entry.Response = resp
+		entry.Err = err
+		transport.Journal.add(*entry)
+	}
+	return resp, err
+}
+
+// respondBatch runs the test of each operation and combines the responses.
+// Responses without the body such as the responses of JSON-RPC notifications are omitted.
+// The headers of the responses including Set-Cookie are merged.
+// If all responses have the same status code, the combined response has it. Otherwise, the status code is 200.
+// If no operation has the result and the status code is 2xx, the status code is 204 No Content.
+func (transport Transport) respondBatch( //nolint:cyclop
+	req *http.Request, operations []batchOperation, protocol batchProtocol,
+) (*http.Response, error) {
+	for _, op := range operations {
+		if op.route != nil {
+			// the operations are sent at once, so the cookies set by the other operations aren't required.
+			// the cookie path is compared to the path which the client sent
+			transport.checkSession(op.req, *op.service, *op.route)
+		}
+	}
+	results := make([]json.RawMessage, 0, len(operations))
+	header := http.Header{}
+	statusCode := 0
+	mixed := false
+	for i, op := range operations {
+		if op.route == nil {
+			if transport.T != nil {
+				assert.Fail(transport.T, makeNoMatchedRouteMsgWithCandidates(transport.T, op.req, transport.Services))
+			}
+			if result := protocol.unmatched(op.body); result != nil {
+				results = append(results, result)
+			}
+			continue
+		}
+		setBody(op.routeReq, op.body)
+		resp, err := transport.respond(op.routeReq, op.service, op.route)
+		if err != nil {
+			return nil, fmt.Errorf("the operation %d of the batch request: %w", i, err)
+		}
+		if resp == nil {
+			return nil, fmt.Errorf("the operation %d of the batch request returned no response", i)
+		}
+		transport.updateSession(*op.service, *op.route, resp)
+		var b []byte
+		if resp.Body != nil {
+			b, err = io.ReadAll(resp.Body)
+			resp.Body.Close()
+			if err != nil {
+				return nil, fmt.Errorf("failed to read the response of the operation %d of the batch request: %w", i, err)
+			}
+		}
+		mergeHeader(header, resp.Header)
+		if statusCode == 0 {
+			statusCode = resp.StatusCode
+		} else if statusCode != resp.StatusCode {
+			mixed = true
+		}
+		if len(bytes.TrimSpace(b)) == 0 {
+			continue
+		}
+		if !json.Valid(b) {
+			return nil, fmt.Errorf("the response of the operation %d of the batch request isn't JSON: %s", i, string(b))
+		}
+		results = append(results, b)
+	}
+	if statusCode == 0 || mixed {
+		statusCode = http.StatusOK
+	}
+	if len(results) == 0 && statusCode/100 == 2 {
+		return &http.Response{
+			Status:     "204 No Content",
+			StatusCode: http.StatusNoContent,
+			Proto:      "HTTP/1.1",
+			ProtoMajor: 1,
+			ProtoMinor: 1,
+			Header:     header,
+			Body:       http.NoBody,
+			Request:    req,
+		}, nil
+	}
+	b, err := json.Marshal(results)
+	if err != nil {
+		return nil, fmt.Errorf("failed to marshal the responses of the batch request: %w", err)
+	}
+	header.Set("Content-Type", "application/json")
+	return &http.Response{
+		Status:        fmt.Sprintf("%d %s", statusCode, http.StatusText(statusCode)),
+		StatusCode:    statusCode,
+		Proto:         "HTTP/1.1",
+		ProtoMajor:    1,
+		ProtoMinor:    1,
+		Header:        header,
+		Body:          io.NopCloser(bytes.NewReader(b)),
+		ContentLength: int64(len(b)),
+		Request:       req,
+	}, nil
+}
+
+// mergeHeader adds the values of src to dst except the values dst already has.
+// Content-Length and Content-Type are skipped because they are set to the combined response.
+func mergeHeader(dst, src http.Header) {
+	for k, values := range src {
+		if k == "Content-Length" || k == "Content-Type" {
+			continue
+		}
+		for _, v := range values {
+			if !containsString(dst[k], v) {
+				dst[k] = append(dst[k], v)
+			}
+		}
+	}
+}
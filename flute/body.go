@@ -0,0 +1,80 @@
+package flute
+
+import (
+	"bytes"
+	"io"
+	"net/http"
+)
+
+// bufferedBody is the request body which RoundTrip has read into memory.
+// bufferedBody keeps the whole body, so the body can be read again without reading the original body.
+type bufferedBody struct {
+	*bytes.Reader
+	body []byte
+}
+
+func newBufferedBody(b []byte) *bufferedBody {
+	return &bufferedBody{
+		Reader: bytes.NewReader(b),
+		body:   b,
+	}
+}
+
+// Close implements io.Closer.
+func (*bufferedBody) Close() error {
+	return nil
+}
+
+// readBody returns the request body without consuming it.
+// If the body isn't buffered yet, readBody reads the body into memory, closes the original body,
+// and replaces req.Body and req.GetBody with the buffered body.
+// If req.Body is nil, readBody returns nil.
+func readBody(req *http.Request) ([]byte, error) {
+	if req.Body == nil {
+		return nil, nil
+	}
+	if body, ok := req.Body.(*bufferedBody); ok {
+		return body.body, nil
+	}
+	b, err := io.ReadAll(req.Body)
+	req.Body.Close()
+	if err != nil {
+		return nil, err
+	}
+	if b == nil {
+		b = []byte{}
+	}
+	setBody(req, b)
+	return b, nil
+}
+
+// setBody sets a fresh reader of b to req.Body and req.GetBody.
+// If b is nil, the request has no body and setBody does nothing.
+func setBody(req *http.Request, b []byte) {
+	if b == nil {
+		return
+	}
+	if len(b) == 0 {
+		req.Body = http.NoBody
+		req.GetBody = func() (io.ReadCloser, error) {
+			return http.NoBody, nil
+		}
+		return
+	}
+	req.Body = newBufferedBody(b)
+	req.GetBody = func() (io.ReadCloser, error) {
+		return newBufferedBody(b), nil
+	}
+}
+
+// rewindBody replaces the buffered request body with a fresh reader,
+// so the next reader can read the body from the beginning.
+// If req is nil, rewindBody does nothing.
+func rewindBody(req *http.Request) {
+	if req == nil {
+		return
+	}
+	if body, ok := req.Body.(*bufferedBody); ok {
+		setBody(req, body.body)
+	}
+}
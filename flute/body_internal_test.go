@@ -0,0 +1,75 @@
+package flute
+
+import (
+	"io"
+	"net/http"
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/require"
+)
+
+func Test_readBody(t *testing.T) {
+	data := []struct {
+		title string
+		req   *http.Request
+		exp   []byte
+	}{
+		{
+			title: "request body is nil",
+			req:   &http.Request{},
+		},
+		{
+			title: "request body is http.NoBody",
+			req: &http.Request{
+				Body: http.NoBody,
+			},
+			exp: []byte{},
+		},
+		{
+			title: "normal",
+			req: &http.Request{
+				Body: io.NopCloser(strings.NewReader("foo")),
+			},
+			exp: []byte("foo"),
+		},
+	}
+
+	for _, d := range data {
+		d := d
+		t.Run(d.title, func(t *testing.T) {
+			for i := 0; i < 2; i++ {
+				b, err := readBody(d.req)
+				require.NoError(t, err)
+				require.Equal(t, d.exp, b)
+			}
+			if d.exp == nil {
+				require.Nil(t, d.req.Body)
+				return
+			}
+			b, err := io.ReadAll(d.req.Body)
+			require.NoError(t, err)
+			require.Equal(t, string(d.exp), string(b))
+			body, err := d.req.GetBody()
+			require.NoError(t, err)
+			b, err = io.ReadAll(body)
+			require.NoError(t, err)
+			require.Equal(t, string(d.exp), string(b))
+		})
+	}
+}
+
+func Test_rewindBody(t *testing.T) {
+	req := &http.Request{}
+	setBody(req, []byte("foo"))
+	b, err := io.ReadAll(req.Body)
+	require.NoError(t, err)
+	require.Equal(t, "foo", string(b))
+	b, err = io.ReadAll(req.Body)
+	require.NoError(t, err)
+	require.Empty(t, b)
+	rewindBody(req)
+	b, err = io.ReadAll(req.Body)
+	require.NoError(t, err)
+	require.Equal(t, "foo", string(b))
+}
@@ -0,0 +1,541 @@
+package flute
+
+import (
+	"encoding/json"
+	"encoding/xml"
+	"fmt"
+	"net/http"
+	"net/url"
+	"sort"
+	"strings"
+)
+
+type (
+	// RequestMatcher is a composable condition of the request.
+	// RequestMatcher is created by the leaf functions such as Method and Path,
+	// and combined with AllOf, AnyOf, and Not.
+	RequestMatcher interface {
+		// MatchRequest returns whether the request meets the condition.
+		MatchRequest(req *http.Request) (bool, error)
+		// String returns the description of the condition such as `method is "GET"`.
+		// The description is embedded in the failure message.
+		String() string
+	}
+
+	// requestExplainer describes why the request doesn't meet the condition.
+	requestExplainer interface {
+		explainRequest(req *http.Request) string
+	}
+
+	// fieldMatcher is the leaf RequestMatcher which checks the condition of Matcher.
+	fieldMatcher struct {
+		matcher     Matcher
+		description string
+	}
+
+	allOf []RequestMatcher
+
+	anyOf []RequestMatcher
+
+	not struct {
+		m RequestMatcher
+	}
+)
+
+func (m fieldMatcher) MatchRequest(req *http.Request) (bool, error) {
+	return isMatch(req, m.matcher)
+}
+
+func (m fieldMatcher) String() string {
+	return m.description
+}
+
+func (m fieldMatcher) explainRequest(req *http.Request) string {
+	for _, cond := range conditions {
+		if cond.isSet(m.matcher) {
+			mm := cond.explain(req, m.matcher)
+			if mm.actual == "" {
+				if mm.expected != "" {
+					// the expected value is invalid and mm.expected is the reason
+					return mm.condition + ": " + mm.expected
+				}
+				// no part of the request is found which doesn't meet the condition
+				return "the request meets " + m.description
+			}
+			return mm.condition + " is " + mm.actual
+		}
+	}
+	return "the function returns false or an error"
+}
+
+// AllOf returns the RequestMatcher which matches the request meeting all conditions.
+// The conditions are checked in order and the rest are skipped once a condition isn't met.
+func AllOf(matchers ...RequestMatcher) RequestMatcher {
+	return allOf(matchers)
+}
+
+func (ms allOf) MatchRequest(req *http.Request) (bool, error) {
+	for _, m := range ms {
+		// each condition reads the body from the beginning
+		rewindBody(req)
+		if f, err := m.MatchRequest(req); err != nil || !f {
+			return f, err
+		}
+	}
+	return true, nil
+}
+
+func (ms allOf) String() string {
+	return joinRequestMatchers(ms, " and ")
+}
+
+func (ms allOf) explainRequest(req *http.Request) string {
+	var reasons []string
+	for _, m := range ms {
+		rewindBody(req)
+		if f, err := m.MatchRequest(req); err != nil || !f {
+			reasons = append(reasons, explainRequestMatcher(req, m, err))
+		}
+	}
+	return joinReasons(reasons)
+}
+
+// AnyOf returns the RequestMatcher which matches the request meeting at least one of the conditions.
+// If no condition is met and some conditions fail with an error, MatchRequest returns the first error.
+func AnyOf(matchers ...RequestMatcher) RequestMatcher {
+	return anyOf(matchers)
+}
+
+func (ms anyOf) MatchRequest(req *http.Request) (bool, error) {
+	var firstErr error
+	for _, m := range ms {
+		rewindBody(req)
+		f, err := m.MatchRequest(req)
+		if err != nil {
+			if firstErr == nil {
+				firstErr = err
+			}
+			continue
+		}
+		if f {
+			return true, nil
+		}
+	}
+	return false, firstErr
+}
+
+func (ms anyOf) String() string {
+	return joinRequestMatchers(ms, " or ")
+}
+
+func (ms anyOf) explainRequest(req *http.Request) string {
+	reasons := make([]string, len(ms))
+	for i, m := range ms {
+		rewindBody(req)
+		_, err := m.MatchRequest(req)
+		reasons[i] = explainRequestMatcher(req, m, err)
+	}
+	return joinReasons(reasons)
+}
+
+// Not returns the RequestMatcher which matches the request not meeting the condition.
+// If the condition fails with an error, MatchRequest returns the error.
+func Not(m RequestMatcher) RequestMatcher {
+	return not{m: m}
+}
+
+func (m not) MatchRequest(req *http.Request) (bool, error) {
+	rewindBody(req)
+	f, err := m.m.MatchRequest(req)
+	if err != nil {
+		return false, err
+	}
+	return !f, nil
+}
+
+func (m not) String() string {
+	return "not (" + m.m.String() + ")"
+}
+
+func (m not) explainRequest(req *http.Request) string {
+	return "the request meets " + m.m.String()
+}
+
+func joinRequestMatchers(ms []RequestMatcher, sep string) string {
+	descriptions := make([]string, len(ms))
+	for i, m := range ms {
+		descriptions[i] = m.String()
+	}
+	return "(" + strings.Join(descriptions, sep) + ")"
+}
+
+// joinReasons joins the reasons removing the duplicated reasons.
+func joinReasons(reasons []string) string {
+	seen := make(map[string]struct{}, len(reasons))
+	unique := make([]string, 0, len(reasons))
+	for _, r := range reasons {
+		if _, ok := seen[r]; ok {
+			continue
+		}
+		seen[r] = struct{}{}
+		unique = append(unique, r)
+	}
+	return strings.Join(unique, "; ")
+}
+
+// explainRequestMatcher describes why the request doesn't meet the RequestMatcher.
+func explainRequestMatcher(req *http.Request, m RequestMatcher, err error) string {
+	if err != nil {
+		return fmt.Sprintf("failed to check %s: %v", m, err)
+	}
+	if e, ok := m.(requestExplainer); ok {
+		return e.explainRequest(req)
+	}
+	return "the request doesn't meet " + m.String()
+}
+
+// Method returns the RequestMatcher which checks the request method like Matcher.Method.
+func Method(method string) RequestMatcher {
+	return fieldMatcher{
+		matcher:     Matcher{Method: method},
+		description: fmt.Sprintf("method is %q", method),
+	}
+}
+
+// Path returns the RequestMatcher which checks the request path like Matcher.Path.
+// Path supports the patterns such as "/users/{id}".
+func Path(path string) RequestMatcher {
+	description := fmt.Sprintf("path is %q", path)
+	if isPathPattern(path) {
+		description = fmt.Sprintf("path matches the pattern %q", path)
+	}
+	return fieldMatcher{
+		matcher:     Matcher{Path: path},
+		description: description,
+	}
+}
+
+// PathMatches returns the RequestMatcher which checks the request path like Matcher.PathMatcher.
+// If vm is nil, the RequestMatcher matches any path.
+func PathMatches(vm ValueMatcher) RequestMatcher {
+	if vm == nil {
+		return fieldMatcher{
+			description: "path is any",
+		}
+	}
+	return fieldMatcher{
+		matcher:     Matcher{PathMatcher: vm},
+		description: "path should " + vm.String(),
+	}
+}
+
+// BodyString returns the RequestMatcher which checks the request body like Matcher.BodyString.
+func BodyString(body string) RequestMatcher {
+	return fieldMatcher{
+		matcher:     Matcher{BodyString: body},
+		description: fmt.Sprintf("body is %q", body),
+	}
+}
+
+// BodyJSON returns the RequestMatcher which checks the request body like Matcher.BodyJSON.
+func BodyJSON(body interface{}) RequestMatcher {
+	return fieldMatcher{
+		matcher:     Matcher{BodyJSON: body},
+		description: "body is JSON " + describeJSON(body),
+	}
+}
+
+// BodyJSONString returns the RequestMatcher which checks the request body like Matcher.BodyJSONString.
+func BodyJSONString(body string) RequestMatcher {
+	return fieldMatcher{
+		matcher:     Matcher{BodyJSONString: body},
+		description: "body is JSON " + body,
+	}
+}
+
+// PartOfBodyJSON returns the RequestMatcher which checks the request body contains the JSON
+// like Matcher.PartOfBodyJSON.
+func PartOfBodyJSON(body interface{}, mode JSONArrayMode) RequestMatcher {
+	return fieldMatcher{
+		matcher:     Matcher{PartOfBodyJSON: body, PartOfBodyJSONArrayMode: mode},
+		description: fmt.Sprintf("body contains JSON %s (%s arrays)", describeJSON(body), mode),
+	}
+}
+
+// BodyJSONExprs returns the RequestMatcher which checks the request body with the expressions
+// like Matcher.BodyJSONExprs.
+func BodyJSONExprs(exprs ...JSONExpr) RequestMatcher {
+	descriptions := make([]string, len(exprs))
+	for i, e := range exprs {
+		descriptions[i] = e.String()
+	}
+	return fieldMatcher{
+		matcher:     Matcher{BodyJSONExprs: exprs},
+		description: "body meets " + strings.Join(descriptions, " and "),
+	}
+}
+
+// Header returns the RequestMatcher which checks the request header like Matcher.Header.
+func Header(header http.Header) RequestMatcher {
+	return fieldMatcher{
+		matcher:     Matcher{Header: header},
+		description: fmt.Sprintf("header is %q", header),
+	}
+}
+
+// PartOfHeader returns the RequestMatcher which checks the request header like Matcher.PartOfHeader.
+func PartOfHeader(header http.Header) RequestMatcher {
+	return fieldMatcher{
+		matcher:     Matcher{PartOfHeader: header},
+		description: describePartOfValues("header", header),
+	}
+}
+
+// HeaderMatches returns the RequestMatcher which checks the request header like Matcher.HeaderMatcher.
+func HeaderMatches(matchers map[string]ValueMatcher) RequestMatcher {
+	return fieldMatcher{
+		matcher:     Matcher{HeaderMatcher: matchers},
+		description: describeValueMatchers("header", matchers),
+	}
+}
+
+// Query returns the RequestMatcher which checks the request query parameters like Matcher.Query.
+func Query(query url.Values) RequestMatcher {
+	return fieldMatcher{
+		matcher:     Matcher{Query: query},
+		description: fmt.Sprintf("query is %q", query),
+	}
+}
+
+// PartOfQuery returns the RequestMatcher which checks the request query parameters like Matcher.PartOfQuery.
+func PartOfQuery(query url.Values) RequestMatcher {
+	return fieldMatcher{
+		matcher:     Matcher{PartOfQuery: query},
+		description: describePartOfValues("query", query),
+	}
+}
+
+// QueryMatches returns the RequestMatcher which checks the request query parameters like Matcher.QueryMatcher.
+func QueryMatches(matchers map[string]ValueMatcher) RequestMatcher {
+	return fieldMatcher{
+		matcher:     Matcher{QueryMatcher: matchers},
+		description: describeValueMatchers("query", matchers),
+	}
+}
+
+// Form returns the RequestMatcher which checks the request form like Matcher.Form.
+func Form(form url.Values) RequestMatcher {
+	return fieldMatcher{
+		matcher:     Matcher{Form: form},
+		description: fmt.Sprintf("form is %q", form),
+	}
+}
+
+// PartOfForm returns the RequestMatcher which checks the request form like Matcher.PartOfForm.
+func PartOfForm(form url.Values) RequestMatcher {
+	return fieldMatcher{
+		matcher:     Matcher{PartOfForm: form},
+		description: describePartOfValues("form", form),
+	}
+}
+
+// PartOfBodyJSONString returns the RequestMatcher which checks the request body contains the JSON string
+// like Matcher.PartOfBodyJSONString.
+func PartOfBodyJSONString(body string, mode JSONArrayMode) RequestMatcher {
+	return fieldMatcher{
+		matcher:     Matcher{PartOfBodyJSONString: body, PartOfBodyJSONArrayMode: mode},
+		description: fmt.Sprintf("body contains JSON %s (%s arrays)", body, mode),
+	}
+}
+
+// MultipartBody returns the RequestMatcher which checks the multipart/form-data request body like Matcher.Multipart.
+func MultipartBody(m Multipart) RequestMatcher {
+	var descriptions []string
+	if d := describePartOfValues("multipart field", m.Fields); d != "" {
+		descriptions = append(descriptions, d)
+	}
+	names := make([]string, 0, len(m.Files))
+	for name := range m.Files {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	for _, name := range names {
+		descriptions = append(descriptions, fmt.Sprintf("multipart file %q is present", name))
+	}
+	if m.PartCount != 0 {
+		descriptions = append(descriptions, fmt.Sprintf("multipart body has %d parts", m.PartCount))
+	}
+	if len(descriptions) == 0 {
+		descriptions = append(descriptions, "body is multipart/form-data")
+	}
+	return fieldMatcher{
+		matcher:     Matcher{Multipart: &m},
+		description: strings.Join(descriptions, " and "),
+	}
+}
+
+// BodyXML returns the RequestMatcher which checks the request body like Matcher.BodyXML.
+func BodyXML(body interface{}) RequestMatcher {
+	description := fmt.Sprintf("body is XML %v", body)
+	if b, err := xml.Marshal(body); err == nil {
+		description = "body is XML " + string(b)
+	}
+	return fieldMatcher{
+		matcher:     Matcher{BodyXML: body},
+		description: description,
+	}
+}
+
+// BodyXMLString returns the RequestMatcher which checks the request body like Matcher.BodyXMLString.
+func BodyXMLString(body string) RequestMatcher {
+	return fieldMatcher{
+		matcher:     Matcher{BodyXMLString: body},
+		description: "body is XML " + body,
+	}
+}
+
+// SOAPAction returns the RequestMatcher which checks the SOAP action like Matcher.SOAPAction.
+func SOAPAction(action string) RequestMatcher {
+	return fieldMatcher{
+		matcher:     Matcher{SOAPAction: action},
+		description: fmt.Sprintf("SOAP action is %q", action),
+	}
+}
+
+// SOAPOperation returns the RequestMatcher which checks the SOAP operation like Matcher.SOAPOperation.
+func SOAPOperation(operation string) RequestMatcher {
+	return fieldMatcher{
+		matcher:     Matcher{SOAPOperation: operation},
+		description: fmt.Sprintf("SOAP operation is %q", operation),
+	}
+}
+
+// GraphQLOperation returns the RequestMatcher which checks the GraphQL operation like Matcher.GraphQL.
+func GraphQLOperation(g GraphQL) RequestMatcher {
+	var descriptions []string
+	if g.OperationName != "" {
+		descriptions = append(descriptions, fmt.Sprintf("GraphQL operation name is %q", g.OperationName))
+	}
+	if g.Query != "" {
+		descriptions = append(descriptions, fmt.Sprintf("GraphQL query is %q", g.Query))
+	}
+	if g.Variables != nil {
+		descriptions = append(descriptions, "GraphQL variables are "+describeJSON(g.Variables))
+	}
+	if g.PartOfVariables != nil {
+		descriptions = append(descriptions, "GraphQL variables contain "+describeJSON(g.PartOfVariables))
+	}
+	if g.PersistedQueryHash != "" {
+		descriptions = append(descriptions, fmt.Sprintf("GraphQL persisted query hash is %q", g.PersistedQueryHash))
+	}
+	if len(descriptions) == 0 {
+		descriptions = append(descriptions, "request is a GraphQL operation")
+	}
+	return fieldMatcher{
+		matcher:     Matcher{GraphQL: &g},
+		description: strings.Join(descriptions, " and "),
+	}
+}
+
+// JSONRPCCall returns the RequestMatcher which checks the JSON-RPC 2.0 call like Matcher.JSONRPC.
+func JSONRPCCall(j JSONRPC) RequestMatcher {
+	descriptions := []string{fmt.Sprintf("JSON-RPC method is %q", j.Method)}
+	if j.Params != nil {
+		descriptions = append(descriptions, "JSON-RPC params are "+describeJSON(j.Params))
+	}
+	if j.PartOfParams != nil {
+		descriptions = append(descriptions, fmt.Sprintf("JSON-RPC params contain %s (%s arrays)",
+			describeJSON(j.PartOfParams), j.PartOfParamsArrayMode))
+	}
+	return fieldMatcher{
+		matcher:     Matcher{JSONRPC: &j},
+		description: strings.Join(descriptions, " and "),
+	}
+}
+
+// CookieMatches returns the RequestMatcher which checks the request cookies like Matcher.Cookie.
+func CookieMatches(matchers map[string]ValueMatcher) RequestMatcher {
+	return fieldMatcher{
+		matcher:     Matcher{Cookie: matchers},
+		description: describeValueMatchers("cookie", matchers),
+	}
+}
+
+// AbsentCookies returns the RequestMatcher which checks the request doesn't have the cookies
+// like Matcher.AbsentCookies.
+func AbsentCookies(names ...string) RequestMatcher {
+	descriptions := make([]string, len(names))
+	for i, name := range names {
+		descriptions[i] = fmt.Sprintf("cookie %q is absent", name)
+	}
+	return fieldMatcher{
+		matcher:     Matcher{AbsentCookies: names},
+		description: strings.Join(descriptions, " and "),
+	}
+}
+
+// Authenticated returns the RequestMatcher which checks the request has the credential like Matcher.Auth.
+func Authenticated(auth Auth) RequestMatcher {
+	return fieldMatcher{
+		matcher:     Matcher{Auth: auth},
+		description: "request has " + auth.String(),
+	}
+}
+
+// MatchFunc returns the RequestMatcher which checks the request with the custom function like Matcher.Match.
+// description is embedded in the failure message, so it should describe the condition.
+// Unlike Matcher.Match, f may be called more than once for a request,
+// for example to describe why the request doesn't match the route, so f shouldn't have side effects.
+func MatchFunc(description string, f func(req *http.Request) (bool, error)) RequestMatcher {
+	return fieldMatcher{
+		matcher:     Matcher{Match: f},
+		description: description,
+	}
+}
+
+// describeJSON returns the JSON of the value, or the value formatted with %v if it can't be marshaled.
+func describeJSON(v interface{}) string {
+	b, err := json.Marshal(v)
+	if err != nil {
+		return fmt.Sprintf("%v", v)
+	}
+	return string(b)
+}
+
+func sortedKeys(m map[string][]string) []string {
+	keys := make([]string, 0, len(m))
+	for k := range m {
+		keys = append(keys, k)
+	}
+	sort.Strings(keys)
+	return keys
+}
+
+func describePartOfValues(name string, values map[string][]string) string {
+	descriptions := make([]string, 0, len(values))
+	for _, k := range sortedKeys(values) {
+		if v := values[k]; v != nil {
+			descriptions = append(descriptions, fmt.Sprintf("%s %q is %q", name, k, v))
+			continue
+		}
+		descriptions = append(descriptions, fmt.Sprintf("%s %q is present", name, k))
+	}
+	return strings.Join(descriptions, " and ")
+}
+
+func describeValueMatchers(name string, matchers map[string]ValueMatcher) string {
+	keys := make([]string, 0, len(matchers))
+	for k := range matchers {
+		keys = append(keys, k)
+	}
+	sort.Strings(keys)
+	descriptions := make([]string, len(keys))
+	for i, k := range keys {
+		if vm := matchers[k]; vm != nil {
+			descriptions[i] = fmt.Sprintf("%s %q should %s", name, k, vm)
+			continue
+		}
+		descriptions[i] = fmt.Sprintf("%s %q is present", name, k)
+	}
+	return strings.Join(descriptions, " and ")
+}
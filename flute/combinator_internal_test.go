@@ -0,0 +1,220 @@
+package flute
+
+import (
+	"errors"
+	"io"
+	"net/http"
+	"net/url"
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/require"
+)
+
+func TestRequestMatcher(t *testing.T) { //nolint:funlen
+	newReq := func(method, path string) *http.Request {
+		return &http.Request{
+			Method: method,
+			URL: &url.URL{
+				Path:     path,
+				RawQuery: "page=2",
+			},
+			Header: http.Header{
+				"Authorization": []string{"token XXXXX"},
+			},
+			Body: io.NopCloser(strings.NewReader(`{"name": "foo"}`)),
+		}
+	}
+	readOnly := AllOf(
+		AnyOf(Method(http.MethodGet), Method(http.MethodHead)),
+		Not(PathMatches(Prefix("/internal/"))),
+	)
+	data := []struct {
+		title       string
+		req         *http.Request
+		matcher     RequestMatcher
+		isErr       bool
+		exp         bool
+		description string
+	}{
+		{
+			title:       "all of and any of",
+			req:         newReq(http.MethodHead, "/users"),
+			matcher:     readOnly,
+			exp:         true,
+			description: `((method is "GET" or method is "HEAD") and not (path should have prefix "/internal/"))`,
+		},
+		{
+			title:   "any of doesn't match",
+			req:     newReq(http.MethodPost, "/users"),
+			matcher: readOnly,
+		},
+		{
+			title:   "not doesn't match",
+			req:     newReq(http.MethodGet, "/internal/users"),
+			matcher: readOnly,
+		},
+		{
+			title:       "path pattern",
+			req:         newReq(http.MethodGet, "/users/10"),
+			matcher:     Path("/users/{id}"),
+			exp:         true,
+			description: `path matches the pattern "/users/{id}"`,
+		},
+		{
+			title:       "nil path matcher matches any path",
+			req:         newReq(http.MethodGet, "/users/10"),
+			matcher:     PathMatches(nil),
+			exp:         true,
+			description: "path is any",
+		},
+		{
+			title:       "part of header",
+			req:         newReq(http.MethodGet, "/users"),
+			matcher:     PartOfHeader(http.Header{"Authorization": nil}),
+			exp:         true,
+			description: `header "Authorization" is present`,
+		},
+		{
+			title:       "query matcher",
+			req:         newReq(http.MethodGet, "/users"),
+			matcher:     QueryMatches(map[string]ValueMatcher{"page": Regexp(`^\d+$`)}),
+			exp:         true,
+			description: `query "page" should match regexp "^\\d+$"`,
+		},
+		{
+			title:       "body",
+			req:         newReq(http.MethodPost, "/users"),
+			matcher:     BodyJSON(map[string]interface{}{"name": "foo"}),
+			exp:         true,
+			description: `body is JSON {"name":"foo"}`,
+		},
+		{
+			title:       "part of body JSON string",
+			req:         newReq(http.MethodPost, "/users"),
+			matcher:     PartOfBodyJSONString(`{"name": "foo"}`, JSONArrayUnordered),
+			exp:         true,
+			description: `body contains JSON {"name": "foo"} (unordered arrays)`,
+		},
+		{
+			title:       "multipart",
+			req:         newReq(http.MethodPost, "/users"),
+			matcher:     MultipartBody(Multipart{Fields: url.Values{"name": nil}, Files: map[string]MultipartFile{"icon": {}}}),
+			description: `multipart field "name" is present and multipart file "icon" is present`,
+		},
+		{
+			title:       "SOAP action doesn't match",
+			req:         newReq(http.MethodPost, "/users"),
+			matcher:     SOAPAction("http://example.com/GetPrice"),
+			description: `SOAP action is "http://example.com/GetPrice"`,
+		},
+		{
+			title:       "GraphQL operation doesn't match",
+			req:         newReq(http.MethodPost, "/graphql"),
+			matcher:     GraphQLOperation(GraphQL{OperationName: "GetUser", PartOfVariables: map[string]interface{}{"id": 1}}),
+			description: `GraphQL operation name is "GetUser" and GraphQL variables contain {"id":1}`,
+		},
+		{
+			title:       "JSON-RPC call doesn't match",
+			req:         newReq(http.MethodPost, "/rpc"),
+			matcher:     JSONRPCCall(JSONRPC{Method: "user.get", PartOfParams: map[string]interface{}{"id": 1}}),
+			description: `JSON-RPC method is "user.get" and JSON-RPC params contain {"id":1} (ordered arrays)`,
+		},
+		{
+			title:       "absent cookies",
+			req:         newReq(http.MethodGet, "/users"),
+			matcher:     AbsentCookies("session"),
+			exp:         true,
+			description: `cookie "session" is absent`,
+		},
+		{
+			title:       "auth",
+			req:         newReq(http.MethodGet, "/users"),
+			matcher:     Authenticated(APIKeyHeader("Authorization", "token XXXXX")),
+			exp:         true,
+			description: `request has API key *********** in the header "Authorization"`,
+		},
+		{
+			title: "any of returns the error if no condition is met",
+			req:   newReq(http.MethodGet, "/users"),
+			matcher: AnyOf(
+				Method(http.MethodPost),
+				MatchFunc("custom", func(req *http.Request) (bool, error) {
+					return false, errors.New("failed to match")
+				}),
+			),
+			isErr: true,
+		},
+		{
+			title: "any of ignores the error if a condition is met",
+			req:   newReq(http.MethodGet, "/users"),
+			matcher: AnyOf(
+				MatchFunc("custom", func(req *http.Request) (bool, error) {
+					return false, errors.New("failed to match")
+				}),
+				Method(http.MethodGet),
+			),
+			exp: true,
+		},
+		{
+			title: "not returns the error",
+			req:   newReq(http.MethodGet, "/users"),
+			matcher: Not(MatchFunc("custom", func(req *http.Request) (bool, error) {
+				return false, errors.New("failed to match")
+			})),
+			isErr: true,
+		},
+	}
+
+	for _, d := range data {
+		d := d
+		t.Run(d.title, func(t *testing.T) {
+			if d.description != "" {
+				require.Equal(t, d.description, d.matcher.String())
+			}
+			b, err := d.matcher.MatchRequest(d.req)
+			if d.isErr {
+				require.Error(t, err)
+				return
+			}
+			require.NoError(t, err)
+			require.Equal(t, d.exp, b)
+		})
+	}
+}
+
+func Test_explainCondition(t *testing.T) {
+	req := &http.Request{
+		Method: http.MethodPost,
+		URL: &url.URL{
+			Path: "/internal/users",
+		},
+	}
+	m := explainCondition(req, Matcher{
+		Condition: AllOf(
+			AnyOf(Method(http.MethodGet), Method(http.MethodHead)),
+			Not(PathMatches(Prefix("/internal/"))),
+		),
+	})
+	require.Equal(t, mismatch{
+		condition: "condition",
+		expected:  `((method is "GET" or method is "HEAD") and not (path should have prefix "/internal/"))`,
+		actual:    `method is "POST"; the request meets path should have prefix "/internal/"`,
+	}, m)
+}
+
+func Test_fieldMatcher_explainRequest(t *testing.T) {
+	req := &http.Request{
+		Method: http.MethodPost,
+		URL:    &url.URL{Path: "/users"},
+		Header: http.Header{},
+	}
+	m := Method(http.MethodGet).(fieldMatcher) //nolint:forcetypeassert
+	require.Equal(t, `method is "POST"`, m.explainRequest(req))
+	m = PartOfHeader(http.Header{"Authorization": nil}).(fieldMatcher) //nolint:forcetypeassert
+	require.Equal(t, `header "Authorization" is missing`, m.explainRequest(req))
+	req.Header.Set("Authorization", "token XXXXX")
+	require.Equal(t, `the request meets header "Authorization" is present`, m.explainRequest(req))
+	m = BodyJSON(func() {}).(fieldMatcher) //nolint:forcetypeassert
+	require.Equal(t, "body: failed to marshal BodyJSON as JSON: json: unsupported type: func()", m.explainRequest(req))
+}
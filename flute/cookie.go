@@ -0,0 +1,195 @@
+package flute
+
+import (
+	"fmt"
+	"net/http"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+type (
+	// Session simulates the cookie session between the client and the services.
+	// Cookies set by the responses of a service with Set-Cookie are recorded,
+	// and the later requests to the service must have them.
+	// This is useful to test the flow such as login through http.Client.Jar.
+	// The zero value is an empty session ready to use.
+	Session struct {
+		// cookies are the cookies of each service endpoint.
+		cookies map[string][]sessionCookie
+		mutex   sync.Mutex
+	}
+
+	// sessionCookie is the cookie recorded in Session.
+	sessionCookie struct {
+		cookie *http.Cookie
+		// route is the name of the route which set the cookie.
+		route string
+	}
+)
+
+// cookieValues returns the function to get the values of the request cookie.
+func cookieValues(req *http.Request) func(string) ([]string, bool) {
+	cookies := req.Cookies()
+	return func(name string) ([]string, bool) {
+		var values []string
+		for _, c := range cookies {
+			if c.Name == name {
+				values = append(values, c.Value)
+			}
+		}
+		return values, values != nil
+	}
+}
+
+// findPresentCookies returns the names of the request cookies which shouldn't be sent.
+func findPresentCookies(req *http.Request, names []string) []string {
+	if len(names) == 0 {
+		return nil
+	}
+	get := cookieValues(req)
+	var present []string
+	for _, name := range names {
+		if _, ok := get(name); ok {
+			present = append(present, name)
+		}
+	}
+	return present
+}
+
+// Cookies returns the cookies which the session has now.
+// The cookies are sorted by the service endpoint and the cookie name.
+func (session *Session) Cookies() []*http.Cookie {
+	session.mutex.Lock()
+	defer session.mutex.Unlock()
+	endpoints := make([]string, 0, len(session.cookies))
+	for endpoint := range session.cookies {
+		endpoints = append(endpoints, endpoint)
+	}
+	sort.Strings(endpoints)
+	var cookies []*http.Cookie
+	for _, endpoint := range endpoints {
+		for _, c := range session.cookies[endpoint] {
+			cookie := *c.cookie
+			cookies = append(cookies, &cookie)
+		}
+	}
+	return cookies
+}
+
+// Reset removes all cookies from the session.
+func (session *Session) Reset() {
+	session.mutex.Lock()
+	session.cookies = nil
+	session.mutex.Unlock()
+}
+
+// update records the cookies which the response of the route sets.
+// The cookie which has a negative Max-Age or the past Expires is removed from the session.
+func (session *Session) update(service Service, route Route, resp *http.Response, now time.Time) {
+	setCookies := resp.Cookies()
+	if len(setCookies) == 0 {
+		return
+	}
+	session.mutex.Lock()
+	defer session.mutex.Unlock()
+	if session.cookies == nil {
+		session.cookies = map[string][]sessionCookie{}
+	}
+	cookies := session.cookies[service.Endpoint]
+	for _, setCookie := range setCookies {
+		if setCookie.Path == "" {
+			setCookie.Path = "/"
+		}
+		kept := cookies[:0]
+		for _, c := range cookies {
+			if c.cookie.Name != setCookie.Name || c.cookie.Path != setCookie.Path {
+				kept = append(kept, c)
+			}
+		}
+		cookies = kept
+		if setCookie.MaxAge < 0 || (!setCookie.Expires.IsZero() && !setCookie.Expires.After(now)) {
+			continue
+		}
+		cookies = append(cookies, sessionCookie{
+			cookie: setCookie,
+			route:  route.Name,
+		})
+	}
+	sort.SliceStable(cookies, func(i, j int) bool {
+		return cookies[i].cookie.Name < cookies[j].cookie.Name
+	})
+	session.cookies[service.Endpoint] = cookies
+}
+
+// check returns the messages about the session cookies which the request doesn't have.
+// Only the cookies whose path matches the request path are required.
+func (session *Session) check(req *http.Request, service Service) []string {
+	session.mutex.Lock()
+	cookies := append([]sessionCookie(nil), session.cookies[service.Endpoint]...)
+	session.mutex.Unlock()
+	get := cookieValues(req)
+	var msgs []string
+	for _, c := range cookies {
+		if !matchCookiePath(c.cookie.Path, req.URL.Path) {
+			continue
+		}
+		values, ok := get(c.cookie.Name)
+		if !ok {
+			msgs = append(msgs, fmt.Sprintf(
+				"the request cookie %q set by the route %q is required", c.cookie.Name, c.route))
+			continue
+		}
+		if !containsString(values, c.cookie.Value) {
+			msgs = append(msgs, fmt.Sprintf(
+				"the request cookie %q should be %q which the route %q set\nactual: %q",
+				c.cookie.Name, c.cookie.Value, c.route, values))
+		}
+	}
+	return msgs
+}
+
+// matchCookiePath returns whether the cookie with the path is sent to the request path.
+// https://www.rfc-editor.org/rfc/rfc6265#section-5.1.4
+func matchCookiePath(cookiePath, reqPath string) bool {
+	if reqPath == "" {
+		reqPath = "/"
+	}
+	if cookiePath == reqPath {
+		return true
+	}
+	if !strings.HasPrefix(reqPath, cookiePath) {
+		return false
+	}
+	return strings.HasSuffix(cookiePath, "/") || reqPath[len(cookiePath)] == '/'
+}
+
+func containsString(values []string, s string) bool {
+	for _, v := range values {
+		if v == s {
+			return true
+		}
+	}
+	return false
+}
+
+// checkSession tests whether the request has the cookies of the session.
+func (transport Transport) checkSession(req *http.Request, service Service, route Route) {
+	if transport.Session == nil || transport.T == nil {
+		return
+	}
+	for _, msg := range transport.Session.check(req, service) {
+		assert.Fail(transport.T, makeMsg(msg, service.Endpoint, route.Name))
+	}
+}
+
+// updateSession records the cookies which the response sets.
+func (transport Transport) updateSession(service Service, route Route, resp *http.Response) {
+	if transport.Session == nil || resp == nil {
+		return
+	}
+	transport.Session.update(service, route, resp, time.Now())
+}
@@ -0,0 +1,168 @@
+package flute
+
+import (
+	"net/http"
+	"net/url"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/require"
+)
+
+func Test_matchCookiePath(t *testing.T) {
+	data := []struct {
+		cookiePath string
+		reqPath    string
+		exp        bool
+	}{
+		{cookiePath: "/", reqPath: "/users", exp: true},
+		{cookiePath: "/api", reqPath: "/api", exp: true},
+		{cookiePath: "/api", reqPath: "/api/users", exp: true},
+		{cookiePath: "/api/", reqPath: "/api/users", exp: true},
+		{cookiePath: "/api", reqPath: "/apis"},
+		{cookiePath: "/api", reqPath: "/"},
+		{cookiePath: "/", reqPath: "", exp: true},
+	}
+	for _, d := range data {
+		d := d
+		t.Run(d.cookiePath+" "+d.reqPath, func(t *testing.T) {
+			require.Equal(t, d.exp, matchCookiePath(d.cookiePath, d.reqPath))
+		})
+	}
+}
+
+func Test_isMatchCookie(t *testing.T) {
+	data := []struct {
+		title   string
+		cookie  string
+		matcher Matcher
+		exp     bool
+	}{
+		{
+			title:  "value and presence",
+			cookie: "session=abc; theme=dark",
+			matcher: Matcher{
+				Cookie: map[string]ValueMatcher{
+					"session": Prefix("a"),
+					"theme":   nil,
+				},
+			},
+			exp: true,
+		},
+		{
+			title:  "value doesn't match",
+			cookie: "session=xyz",
+			matcher: Matcher{
+				Cookie: map[string]ValueMatcher{
+					"session": Equal("abc"),
+				},
+			},
+		},
+		{
+			title: "cookie is missing",
+			matcher: Matcher{
+				Cookie: map[string]ValueMatcher{
+					"session": nil,
+				},
+			},
+		},
+		{
+			title:  "absent",
+			cookie: "theme=dark",
+			matcher: Matcher{
+				AbsentCookies: []string{"session"},
+			},
+			exp: true,
+		},
+		{
+			title:  "cookie which should be absent is sent",
+			cookie: "session=abc",
+			matcher: Matcher{
+				AbsentCookies: []string{"session"},
+			},
+		},
+	}
+	for _, d := range data {
+		d := d
+		t.Run(d.title, func(t *testing.T) {
+			req := &http.Request{Header: http.Header{}}
+			if d.cookie != "" {
+				req.Header.Set("Cookie", d.cookie)
+			}
+			b, err := isMatch(req, d.matcher)
+			require.NoError(t, err)
+			require.Equal(t, d.exp, b)
+		})
+	}
+}
+
+func TestSession(t *testing.T) { //nolint:funlen
+	now := time.Date(2026, 1, 1, 0, 0, 0, 0, time.UTC)
+	service := Service{Endpoint: "http://example.com"}
+	setCookie := func(cookies ...*http.Cookie) *http.Response {
+		resp := &http.Response{Header: http.Header{}}
+		for _, c := range cookies {
+			resp.Header.Add("Set-Cookie", c.String())
+		}
+		return resp
+	}
+	request := func(path, cookie string) *http.Request {
+		req := &http.Request{URL: &url.URL{Path: path}, Header: http.Header{}}
+		if cookie != "" {
+			req.Header.Set("Cookie", cookie)
+		}
+		return req
+	}
+
+	session := &Session{}
+	require.Empty(t, session.check(request("/users", ""), service))
+
+	session.update(service, Route{Name: "login"}, setCookie(
+		&http.Cookie{Name: "session", Value: "abc"},
+		&http.Cookie{Name: "csrf", Value: "xyz", Path: "/api"},
+	), now)
+	require.Len(t, session.Cookies(), 2)
+	require.Empty(t, session.check(request("/users", "session=abc"), service))
+	require.Empty(t, session.check(request("/api/users", "session=abc; csrf=xyz"), service))
+	require.Empty(t, session.check(request("/users", ""), Service{Endpoint: "http://example.org"}))
+
+	msgs := session.check(request("/api/users", "session=def"), service)
+	require.Len(t, msgs, 2)
+	require.Contains(t, msgs[0], `the request cookie "csrf" set by the route "login" is required`)
+	require.Contains(t, msgs[1], `the request cookie "session" should be "abc" which the route "login" set`)
+
+	session.update(service, Route{Name: "logout"}, setCookie(
+		&http.Cookie{Name: "session", MaxAge: -1},
+		&http.Cookie{Name: "csrf", Path: "/api", Expires: now.Add(-time.Hour)},
+	), now)
+	require.Empty(t, session.Cookies())
+	require.Empty(t, session.check(request("/users", ""), service))
+
+	session.update(service, Route{Name: "login"}, setCookie(&http.Cookie{Name: "session", Value: "abc"}), now)
+	session.Reset()
+	require.Empty(t, session.Cookies())
+}
+
+func Test_testCookie(t *testing.T) {
+	tb := newFakeTB(t)
+	req := &http.Request{Header: http.Header{}}
+	req.Header.Set("Cookie", "session=xyz; tracking=1")
+	route := Route{
+		Name: "get the profile",
+		Tester: Tester{
+			Cookie: map[string]ValueMatcher{
+				"session": Equal("abc"),
+				"theme":   nil,
+			},
+			AbsentCookies: []string{"tracking"},
+		},
+	}
+	service := Service{Endpoint: "http://example.com"}
+	testCookie(tb, req, service, route)
+	testAbsentCookies(tb, req, service, route)
+	errs := tb.Errors()
+	require.Len(t, errs, 3)
+	require.Contains(t, errs[0], `the request cookie "session" should equal "abc"`)
+	require.Contains(t, errs[1], "the following request cookie is required: theme")
+	require.Contains(t, errs[2], "the following request cookie shouldn't be sent: tracking")
+}
@@ -0,0 +1,602 @@
+package flute
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"reflect"
+	"sort"
+	"strings"
+
+	"github.com/pmezard/go-difflib/difflib"
+)
+
+// maxCandidates is the maximum number of the closest routes shown when no route matches the request.
+const maxCandidates = 3
+
+type (
+	// mismatch describes a condition which the request doesn't meet.
+	mismatch struct {
+		condition string
+		expected  string
+		actual    string
+		// diff is the unified diff between the expected and actual values.
+		diff string
+	}
+
+	explainFunc func(req *http.Request, matcher Matcher) mismatch
+
+	// candidate is a route which doesn't match the request.
+	candidate struct {
+		service    Service
+		route      Route
+		passed     int
+		total      int
+		mismatches []mismatch
+	}
+)
+
+// diagnoseRoute checks all conditions of the route and returns which conditions the request doesn't meet.
+// diagnoseRoute doesn't call Matcher.Match because Match may have side effects,
+// and Match is reported as the failed condition only when the request meets all other conditions.
+// Matcher.Condition is checked like other conditions, so the functions of MatchFunc in it are called again.
+func diagnoseRoute(req *http.Request, service Service, route Route) candidate {
+	c := candidate{
+		service: service,
+		route:   route,
+	}
+	check := func(ok bool, m func() mismatch) {
+		c.total++
+		if ok {
+			c.passed++
+			return
+		}
+		c.mismatches = append(c.mismatches, m())
+	}
+
+	ep, f, err := matchService(req, service)
+	check(f, func() mismatch {
+		return explainEndpoint(req, service, err)
+	})
+	if f {
+		req = ep.relativeRequest(req)
+	}
+	if route.Scenario != nil && route.ScenarioState != "" {
+		check(isMatchScenario(route), func() mismatch {
+			return mismatch{
+				condition: fmt.Sprintf("scenario %q state", route.Scenario.Name),
+				expected:  route.ScenarioState,
+				actual:    route.Scenario.State(),
+			}
+		})
+	}
+	for _, cond := range conditions {
+		cond := cond
+		if !cond.isSet(route.Matcher) {
+			continue
+		}
+		f, err := cond.match(req, route.Matcher)
+		check(f && err == nil, func() mismatch {
+			m := cond.explain(req, route.Matcher)
+			if err != nil {
+				m.actual = fmt.Sprintf("failed to check the condition: %v", err)
+				m.diff = ""
+			}
+			return m
+		})
+	}
+	if route.Matcher.Match != nil {
+		if len(c.mismatches) != 0 {
+			// Match isn't called when the request doesn't meet other conditions
+			c.total++
+		} else {
+			check(false, func() mismatch {
+				return mismatch{
+					condition: "Match",
+					expected:  "true",
+					actual:    "false or an error",
+				}
+			})
+		}
+	}
+	return c
+}
+
+func explainEndpoint(req *http.Request, service Service, err error) mismatch {
+	expected := strings.Join(service.endpoints(), " or ")
+	if service.HostMatcher != nil {
+		expected += fmt.Sprintf(" (host should %s)", service.HostMatcher)
+	}
+	actual := req.URL.Scheme + "://" + req.URL.Host
+	for _, s := range service.endpoints() {
+		if ep, err := loadEndpoint(s); err == nil && ep.basePath != "" {
+			// show the path to compare it with the base path
+			actual += req.URL.EscapedPath()
+			break
+		}
+	}
+	m := mismatch{
+		condition: "endpoint",
+		expected:  expected,
+		actual:    actual,
+	}
+	if err != nil {
+		m.actual = fmt.Sprintf("failed to check the condition: %v", err)
+	}
+	return m
+}
+
+// findCandidates returns the routes closest to the request.
+// The routes are ranked by the number of the route's conditions the request meets.
+func findCandidates(req *http.Request, services []Service) []candidate {
+	var candidates []candidate
+	for _, service := range services {
+		for _, route := range service.Routes {
+			candidates = append(candidates, diagnoseRoute(req, service, route))
+		}
+	}
+	sort.SliceStable(candidates, func(i, j int) bool {
+		return candidates[i].passed > candidates[j].passed
+	})
+	if len(candidates) > maxCandidates {
+		return candidates[:maxCandidates]
+	}
+	return candidates
+}
+
+// makeCandidatesMsg returns the message which describes the routes closest to the request.
+// If there is no route, makeCandidatesMsg returns an empty string.
+func makeCandidatesMsg(req *http.Request, services []Service) string {
+	candidates := findCandidates(req, services)
+	if len(candidates) == 0 {
+		return ""
+	}
+	lines := []string{"closest routes:"}
+	for i, c := range candidates {
+		lines = append(lines, fmt.Sprintf(
+			"%d. service: %s, route: %s (passed %d of %d conditions)",
+			i+1, c.service.Endpoint, c.route.Name, c.passed, c.total))
+		for _, m := range c.mismatches {
+			lines = append(lines,
+				"  "+m.condition+":",
+				"    expected: "+m.expected,
+				"    actual:   "+m.actual)
+			if m.diff != "" {
+				lines = append(lines, "    diff:")
+				for _, l := range strings.Split(strings.TrimSuffix(m.diff, "\n"), "\n") {
+					lines = append(lines, "      "+l)
+				}
+			}
+		}
+	}
+	return strings.Join(lines, "\n")
+}
+
+func explainPath(req *http.Request, matcher Matcher) mismatch {
+	return mismatch{
+		condition: "path",
+		expected:  fmt.Sprintf("%q", matcher.Path),
+		actual:    fmt.Sprintf("%q", req.URL.Path),
+	}
+}
+
+func explainMethod(req *http.Request, matcher Matcher) mismatch {
+	return mismatch{
+		condition: "method",
+		expected:  fmt.Sprintf("%q", matcher.Method),
+		actual:    fmt.Sprintf("%q", req.Method),
+	}
+}
+
+func explainBody(req *http.Request, expected string, format func(string) string) mismatch {
+	m := mismatch{
+		condition: "body",
+		expected:  fmt.Sprintf("%q", expected),
+	}
+	if req.Body == nil {
+		m.actual = "no body"
+		return m
+	}
+	b, err := readBody(req)
+	if err != nil {
+		m.actual = fmt.Sprintf("failed to read the request body: %v", err)
+		return m
+	}
+	m.actual = fmt.Sprintf("%q", string(b))
+	m.diff = diff(format(expected), format(string(b)))
+	return m
+}
+
+func explainBodyString(req *http.Request, matcher Matcher) mismatch {
+	return explainBody(req, matcher.BodyString, func(s string) string {
+		return s
+	})
+}
+
+func explainBodyJSONString(req *http.Request, matcher Matcher) mismatch {
+	return explainBody(req, matcher.BodyJSONString, prettyJSON)
+}
+
+func explainBodyJSON(req *http.Request, matcher Matcher) mismatch {
+	b, err := json.Marshal(matcher.BodyJSON)
+	if err != nil {
+		return mismatch{
+			condition: "body",
+			expected:  fmt.Sprintf("failed to marshal BodyJSON as JSON: %v", err),
+		}
+	}
+	return explainBody(req, string(b), prettyJSON)
+}
+
+func explainBodyXML(req *http.Request, matcher Matcher) mismatch {
+	expected, err := bodyXML(matcher.BodyXML, matcher.BodyXMLString)
+	if err != nil {
+		return mismatch{
+			condition: "body",
+			expected:  err.Error(),
+		}
+	}
+	return explainBody(req, string(expected), prettyXML)
+}
+
+func explainSOAPAction(req *http.Request, matcher Matcher) mismatch {
+	return mismatch{
+		condition: "SOAP action",
+		expected:  fmt.Sprintf("%q", matcher.SOAPAction),
+		actual:    fmt.Sprintf("%q", soapAction(req)),
+	}
+}
+
+func explainSOAPOperation(req *http.Request, matcher Matcher) mismatch {
+	m := mismatch{
+		condition: "SOAP operation",
+		expected:  fmt.Sprintf("%q", matcher.SOAPOperation),
+	}
+	if req.Body == nil {
+		m.actual = "no body"
+		return m
+	}
+	b, err := readBody(req)
+	if err != nil {
+		m.actual = fmt.Sprintf("failed to read the request body: %v", err)
+		return m
+	}
+	op, err := soapOperation(b)
+	if err != nil {
+		m.actual = err.Error()
+		return m
+	}
+	m.actual = fmt.Sprintf("%q", formatXMLName(op))
+	return m
+}
+
+func explainAuth(req *http.Request, matcher Matcher) mismatch {
+	f, err := findAuthFailure(req, matcher.Auth)
+	if err != nil {
+		return mismatch{
+			condition: "auth",
+			actual:    err.Error(),
+		}
+	}
+	if f == nil {
+		return mismatch{condition: "auth"}
+	}
+	return mismatch{
+		condition: f.subject,
+		expected:  f.expected,
+		actual:    f.actual,
+	}
+}
+
+func explainCookie(req *http.Request, matcher Matcher) mismatch {
+	return explainValueMismatches("cookie", findValueMismatches(matcher.Cookie, cookieValues(req)))
+}
+
+func explainAbsentCookies(req *http.Request, matcher Matcher) mismatch {
+	present := findPresentCookies(req, matcher.AbsentCookies)
+	if len(present) == 0 {
+		return mismatch{condition: "cookie"}
+	}
+	return mismatch{
+		condition: fmt.Sprintf("cookie %q", present[0]),
+		expected:  "absent",
+		actual:    "present",
+	}
+}
+
+func explainJSONRPC(req *http.Request, matcher Matcher) mismatch {
+	mismatches, err := findJSONRPCMismatches(req, matcher.JSONRPC)
+	if err != nil {
+		return mismatch{
+			condition: "JSON-RPC",
+			actual:    err.Error(),
+		}
+	}
+	if len(mismatches) == 0 {
+		return mismatch{condition: "JSON-RPC"}
+	}
+	m := mismatches[0]
+	return mismatch{
+		condition: "JSON-RPC " + m.subject,
+		expected:  m.expected,
+		actual:    m.actual,
+	}
+}
+
+func explainGraphQL(req *http.Request, matcher Matcher) mismatch {
+	mismatches, err := findGraphQLMismatches(req, matcher.GraphQL)
+	if err != nil {
+		return mismatch{
+			condition: "GraphQL",
+			actual:    err.Error(),
+		}
+	}
+	if len(mismatches) == 0 {
+		return mismatch{condition: "GraphQL"}
+	}
+	m := mismatches[0]
+	mm := mismatch{
+		condition: "GraphQL " + m.subject,
+		expected:  m.expected,
+		actual:    m.actual,
+	}
+	if m.subject == "query" {
+		mm.expected = fmt.Sprintf("%q", m.expected)
+		mm.actual = fmt.Sprintf("%q", m.actual)
+		mm.diff = diff(m.expected, m.actual)
+	}
+	return mm
+}
+
+func explainPartOfHeader(req *http.Request, matcher Matcher) mismatch {
+	return explainPartOfValues("header", matcher.PartOfHeader, req.Header)
+}
+
+func explainPartOfQuery(req *http.Request, matcher Matcher) mismatch {
+	return explainPartOfValues("query", matcher.PartOfQuery, req.URL.Query())
+}
+
+func explainPartOfForm(req *http.Request, matcher Matcher) mismatch {
+	form, err := readForm(req)
+	if err != nil {
+		return mismatch{
+			condition: "form",
+			expected:  fmt.Sprintf("%q", matcher.PartOfForm),
+			actual:    err.Error(),
+		}
+	}
+	return explainPartOfValues("form", matcher.PartOfForm, form)
+}
+
+func explainForm(req *http.Request, matcher Matcher) mismatch {
+	m := mismatch{
+		condition: "form",
+		expected:  fmt.Sprintf("%q", matcher.Form),
+	}
+	form, err := readForm(req)
+	switch {
+	case err != nil:
+		m.actual = err.Error()
+	case form == nil:
+		m.actual = "no body"
+	default:
+		m.actual = fmt.Sprintf("%q", form)
+	}
+	return m
+}
+
+func explainMultipart(req *http.Request, matcher Matcher) mismatch {
+	mismatches, err := findMultipartMismatches(req, matcher.Multipart)
+	if err != nil {
+		return mismatch{
+			condition: "multipart",
+			actual:    err.Error(),
+		}
+	}
+	if len(mismatches) == 0 {
+		return mismatch{condition: "multipart"}
+	}
+	m := mismatches[0]
+	return mismatch{
+		condition: "multipart " + m.subject,
+		expected:  m.expected,
+		actual:    m.actual,
+	}
+}
+
+func explainPartOfValues(name string, expected, actual map[string][]string) mismatch {
+	keys := make([]string, 0, len(expected))
+	for k := range expected {
+		keys = append(keys, k)
+	}
+	sort.Strings(keys)
+	for _, k := range keys {
+		v := expected[k]
+		a, ok := actual[k]
+		if !ok {
+			exp := "present"
+			if v != nil {
+				exp = fmt.Sprintf("%q", v)
+			}
+			return mismatch{
+				condition: fmt.Sprintf("%s %q", name, k),
+				expected:  exp,
+				actual:    "missing",
+			}
+		}
+		if v != nil && !reflect.DeepEqual(v, a) {
+			return mismatch{
+				condition: fmt.Sprintf("%s %q", name, k),
+				expected:  fmt.Sprintf("%q", v),
+				actual:    fmt.Sprintf("%q", a),
+			}
+		}
+	}
+	return mismatch{condition: name}
+}
+
+// explainValues returns the first key whose values differ, or which is missing or extra in the actual values.
+// If no key differs, for example when one is nil and the other is empty, the whole values are compared.
+func explainValues(name string, expected, actual map[string][]string) mismatch {
+	keys := make([]string, 0, len(expected)+len(actual))
+	for k := range expected {
+		keys = append(keys, k)
+	}
+	for k := range actual {
+		if _, ok := expected[k]; !ok {
+			keys = append(keys, k)
+		}
+	}
+	sort.Strings(keys)
+	for _, k := range keys {
+		v, expOK := expected[k]
+		a, actOK := actual[k]
+		switch {
+		case !actOK:
+			return mismatch{
+				condition: fmt.Sprintf("%s %q", name, k),
+				expected:  fmt.Sprintf("%q", v),
+				actual:    "missing",
+			}
+		case !expOK:
+			return mismatch{
+				condition: fmt.Sprintf("%s %q", name, k),
+				expected:  "absent",
+				actual:    fmt.Sprintf("%q", a),
+			}
+		case !reflect.DeepEqual(v, a):
+			return mismatch{
+				condition: fmt.Sprintf("%s %q", name, k),
+				expected:  fmt.Sprintf("%q", v),
+				actual:    fmt.Sprintf("%q", a),
+			}
+		}
+	}
+	return mismatch{
+		condition: name,
+		expected:  fmt.Sprintf("%q", expected),
+		actual:    fmt.Sprintf("%q", actual),
+	}
+}
+
+func explainHeader(req *http.Request, matcher Matcher) mismatch {
+	return explainValues("header", matcher.Header, req.Header)
+}
+
+func explainQuery(req *http.Request, matcher Matcher) mismatch {
+	return explainValues("query", matcher.Query, req.URL.Query())
+}
+
+func explainPathMatcher(req *http.Request, matcher Matcher) mismatch {
+	return mismatch{
+		condition: "path",
+		expected:  matcher.PathMatcher.String(),
+		actual:    fmt.Sprintf("%q", req.URL.Path),
+	}
+}
+
+func explainHeaderMatcher(req *http.Request, matcher Matcher) mismatch {
+	return explainValueMismatches("header", findValueMismatches(matcher.HeaderMatcher, headerValues(req)))
+}
+
+func explainQueryMatcher(req *http.Request, matcher Matcher) mismatch {
+	return explainValueMismatches("query", findValueMismatches(matcher.QueryMatcher, queryValues(req)))
+}
+
+func explainValueMismatches(name string, mismatches []valueMismatch) mismatch {
+	if len(mismatches) == 0 {
+		return mismatch{condition: name}
+	}
+	m := mismatches[0]
+	return mismatch{
+		condition: fmt.Sprintf("%s %q", name, m.key),
+		expected:  m.expected(),
+		actual:    m.actual(),
+	}
+}
+
+func explainPartOfBodyJSON(req *http.Request, matcher Matcher) mismatch {
+	expected, err := partOfBodyJSON(matcher.PartOfBodyJSON, matcher.PartOfBodyJSONString)
+	if err != nil {
+		return mismatch{
+			condition: "body",
+			expected:  err.Error(),
+		}
+	}
+	m, err := findPartOfBodyJSONMismatch(req, expected, matcher.PartOfBodyJSONArrayMode)
+	if err != nil {
+		return mismatch{
+			condition: "body",
+			expected:  "contain " + string(expected),
+			actual:    err.Error(),
+		}
+	}
+	if m == nil {
+		return mismatch{condition: "body"}
+	}
+	return mismatch{
+		condition: "body " + m.path,
+		expected:  m.expected,
+		actual:    m.actual,
+	}
+}
+
+func explainBodyJSONExprs(req *http.Request, matcher Matcher) mismatch {
+	failures, err := findJSONExprFailures(req, matcher.BodyJSONExprs)
+	if err != nil {
+		return mismatch{
+			condition: "body expression",
+			actual:    err.Error(),
+		}
+	}
+	if len(failures) == 0 {
+		return mismatch{condition: "body expression"}
+	}
+	f := failures[0]
+	return mismatch{
+		condition: "body expression",
+		expected:  f.expr.String(),
+		actual:    f.actual,
+	}
+}
+
+func explainCondition(req *http.Request, matcher Matcher) mismatch {
+	return mismatch{
+		condition: "condition",
+		expected:  matcher.Condition.String(),
+		actual:    explainRequestMatcher(req, matcher.Condition, nil),
+	}
+}
+
+// prettyJSON formats the JSON string with indentation and sorted keys.
+// If s isn't a valid JSON, prettyJSON returns s as it is.
+func prettyJSON(s string) string {
+	var v interface{}
+	if err := json.Unmarshal([]byte(s), &v); err != nil {
+		return s
+	}
+	b, err := json.MarshalIndent(v, "", "  ")
+	if err != nil {
+		return s
+	}
+	return string(b)
+}
+
+// diff returns the unified diff between the expected and actual strings.
+// If the strings are equal, diff returns an empty string.
+func diff(expected, actual string) string {
+	if expected == actual {
+		return ""
+	}
+	s, err := difflib.GetUnifiedDiffString(difflib.UnifiedDiff{
+		A:        difflib.SplitLines(expected + "\n"),
+		B:        difflib.SplitLines(actual + "\n"),
+		FromFile: "Expected",
+		ToFile:   "Actual",
+		Context:  1,
+	})
+	if err != nil {
+		return ""
+	}
+	return s
+}
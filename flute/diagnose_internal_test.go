@@ -0,0 +1,183 @@
+package flute
+
+import (
+	"io"
+	"net/http"
+	"net/url"
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/require"
+)
+
+func Test_makeCandidatesMsg(t *testing.T) { //nolint:funlen
+	data := []struct {
+		title    string
+		req      *http.Request
+		services []Service
+		exp      string
+	}{
+		{
+			title: "no route",
+			req: &http.Request{
+				URL: &url.URL{},
+			},
+		},
+		{
+			title: "normal",
+			req: &http.Request{
+				URL: &url.URL{
+					Scheme:   "http",
+					Host:     "example.com",
+					Path:     "/users",
+					RawQuery: "id=11",
+				},
+				Method: http.MethodPost,
+				Body:   io.NopCloser(strings.NewReader(`{"name": "foo", "age": 10}`)),
+				Header: http.Header{
+					"Authorization": []string{"token XXXXX"},
+				},
+			},
+			services: []Service{
+				{
+					Endpoint: "http://example.org",
+					Routes: []Route{
+						{
+							Name: "create a user in another service",
+							Matcher: Matcher{
+								Method: http.MethodPost,
+								Path:   "/users",
+							},
+						},
+					},
+				},
+				{
+					Endpoint: "http://example.com",
+					Routes: []Route{
+						{
+							Name: "get a user",
+							Matcher: Matcher{
+								Method: http.MethodGet,
+								Path:   "/user",
+								PartOfQuery: url.Values{
+									"id": []string{"10"},
+								},
+							},
+						},
+						{
+							Name: "create a user",
+							Matcher: Matcher{
+								Method:         http.MethodPost,
+								Path:           "/users",
+								BodyJSONString: `{"name": "foo", "age": 20}`,
+								PartOfHeader: http.Header{
+									"Authorization": nil,
+									"Content-Type":  nil,
+								},
+							},
+						},
+						{
+							Name: "custom",
+							Matcher: Matcher{
+								Match: func(req *http.Request) (bool, error) {
+									return false, nil
+								},
+							},
+						},
+						{
+							Name: "never shown",
+							Matcher: Matcher{
+								Method: http.MethodDelete,
+								Path:   "/groups",
+							},
+						},
+					},
+				},
+			},
+			exp: `closest routes:
+1. service: http://example.com, route: create a user (passed 3 of 5 conditions)
+  body:
+    expected: "{\"name\": \"foo\", \"age\": 20}"
+    actual:   "{\"name\": \"foo\", \"age\": 10}"
+    diff:
+      --- Expected
+      +++ Actual
+      @@ -1,3 +1,3 @@
+       {
+      -  "age": 20,
+      +  "age": 10,
+         "name": "foo"
+  header "Content-Type":
+    expected: present
+    actual:   missing
+2. service: http://example.org, route: create a user in another service (passed 2 of 3 conditions)
+  endpoint:
+    expected: http://example.org
+    actual:   http://example.com
+3. service: http://example.com, route: get a user (passed 1 of 4 conditions)
+  path:
+    expected: "/user"
+    actual:   "/users"
+  method:
+    expected: "GET"
+    actual:   "POST"
+  query "id":
+    expected: ["10"]
+    actual:   ["11"]`,
+		},
+	}
+
+	for _, d := range data {
+		d := d
+		t.Run(d.title, func(t *testing.T) {
+			require.Equal(t, d.exp, makeCandidatesMsg(d.req, d.services))
+		})
+	}
+}
+
+func Test_explainValues(t *testing.T) {
+	data := []struct {
+		title    string
+		expected http.Header
+		actual   http.Header
+		exp      mismatch
+	}{
+		{
+			title:    "value differs",
+			expected: http.Header{"Authorization": []string{"token XXXXX"}, "Accept": []string{"application/json"}},
+			actual:   http.Header{"Authorization": []string{"token YYYYY"}, "Accept": []string{"application/json"}},
+			exp: mismatch{
+				condition: `header "Authorization"`,
+				expected:  `["token XXXXX"]`,
+				actual:    `["token YYYYY"]`,
+			},
+		},
+		{
+			title:    "missing",
+			expected: http.Header{"Authorization": []string{"token XXXXX"}},
+			actual:   http.Header{},
+			exp: mismatch{
+				condition: `header "Authorization"`,
+				expected:  `["token XXXXX"]`,
+				actual:    "missing",
+			},
+		},
+		{
+			title:    "extra",
+			expected: http.Header{"Authorization": []string{"token XXXXX"}},
+			actual:   http.Header{"Authorization": []string{"token XXXXX"}, "Accept": []string{"application/json"}},
+			exp: mismatch{
+				condition: `header "Accept"`,
+				expected:  "absent",
+				actual:    `["application/json"]`,
+			},
+		},
+	}
+
+	for _, d := range data {
+		d := d
+		t.Run(d.title, func(t *testing.T) {
+			require.Equal(t, d.exp, explainHeader(&http.Request{Header: d.actual}, Matcher{Header: d.expected}))
+		})
+	}
+}
@@ -0,0 +1,158 @@
+package flute
+
+import (
+	"bytes"
+	"compress/flate"
+	"compress/gzip"
+	"compress/zlib"
+	"context"
+	"fmt"
+	"io"
+	"net/http"
+	"strings"
+
+	"github.com/andybalholm/brotli"
+	"github.com/klauspost/compress/zstd"
+)
+
+// ContentDecoder decodes the request body encoded with Content-Encoding.
+// gzip, deflate, br, and zstd are built in.
+type ContentDecoder func(r io.Reader) (io.Reader, error)
+
+// defaultContentDecoders returns the built-in decoders by the content coding.
+func defaultContentDecoders() map[string]ContentDecoder {
+	return map[string]ContentDecoder{
+		"gzip":   decodeGzip,
+		"x-gzip": decodeGzip,
+		"deflate": func(r io.Reader) (io.Reader, error) {
+			// "deflate" should be the zlib format, but some clients send the raw deflate stream.
+			b, err := io.ReadAll(r)
+			if err != nil {
+				return nil, err
+			}
+			if zr, err := zlib.NewReader(bytes.NewReader(b)); err == nil {
+				return zr, nil
+			}
+			return flate.NewReader(bytes.NewReader(b)), nil
+		},
+		"br": func(r io.Reader) (io.Reader, error) {
+			return brotli.NewReader(r), nil
+		},
+		"zstd": decodeZstd,
+	}
+}
+
+func decodeGzip(r io.Reader) (io.Reader, error) {
+	return gzip.NewReader(r)
+}
+
+// decodeZstd returns the reader which decodes the zstd stream.
+// The reader is an io.Closer, which releases the decoder when the body is read.
+func decodeZstd(r io.Reader) (io.Reader, error) {
+	d, err := zstd.NewReader(r, zstd.WithDecoderConcurrency(1))
+	if err != nil {
+		return nil, err
+	}
+	return d.IOReadCloser(), nil
+}
+
+// contentEncodings returns the content codings of the request in the order they were applied.
+// "identity" is ignored.
+func contentEncodings(header http.Header) []string {
+	var encodings []string
+	for _, v := range header.Values("Content-Encoding") {
+		for _, e := range strings.Split(v, ",") {
+			e = strings.ToLower(strings.TrimSpace(e))
+			if e == "" || e == "identity" {
+				continue
+			}
+			encodings = append(encodings, e)
+		}
+	}
+	return encodings
+}
+
+// decodeBody decodes the body according to the content codings.
+// decoders are used in addition to the built-in decoders, and take precedence over them.
+// The content codings are case-insensitive, so the keys of decoders are compared in lower case.
+func decodeBody(encodings []string, body []byte, decoders map[string]ContentDecoder) ([]byte, error) {
+	if len(encodings) == 0 || body == nil {
+		return body, nil
+	}
+	lookup := defaultContentDecoders()
+	for e, decode := range decoders {
+		lookup[strings.ToLower(e)] = decode
+	}
+	// the codings are decoded in the reverse order they were applied
+	for i := len(encodings) - 1; i >= 0; i-- {
+		e := encodings[i]
+		decode, ok := lookup[e]
+		if !ok {
+			return nil, fmt.Errorf("unsupported Content-Encoding %q", e)
+		}
+		r, err := decode(bytes.NewReader(body))
+		if err != nil {
+			return nil, fmt.Errorf("failed to decode the request body with %q: %w", e, err)
+		}
+		b, err := io.ReadAll(r)
+		if err != nil {
+			return nil, fmt.Errorf("failed to decode the request body with %q: %w", e, err)
+		}
+		if c, ok := r.(io.Closer); ok {
+			c.Close()
+		}
+		body = b
+	}
+	return body, nil
+}
+
+type contentEncodingKey struct{}
+
+// contentDecoding is the result of decoding the request body.
+type contentDecoding struct {
+	encodings []string
+	err       error
+}
+
+// decodeRequestBody decodes the request body according to Content-Encoding.
+// If the body can't be decoded, decodeRequestBody returns the body as it is and the error.
+// The result is stored in the context of the returned request for Tester.ContentEncoding.
+func (transport Transport) decodeRequestBody(req *http.Request, body []byte) (*http.Request, []byte, error) {
+	encodings := contentEncodings(req.Header)
+	if len(encodings) == 0 {
+		return req, body, nil
+	}
+	decoded, err := decodeBody(encodings, body, transport.ContentDecoders)
+	req = req.WithContext(context.WithValue(req.Context(), contentEncodingKey{}, contentDecoding{
+		encodings: encodings,
+		err:       err,
+	}))
+	if err != nil {
+		return req, body, err
+	}
+	return req, decoded, nil
+}
+
+// requestContentDecoding returns the result of decoding the request body.
+func requestContentDecoding(req *http.Request) contentDecoding {
+	if d, ok := req.Context().Value(contentEncodingKey{}).(contentDecoding); ok {
+		return d
+	}
+	return contentDecoding{encodings: contentEncodings(req.Header)}
+}
+
+type rawBodyKey struct{}
+
+// withRawBody returns the shallow copy of the request which has the body as it was sent in the context.
+func withRawBody(req *http.Request, body []byte) *http.Request {
+	return req.WithContext(context.WithValue(req.Context(), rawBodyKey{}, body))
+}
+
+// rawBody returns the request body as it was sent before Content-Encoding is decoded.
+// If RoundTrip doesn't record the body, rawBody returns the current body of the request.
+func rawBody(req *http.Request) ([]byte, error) {
+	if b, ok := req.Context().Value(rawBodyKey{}).([]byte); ok {
+		return b, nil
+	}
+	return readBody(req)
+}
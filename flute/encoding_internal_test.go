@@ -0,0 +1,151 @@
+package flute
+
+import (
+	"bytes"
+	"compress/flate"
+	"compress/gzip"
+	"compress/zlib"
+	"io"
+	"net/http"
+	"testing"
+
+	"github.com/andybalholm/brotli"
+	"github.com/klauspost/compress/zstd"
+	"github.com/stretchr/testify/require"
+)
+
+func compress(t *testing.T, encoding string, body []byte) []byte {
+	t.Helper()
+	buf := &bytes.Buffer{}
+	var w io.WriteCloser
+	switch encoding {
+	case "gzip":
+		w = gzip.NewWriter(buf)
+	case "deflate":
+		w = zlib.NewWriter(buf)
+	case "raw deflate":
+		fw, err := flate.NewWriter(buf, flate.DefaultCompression)
+		require.NoError(t, err)
+		w = fw
+	case "br":
+		w = brotli.NewWriter(buf)
+	case "zstd":
+		zw, err := zstd.NewWriter(buf)
+		require.NoError(t, err)
+		w = zw
+	default:
+		t.Fatalf("unknown encoding: %s", encoding)
+	}
+	_, err := w.Write(body)
+	require.NoError(t, err)
+	require.NoError(t, w.Close())
+	return buf.Bytes()
+}
+
+func Test_decodeBody(t *testing.T) { //nolint:funlen
+	body := []byte(`{"name": "foo"}`)
+	reverse := func(r io.Reader) (io.Reader, error) {
+		b, err := io.ReadAll(r)
+		if err != nil {
+			return nil, err
+		}
+		for i, j := 0, len(b)-1; i < j; i, j = i+1, j-1 {
+			b[i], b[j] = b[j], b[i]
+		}
+		return bytes.NewReader(b), nil
+	}
+	data := []struct {
+		title     string
+		header    string
+		body      []byte
+		decoders  map[string]ContentDecoder
+		isErr     bool
+		encodings []string
+	}{
+		{
+			title:     "gzip",
+			header:    "gzip",
+			body:      compress(t, "gzip", body),
+			encodings: []string{"gzip"},
+		},
+		{
+			title:     "deflate",
+			header:    "deflate",
+			body:      compress(t, "deflate", body),
+			encodings: []string{"deflate"},
+		},
+		{
+			title:     "raw deflate",
+			header:    "deflate",
+			body:      compress(t, "raw deflate", body),
+			encodings: []string{"deflate"},
+		},
+		{
+			title:     "br",
+			header:    "BR",
+			body:      compress(t, "br", body),
+			encodings: []string{"br"},
+		},
+		{
+			title:     "zstd",
+			header:    "zstd",
+			body:      compress(t, "zstd", body),
+			encodings: []string{"zstd"},
+		},
+		{
+			title:     "multiple codings",
+			header:    "gzip, identity, br",
+			body:      compress(t, "br", compress(t, "gzip", body)),
+			encodings: []string{"gzip", "br"},
+		},
+		{
+			title:  "custom decoder",
+			header: "reverse",
+			body:   []byte(`}"oof" :"eman"{`),
+			decoders: map[string]ContentDecoder{
+				"reverse": reverse,
+			},
+			encodings: []string{"reverse"},
+		},
+		{
+			title:  "custom decoder registered in mixed case",
+			header: "x-reverse",
+			body:   []byte(`}"oof" :"eman"{`),
+			decoders: map[string]ContentDecoder{
+				"X-Reverse": reverse,
+			},
+			encodings: []string{"x-reverse"},
+		},
+		{
+			title:     "not compressed",
+			header:    "gzip",
+			body:      body,
+			isErr:     true,
+			encodings: []string{"gzip"},
+		},
+		{
+			title:     "unsupported coding",
+			header:    "compress",
+			body:      body,
+			isErr:     true,
+			encodings: []string{"compress"},
+		},
+	}
+
+	for _, d := range data {
+		d := d
+		t.Run(d.title, func(t *testing.T) {
+			header := http.Header{}
+			header.Set("Content-Encoding", d.header)
+			encodings := contentEncodings(header)
+			require.Equal(t, d.encodings, encodings)
+			b, err := decodeBody(encodings, d.body, d.decoders)
+			if d.isErr {
+				require.Error(t, err)
+				return
+			}
+			require.NoError(t, err)
+			require.Equal(t, string(body), string(b))
+		})
+	}
+}
@@ -0,0 +1,206 @@
+package flute
+
+import (
+	"context"
+	"fmt"
+	"net/http"
+	"net/url"
+	"strings"
+	"sync"
+)
+
+// endpoint is a parsed service endpoint.
+type endpoint struct {
+	scheme string
+	// host is the lower case host name without the port.
+	host string
+	// port is the port number. If the endpoint doesn't have the port, port is the default port of the scheme.
+	port string
+	// basePath is the path prefix of the endpoint without the trailing slash.
+	basePath string
+	// escapedBasePath is the escaped form of basePath.
+	escapedBasePath string
+}
+
+// defaultPort returns the default port of the scheme.
+func defaultPort(scheme string) string {
+	switch scheme {
+	case "http":
+		return "80"
+	case "https":
+		return "443"
+	}
+	return ""
+}
+
+// normalizePort returns the port of the URL, or the default port of the scheme if the URL doesn't have the port.
+func normalizePort(u *url.URL) string {
+	if port := u.Port(); port != "" {
+		return port
+	}
+	return defaultPort(strings.ToLower(u.Scheme))
+}
+
+// parseEndpoint parses the service endpoint.
+func parseEndpoint(s string) (endpoint, error) {
+	u, err := url.Parse(s)
+	if err != nil {
+		return endpoint{}, fmt.Errorf("parse the endpoint %q: %w", s, err)
+	}
+	if u.Scheme == "" || u.Host == "" {
+		return endpoint{}, fmt.Errorf(`the endpoint %q should be "scheme://host"`, s)
+	}
+	if u.RawQuery != "" || u.Fragment != "" {
+		return endpoint{}, fmt.Errorf("the endpoint %q shouldn't have the query and fragment", s)
+	}
+	return endpoint{
+		scheme:          strings.ToLower(u.Scheme),
+		host:            strings.ToLower(u.Hostname()),
+		port:            normalizePort(u),
+		basePath:        strings.TrimSuffix(u.Path, "/"),
+		escapedBasePath: strings.TrimSuffix(u.EscapedPath(), "/"),
+	}, nil
+}
+
+// parsedEndpoint is the result of parseEndpoint cached in parsedEndpoints.
+type parsedEndpoint struct {
+	endpoint endpoint
+	err      error
+}
+
+// parsedEndpoints caches the parsed endpoints by the endpoint string,
+// so the endpoints of the services aren't parsed every time the request is sent.
+var parsedEndpoints sync.Map //nolint:gochecknoglobals
+
+// loadEndpoint returns the parsed service endpoint.
+func loadEndpoint(s string) (endpoint, error) {
+	if v, ok := parsedEndpoints.Load(s); ok {
+		parsed := v.(parsedEndpoint) //nolint:forcetypeassert
+		return parsed.endpoint, parsed.err
+	}
+	ep, err := parseEndpoint(s)
+	parsedEndpoints.Store(s, parsedEndpoint{endpoint: ep, err: err})
+	return ep, err
+}
+
+// matchHost returns whether the host matches the host of the endpoint.
+// The label "*" matches any single label, and the host "*" matches any host.
+func (ep endpoint) matchHost(host string) bool {
+	host = strings.ToLower(host)
+	if ep.host == "*" {
+		return host != ""
+	}
+	if !strings.Contains(ep.host, "*") {
+		return ep.host == host
+	}
+	patterns := strings.Split(ep.host, ".")
+	labels := strings.Split(host, ".")
+	if len(patterns) != len(labels) {
+		return false
+	}
+	for i, p := range patterns {
+		if p == "*" {
+			if labels[i] == "" {
+				return false
+			}
+			continue
+		}
+		if p != labels[i] {
+			return false
+		}
+	}
+	return true
+}
+
+// match returns whether the request URL is under the endpoint.
+func (ep endpoint) match(u *url.URL) bool {
+	if strings.ToLower(u.Scheme) != ep.scheme || normalizePort(u) != ep.port {
+		return false
+	}
+	if !ep.matchHost(u.Hostname()) {
+		return false
+	}
+	if ep.basePath == "" {
+		return true
+	}
+	return u.Path == ep.basePath || strings.HasPrefix(u.Path, ep.basePath+"/")
+}
+
+// relativeRequest returns the shallow copy of the request whose path is relative to the base path of the endpoint.
+// If the endpoint doesn't have the base path, relativeRequest returns the request as it is.
+func (ep endpoint) relativeRequest(req *http.Request) *http.Request {
+	if ep.basePath == "" {
+		return req
+	}
+	u := *req.URL
+	u.Path = strings.TrimPrefix(u.Path, ep.basePath)
+	if u.Path == "" {
+		u.Path = "/"
+	}
+	if u.RawPath != "" {
+		u.RawPath = strings.TrimPrefix(u.RawPath, ep.escapedBasePath)
+		if u.RawPath == "" {
+			u.RawPath = "/"
+		}
+	}
+	r := req.WithContext(context.WithValue(req.Context(), originalURLKey{}, req.URL))
+	r.URL = &u
+	return r
+}
+
+type originalURLKey struct{}
+
+// originalURL returns the URL which the client sent.
+// The path of the request given to the matcher and tester is relative to the base path of the service endpoint,
+// but the request signature such as AWS SigV4 is calculated with the original path.
+func originalURL(req *http.Request) *url.URL {
+	if u, ok := req.Context().Value(originalURLKey{}).(*url.URL); ok {
+		return u
+	}
+	return req.URL
+}
+
+// withOriginalURL returns the shallow copy of the request whose URL is the URL which the client sent.
+// The context such as the values of the path wildcards is kept.
+// If the URL isn't changed by relativeRequest, withOriginalURL returns the request as it is.
+func withOriginalURL(req *http.Request) *http.Request {
+	u := originalURL(req)
+	if u == req.URL {
+		return req
+	}
+	r := *req
+	r.URL = u
+	return &r
+}
+
+// endpoints returns all endpoints of the service.
+func (service Service) endpoints() []string {
+	if service.Endpoint == "" {
+		return service.Endpoints
+	}
+	return append([]string{service.Endpoint}, service.Endpoints...)
+}
+
+// matchService returns the endpoint of the service which the request is sent to.
+// If the service has HostMatcher, the host of the request must also match HostMatcher.
+// The invalid endpoints are skipped and the remaining endpoints are still checked.
+// The error of the first invalid endpoint is returned even if another endpoint matches the request.
+func matchService(req *http.Request, service Service) (endpoint, bool, error) {
+	if service.HostMatcher != nil && !service.HostMatcher.MatchValue(strings.ToLower(req.URL.Hostname())) {
+		return endpoint{}, false, nil
+	}
+	var firstErr error
+	for _, s := range service.endpoints() {
+		ep, err := loadEndpoint(s)
+		if err != nil {
+			if firstErr == nil {
+				firstErr = err
+			}
+			continue
+		}
+		if ep.match(req.URL) {
+			return ep, true, firstErr
+		}
+	}
+	return endpoint{}, false, firstErr
+}
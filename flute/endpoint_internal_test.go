@@ -0,0 +1,60 @@
+package flute
+
+import (
+	"net/http"
+	"net/url"
+	"testing"
+
+	"github.com/stretchr/testify/require"
+)
+
+func Test_endpointRelativeRequest(t *testing.T) {
+	data := []struct {
+		title    string
+		endpoint string
+		url      string
+		path     string
+		rawPath  string
+	}{
+		{
+			title:    "no base path",
+			endpoint: "https://example.com",
+			url:      "https://example.com/users",
+			path:     "/users",
+		},
+		{
+			title:    "base path",
+			endpoint: "https://example.com/api/v2",
+			url:      "https://example.com/api/v2/users/10",
+			path:     "/users/10",
+		},
+		{
+			title:    "base path itself",
+			endpoint: "https://example.com/api/v2",
+			url:      "https://example.com/api/v2",
+			path:     "/",
+		},
+		{
+			title:    "escaped path",
+			endpoint: "https://example.com/api/v2",
+			url:      "https://example.com/api/v2/files/a%2Fb",
+			path:     "/files/a/b",
+			rawPath:  "/files/a%2Fb",
+		},
+	}
+
+	for _, d := range data {
+		d := d
+		t.Run(d.title, func(t *testing.T) {
+			ep, err := parseEndpoint(d.endpoint)
+			require.NoError(t, err)
+			u, err := url.Parse(d.url)
+			require.NoError(t, err)
+			req := &http.Request{URL: u}
+			r := ep.relativeRequest(req)
+			require.Equal(t, d.path, r.URL.Path)
+			require.Equal(t, d.rawPath, r.URL.RawPath)
+			require.Equal(t, d.url, req.URL.String(), "the original request shouldn't be changed")
+		})
+	}
+}
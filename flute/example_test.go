@@ -14,7 +14,7 @@ import (
 func Example_simpleMock() {
 	http.DefaultClient = &http.Client{
 		Transport: flute.Transport{
-			// if *testing.T isn't given, the transport is a just mock and doesn't run the test.
+			// if T isn't given, the transport is a just mock and doesn't run the test.
 			// T: t,
 			Services: []flute.Service{
 				{
@@ -0,0 +1,129 @@
+package flute
+
+import (
+	"fmt"
+	"sync"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+// Expectation is the expected number of times a route is called.
+// Expectation counts the calls, so an Expectation shouldn't be shared by multiple routes.
+// Use Times, AtLeast, AtMost, or Never to create an Expectation.
+type Expectation struct {
+	min   int
+	max   int // a negative value means there is no upper limit
+	count int
+	mutex sync.Mutex
+}
+
+// Times returns the expectation that the route is called exactly n times.
+func Times(n int) *Expectation {
+	return &Expectation{min: n, max: n}
+}
+
+// Once returns the expectation that the route is called exactly once.
+func Once() *Expectation {
+	return Times(1)
+}
+
+// AtLeast returns the expectation that the route is called at least n times.
+func AtLeast(n int) *Expectation {
+	return &Expectation{min: n, max: -1}
+}
+
+// AtMost returns the expectation that the route is called at most n times.
+func AtMost(n int) *Expectation {
+	return &Expectation{min: 0, max: n}
+}
+
+// Never returns the expectation that the route is never called.
+func Never() *Expectation {
+	return Times(0)
+}
+
+// Count returns the number of times the route has been called.
+func (exp *Expectation) Count() int {
+	exp.mutex.Lock()
+	defer exp.mutex.Unlock()
+	return exp.count
+}
+
+// Reset resets the number of calls to zero.
+func (exp *Expectation) Reset() {
+	exp.mutex.Lock()
+	exp.count = 0
+	exp.mutex.Unlock()
+}
+
+// String returns the description of the expectation such as "exactly 1 time".
+func (exp *Expectation) String() string {
+	switch {
+	case exp.min == exp.max:
+		return "exactly " + formatTimes(exp.min)
+	case exp.max < 0:
+		return "at least " + formatTimes(exp.min)
+	default:
+		return "at most " + formatTimes(exp.max)
+	}
+}
+
+func (exp *Expectation) called() {
+	exp.mutex.Lock()
+	exp.count++
+	exp.mutex.Unlock()
+}
+
+// isSatisfied returns whether the number of calls meets the expectation and the number of calls.
+func (exp *Expectation) isSatisfied() (bool, int) {
+	exp.mutex.Lock()
+	defer exp.mutex.Unlock()
+	if exp.count < exp.min {
+		return false, exp.count
+	}
+	if exp.max >= 0 && exp.count > exp.max {
+		return false, exp.count
+	}
+	return true, exp.count
+}
+
+func formatTimes(n int) string {
+	if n == 1 {
+		return "1 time"
+	}
+	return fmt.Sprintf("%d times", n)
+}
+
+// Verify checks that every route's expectation is met and every order is finished.
+// If an expectation isn't met or some routes of an order aren't called, Verify reports it with t.
+func (transport Transport) Verify(t testing.TB) {
+	for _, service := range transport.Services {
+		for _, route := range service.Routes {
+			verifyExpectation(t, service, route)
+		}
+	}
+	transport.verifyOrders(t)
+}
+
+// VerifyAtCleanup registers Verify with t.Cleanup,
+// so the expectations are verified when the test ends.
+// VerifyAtCleanup verifies the copy of the transport taken when VerifyAtCleanup is called,
+// so the services and orders should be set before VerifyAtCleanup is called.
+func (transport Transport) VerifyAtCleanup(t testing.TB) {
+	t.Cleanup(func() {
+		transport.Verify(t)
+	})
+}
+
+func verifyExpectation(t testing.TB, service Service, route Route) {
+	if route.Expect == nil {
+		return
+	}
+	if ok, count := route.Expect.isSatisfied(); !ok {
+		assert.Fail(
+			t, makeMsg(
+				fmt.Sprintf("the route should be called %s, but it was called %s", route.Expect, formatTimes(count)),
+				service.Endpoint, route.Name))
+	}
+}
@@ -0,0 +1,109 @@
+package flute
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/require"
+)
+
+func TestExpectation_String(t *testing.T) {
+	data := []struct {
+		title string
+		exp   *Expectation
+		s     string
+	}{
+		{
+			title: "times",
+			exp:   Times(2),
+			s:     "exactly 2 times",
+		},
+		{
+			title: "once",
+			exp:   Once(),
+			s:     "exactly 1 time",
+		},
+		{
+			title: "at least",
+			exp:   AtLeast(1),
+			s:     "at least 1 time",
+		},
+		{
+			title: "at most",
+			exp:   AtMost(3),
+			s:     "at most 3 times",
+		},
+		{
+			title: "never",
+			exp:   Never(),
+			s:     "exactly 0 times",
+		},
+	}
+
+	for _, d := range data {
+		d := d
+		t.Run(d.title, func(t *testing.T) {
+			require.Equal(t, d.s, d.exp.String())
+		})
+	}
+}
+
+func TestExpectation_isSatisfied(t *testing.T) {
+	data := []struct {
+		title string
+		exp   *Expectation
+		count int
+		ok    bool
+	}{
+		{
+			title: "exactly once",
+			exp:   Once(),
+			count: 1,
+			ok:    true,
+		},
+		{
+			title: "called twice but expected once",
+			exp:   Once(),
+			count: 2,
+		},
+		{
+			title: "not called but expected at least once",
+			exp:   AtLeast(1),
+		},
+		{
+			title: "called many times and expected at least once",
+			exp:   AtLeast(1),
+			count: 5,
+			ok:    true,
+		},
+		{
+			title: "called more than at most",
+			exp:   AtMost(2),
+			count: 3,
+		},
+		{
+			title: "never called",
+			exp:   Never(),
+			ok:    true,
+		},
+		{
+			title: "called but expected never",
+			exp:   Never(),
+			count: 1,
+		},
+	}
+
+	for _, d := range data {
+		d := d
+		t.Run(d.title, func(t *testing.T) {
+			for i := 0; i < d.count; i++ {
+				d.exp.called()
+			}
+			ok, count := d.exp.isSatisfied()
+			require.Equal(t, d.ok, ok)
+			require.Equal(t, d.count, count)
+			require.Equal(t, d.count, d.exp.Count())
+			d.exp.Reset()
+			require.Equal(t, 0, d.exp.Count())
+		})
+	}
+}
@@ -0,0 +1,4 @@
+package flute
+
+// NewFakeTB exposes newFakeTB to the external tests.
+var NewFakeTB = newFakeTB //nolint:gochecknoglobals
@@ -0,0 +1,157 @@
+package flute
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"reflect"
+	"strings"
+
+	"github.com/jmespath/go-jmespath"
+)
+
+// JSONExpr is an assertion on the JSON request body with a JMESPath expression.
+// For example, JSONExpr{Expr: "length(items) == `3`"} and JSONExpr{Expr: "items[*].sku", Contains: "ABC"}.
+// The JSONPath style root "$" such as "$.items[*].sku" is also accepted for simple paths.
+//
+// If both Expected and Contains are nil, the result of Expr must be true.
+type JSONExpr struct {
+	// Expr is a JMESPath expression. See https://jmespath.org .
+	Expr string
+	// If Expected isn't nil, Expected is compared to the result of Expr as JSON.
+	Expected interface{}
+	// If Contains isn't nil, the result of Expr must be an array which has an element containing Contains
+	// in the same way as Matcher.PartOfBodyJSON, or a string which contains Contains as a substring.
+	Contains interface{}
+}
+
+func (e JSONExpr) String() string {
+	switch {
+	case e.Expected != nil:
+		return fmt.Sprintf("%s == %s", e.Expr, compactJSON(e.Expected))
+	case e.Contains != nil:
+		return fmt.Sprintf("%s contains %s", e.Expr, compactJSON(e.Contains))
+	}
+	return e.Expr
+}
+
+// jmespathExpr converts the JSONPath style root to the JMESPath expression.
+func jmespathExpr(expr string) string {
+	if expr == "$" {
+		return "@"
+	}
+	if strings.HasPrefix(expr, "$.") {
+		return expr[2:]
+	}
+	if strings.HasPrefix(expr, "$[") {
+		return expr[1:]
+	}
+	return expr
+}
+
+// normalizeJSON converts the Go value to the value decoded from JSON,
+// so that 3 and 3.0 are compared as the same number.
+func normalizeJSON(v interface{}) (interface{}, error) {
+	b, err := json.Marshal(v)
+	if err != nil {
+		return nil, err
+	}
+	var a interface{}
+	if err := json.Unmarshal(b, &a); err != nil {
+		return nil, err
+	}
+	return a, nil
+}
+
+// jsonExprFailure is the expression which the request body doesn't meet.
+type jsonExprFailure struct {
+	expr JSONExpr
+	// actual is the result of the expression as JSON, or the reason of the failure.
+	actual string
+}
+
+// evaluate evaluates the expression against the decoded body.
+// If the body meets the expression, evaluate returns nil.
+// If the expression is invalid, evaluate returns an error.
+func (e JSONExpr) evaluate(body interface{}) (*jsonExprFailure, error) {
+	result, err := jmespath.Search(jmespathExpr(e.Expr), body)
+	if err != nil {
+		return nil, fmt.Errorf("failed to evaluate the expression %q: %w", e.Expr, err)
+	}
+	if e.meets(result) {
+		return nil, nil
+	}
+	return &jsonExprFailure{expr: e, actual: compactJSON(result)}, nil
+}
+
+func (e JSONExpr) meets(result interface{}) bool {
+	if e.Expected == nil && e.Contains == nil {
+		b, ok := result.(bool)
+		return ok && b
+	}
+	if e.Expected != nil {
+		exp, err := normalizeJSON(e.Expected)
+		if err != nil || !reflect.DeepEqual(exp, result) {
+			return false
+		}
+	}
+	if e.Contains != nil {
+		return containsValue(e.Contains, result)
+	}
+	return true
+}
+
+// containsValue returns whether the array has an element containing v, or the string contains v.
+func containsValue(v, result interface{}) bool {
+	switch a := result.(type) {
+	case []interface{}:
+		exp, err := normalizeJSON(v)
+		if err != nil {
+			return false
+		}
+		for _, elem := range a {
+			if containsJSON(exp, elem, "$", JSONArrayContains) == nil {
+				return true
+			}
+		}
+		return false
+	case string:
+		s, ok := v.(string)
+		return ok && strings.Contains(a, s)
+	}
+	return false
+}
+
+// findJSONExprFailures parses the request body once and returns the expressions which the body doesn't meet.
+func findJSONExprFailures(req *http.Request, exprs []JSONExpr) ([]jsonExprFailure, error) {
+	if req.Body == nil {
+		failures := make([]jsonExprFailure, len(exprs))
+		for i, e := range exprs {
+			failures[i] = jsonExprFailure{expr: e, actual: "no body"}
+		}
+		return failures, nil
+	}
+	b, err := readBody(req)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read the request body: %w", err)
+	}
+	var body interface{}
+	if err := json.Unmarshal(b, &body); err != nil {
+		failures := make([]jsonExprFailure, len(exprs))
+		for i, e := range exprs {
+			failures[i] = jsonExprFailure{expr: e, actual: fmt.Sprintf("invalid JSON: %v", err)}
+		}
+		return failures, nil
+	}
+	var failures []jsonExprFailure
+	for _, e := range exprs {
+		f, err := e.evaluate(body)
+		if err != nil {
+			return nil, err
+		}
+		if f != nil {
+			failures = append(failures, *f)
+		}
+	}
+	return failures, nil
+}
@@ -0,0 +1,102 @@
+package flute
+
+import (
+	"io"
+	"net/http"
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/require"
+)
+
+func Test_findJSONExprFailures(t *testing.T) { //nolint:funlen
+	body := `{"items": [{"sku": "ABC", "qty": 1}, {"sku": "DEF", "qty": 2}], "note": "deliver in the morning"}`
+	data := []struct {
+		title  string
+		body   string
+		exprs  []JSONExpr
+		isErr  bool
+		actual []string
+	}{
+		{
+			title: "all expressions are met",
+			body:  body,
+			exprs: []JSONExpr{
+				{Expr: "length(items) == `2`"},
+				{Expr: "$.items[*].sku", Contains: "ABC"},
+				{Expr: "items[*].sku", Expected: []string{"ABC", "DEF"}},
+				{Expr: "items[1].qty", Expected: 2},
+				{Expr: "items", Contains: map[string]interface{}{"sku": "DEF"}},
+				{Expr: "note", Contains: "morning"},
+			},
+		},
+		{
+			title: "failed expressions are reported with the actual values",
+			body:  body,
+			exprs: []JSONExpr{
+				{Expr: "length(items) == `3`"},
+				{Expr: "$.items[*].sku", Contains: "XYZ"},
+				{Expr: "items[0].qty", Expected: 1},
+				{Expr: "items[0].price", Expected: 100},
+			},
+			actual: []string{"false", `["ABC","DEF"]`, "null"},
+		},
+		{
+			title:  "body isn't JSON",
+			body:   "foo",
+			exprs:  []JSONExpr{{Expr: "items"}},
+			actual: []string{"invalid JSON: invalid character 'o' in literal false (expecting 'a')"},
+		},
+		{
+			title: "invalid expression",
+			body:  body,
+			exprs: []JSONExpr{{Expr: "items[?"}},
+			isErr: true,
+		},
+	}
+
+	for _, d := range data {
+		d := d
+		t.Run(d.title, func(t *testing.T) {
+			failures, err := findJSONExprFailures(&http.Request{
+				Body: io.NopCloser(strings.NewReader(d.body)),
+			}, d.exprs)
+			if d.isErr {
+				require.Error(t, err)
+				return
+			}
+			require.NoError(t, err)
+			actual := make([]string, len(failures))
+			for i, f := range failures {
+				actual[i] = f.actual
+			}
+			if len(d.actual) == 0 {
+				require.Empty(t, actual)
+				return
+			}
+			require.Equal(t, d.actual, actual)
+		})
+	}
+}
+
+func Test_testBodyJSONExprs(t *testing.T) {
+	tb := newFakeTB(t)
+	req := &http.Request{
+		Body: io.NopCloser(strings.NewReader(`{"items": [{"sku": "ABC"}]}`)),
+	}
+	testBodyJSONExprs(tb, req, Service{Endpoint: "http://example.com"}, Route{
+		Name: "create an order",
+		Tester: Tester{
+			BodyJSONExprs: []JSONExpr{
+				{Expr: "length(items) == `3`"},
+				{Expr: "items[*].sku", Contains: "DEF"},
+			},
+		},
+	})
+	errs := tb.Errors()
+	require.Len(t, errs, 2)
+	require.Contains(t, errs[0], "the request body should meet the expression: length(items) == `3`")
+	require.Contains(t, errs[0], "actual: false")
+	require.Contains(t, errs[1], `the request body should meet the expression: items[*].sku contains "DEF"`)
+	require.Contains(t, errs[1], `actual: ["ABC"]`)
+}
@@ -0,0 +1,48 @@
+package flute
+
+import (
+	"fmt"
+	"sync"
+	"testing"
+)
+
+// fakeTB is a testing.TB which records failures instead of failing the test.
+type fakeTB struct {
+	testing.TB
+	errors []string
+	mutex  sync.Mutex
+}
+
+func newFakeTB(t testing.TB) *fakeTB {
+	return &fakeTB{TB: t}
+}
+
+func (tb *fakeTB) Helper() {}
+
+func (tb *fakeTB) Errorf(format string, args ...interface{}) {
+	tb.mutex.Lock()
+	tb.errors = append(tb.errors, fmt.Sprintf(format, args...))
+	tb.mutex.Unlock()
+}
+
+func (tb *fakeTB) Error(args ...interface{}) {
+	tb.mutex.Lock()
+	tb.errors = append(tb.errors, fmt.Sprint(args...))
+	tb.mutex.Unlock()
+}
+
+func (tb *fakeTB) FailNow() {}
+
+func (tb *fakeTB) Fatalf(format string, args ...interface{}) {
+	tb.Errorf(format, args...)
+}
+
+func (tb *fakeTB) Logf(format string, args ...interface{}) {}
+
+func (tb *fakeTB) Errors() []string {
+	tb.mutex.Lock()
+	defer tb.mutex.Unlock()
+	errs := make([]string, len(tb.errors))
+	copy(errs, tb.errors)
+	return errs
+}
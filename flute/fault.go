@@ -0,0 +1,99 @@
+package flute
+
+import (
+	"context"
+	"errors"
+	"io"
+	"math/rand"
+	"net"
+	"os"
+	"syscall"
+	"time"
+)
+
+// Fault is the failure injected into the response.
+// The zero value injects no failure.
+type Fault struct {
+	// Delay is the time to wait before the response is returned.
+	// If the request's context is done while waiting, RoundTrip returns the context's error.
+	Delay time.Duration
+	// If MaxDelay is greater than Delay, the time to wait is chosen randomly between Delay and MaxDelay.
+	MaxDelay time.Duration
+	// If Err isn't nil, RoundTrip returns Err instead of the response.
+	// NewConnectionResetError and NewTimeoutError return errors which real transports return.
+	Err error
+	// If BreakBody is true, reading the response body fails with io.ErrUnexpectedEOF
+	// after BodyBytes bytes are read.
+	BreakBody bool
+	BodyBytes int
+}
+
+// NewConnectionResetError returns the error which a transport returns when the connection is reset by peer.
+// errors.Is(err, syscall.ECONNRESET) returns true.
+func NewConnectionResetError() error {
+	return &net.OpError{
+		Op:  "read",
+		Net: "tcp",
+		Err: os.NewSyscallError("read", syscall.ECONNRESET),
+	}
+}
+
+// NewTimeoutError returns the *net.OpError which times out.
+// The error's Timeout method returns true and errors.Is(err, os.ErrDeadlineExceeded) returns true.
+func NewTimeoutError() error {
+	return &net.OpError{
+		Op:  "read",
+		Net: "tcp",
+		Err: os.ErrDeadlineExceeded,
+	}
+}
+
+// delay returns the time to wait.
+func (fault Fault) delay() time.Duration {
+	if fault.MaxDelay <= fault.Delay {
+		return fault.Delay
+	}
+	return fault.Delay + time.Duration(rand.Int63n(int64(fault.MaxDelay-fault.Delay))) //nolint:gosec
+}
+
+// wait waits for the delay.
+// If the context is done before the delay elapses, wait returns the context's error.
+func (fault Fault) wait(ctx context.Context) error {
+	d := fault.delay()
+	if d <= 0 {
+		return nil
+	}
+	timer := time.NewTimer(d)
+	defer timer.Stop()
+	select {
+	case <-ctx.Done():
+		return ctx.Err()
+	case <-timer.C:
+		return nil
+	}
+}
+
+// brokenBody is the response body which fails with io.ErrUnexpectedEOF after some bytes are read.
+type brokenBody struct {
+	body      io.ReadCloser
+	remaining int
+}
+
+func (body *brokenBody) Read(p []byte) (int, error) {
+	if body.remaining <= 0 {
+		return 0, io.ErrUnexpectedEOF
+	}
+	if len(p) > body.remaining {
+		p = p[:body.remaining]
+	}
+	n, err := body.body.Read(p)
+	body.remaining -= n
+	if errors.Is(err, io.EOF) {
+		return n, io.ErrUnexpectedEOF
+	}
+	return n, err
+}
+
+func (body *brokenBody) Close() error {
+	return body.body.Close()
+}
@@ -0,0 +1,163 @@
+package flute
+
+import (
+	"context"
+	"errors"
+	"io"
+	"net"
+	"net/http"
+	"os"
+	"syscall"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/require"
+)
+
+func TestFault_delay(t *testing.T) {
+	data := []struct {
+		title string
+		fault Fault
+		min   time.Duration
+		max   time.Duration
+	}{
+		{
+			title: "no delay",
+		},
+		{
+			title: "fixed delay",
+			fault: Fault{
+				Delay: time.Second,
+			},
+			min: time.Second,
+			max: time.Second,
+		},
+		{
+			title: "random delay",
+			fault: Fault{
+				Delay:    time.Second,
+				MaxDelay: 2 * time.Second,
+			},
+			min: time.Second,
+			max: 2 * time.Second,
+		},
+	}
+
+	for _, d := range data {
+		d := d
+		t.Run(d.title, func(t *testing.T) {
+			for i := 0; i < 10; i++ {
+				delay := d.fault.delay()
+				require.GreaterOrEqual(t, delay, d.min)
+				require.LessOrEqual(t, delay, d.max)
+			}
+		})
+	}
+}
+
+func Test_createHTTPResponse_fault(t *testing.T) { //nolint:funlen
+	canceled, cancel := context.WithCancel(context.Background())
+	cancel()
+	data := []struct {
+		title string
+		ctx   context.Context //nolint:containedctx
+		resp  Response
+		err   error
+		body  string
+	}{
+		{
+			title: "delay",
+			ctx:   context.Background(),
+			resp: Response{
+				BodyString: "foo",
+				Fault: Fault{
+					Delay: time.Millisecond,
+				},
+			},
+			body: "foo",
+		},
+		{
+			title: "the context is canceled while waiting",
+			ctx:   canceled,
+			resp: Response{
+				Fault: Fault{
+					Delay: time.Hour,
+				},
+			},
+			err: context.Canceled,
+		},
+		{
+			title: "connection reset",
+			ctx:   context.Background(),
+			resp: Response{
+				Fault: Fault{
+					Err: NewConnectionResetError(),
+				},
+			},
+			err: syscall.ECONNRESET,
+		},
+		{
+			title: "timeout",
+			ctx:   context.Background(),
+			resp: Response{
+				Fault: Fault{
+					Err: NewTimeoutError(),
+				},
+			},
+			err: os.ErrDeadlineExceeded,
+		},
+		{
+			title: "broken body",
+			ctx:   context.Background(),
+			resp: Response{
+				BodyString: "hello world",
+				Fault: Fault{
+					BreakBody: true,
+					BodyBytes: 5,
+				},
+			},
+			err:  io.ErrUnexpectedEOF,
+			body: "hello",
+		},
+		{
+			title: "body is shorter than BodyBytes",
+			ctx:   context.Background(),
+			resp: Response{
+				BodyString: "foo",
+				Fault: Fault{
+					BreakBody: true,
+					BodyBytes: 5,
+				},
+			},
+			err:  io.ErrUnexpectedEOF,
+			body: "foo",
+		},
+	}
+
+	for _, d := range data {
+		d := d
+		t.Run(d.title, func(t *testing.T) {
+			req, err := http.NewRequestWithContext(d.ctx, http.MethodGet, "http://example.com", nil)
+			require.NoError(t, err)
+			resp, err := createHTTPResponse(req, d.resp)
+			if err != nil {
+				require.ErrorIs(t, err, d.err)
+				return
+			}
+			defer resp.Body.Close()
+			b, err := io.ReadAll(resp.Body)
+			require.Equal(t, d.body, string(b))
+			if d.err != nil {
+				require.ErrorIs(t, err, d.err)
+				return
+			}
+			require.NoError(t, err)
+		})
+	}
+}
+
+func TestNewTimeoutError(t *testing.T) {
+	var netErr net.Error
+	require.True(t, errors.As(NewTimeoutError(), &netErr))
+	require.True(t, netErr.Timeout())
+}
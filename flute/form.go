@@ -0,0 +1,49 @@
+package flute
+
+import (
+	"fmt"
+	"mime"
+	"net/http"
+	"net/url"
+)
+
+// readForm parses the request body as application/x-www-form-urlencoded.
+// If the request has no body, readForm returns nil.
+func readForm(req *http.Request) (url.Values, error) {
+	if req.Body == nil {
+		return nil, nil
+	}
+	b, err := readBody(req)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read the request body: %w", err)
+	}
+	form, err := url.ParseQuery(string(b))
+	if err != nil {
+		return nil, fmt.Errorf("failed to parse the request body as form: %w", err)
+	}
+	return form, nil
+}
+
+// matchableForm returns the request form for the matchers.
+// If the request isn't a form, matchableForm returns nil without an error so that the route simply doesn't match.
+// The request isn't a form if Content-Type is set and isn't application/x-www-form-urlencoded,
+// or the body can't be parsed as application/x-www-form-urlencoded.
+func matchableForm(req *http.Request) (url.Values, error) {
+	if req.Body == nil {
+		return nil, nil
+	}
+	if v := req.Header.Get("Content-Type"); v != "" {
+		if mediaType, _, err := mime.ParseMediaType(v); err != nil || mediaType != "application/x-www-form-urlencoded" {
+			return nil, nil
+		}
+	}
+	b, err := readBody(req)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read the request body: %w", err)
+	}
+	form, err := url.ParseQuery(string(b))
+	if err != nil {
+		return nil, nil //nolint:nilerr
+	}
+	return form, nil
+}
@@ -0,0 +1,167 @@
+package flute
+
+import (
+	"io"
+	"net/http"
+	"net/url"
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/require"
+)
+
+func Test_matchForm(t *testing.T) { //nolint:funlen
+	data := []struct {
+		title       string
+		body        string
+		contentType string
+		noBody      bool
+		matcher     Matcher
+		isErr       bool
+		exp         bool
+	}{
+		{
+			title: "form matches regardless of the order",
+			body:  "grant_type=client_credentials&client_id=foo&scope=read+write",
+			matcher: Matcher{
+				Form: url.Values{
+					"scope":      []string{"read write"},
+					"client_id":  []string{"foo"},
+					"grant_type": []string{"client_credentials"},
+				},
+			},
+			exp: true,
+		},
+		{
+			title: "form has the extra parameter",
+			body:  "grant_type=client_credentials&client_id=foo",
+			matcher: Matcher{
+				Form: url.Values{
+					"grant_type": []string{"client_credentials"},
+				},
+			},
+		},
+		{
+			title:  "no body",
+			noBody: true,
+			matcher: Matcher{
+				Form: url.Values{},
+			},
+		},
+		{
+			title: "part of form",
+			body:  "grant_type=client_credentials&client_id=foo&client_secret=bar",
+			matcher: Matcher{
+				PartOfForm: url.Values{
+					"grant_type":    []string{"client_credentials"},
+					"client_secret": nil,
+				},
+			},
+			exp: true,
+		},
+		{
+			title: "part of form doesn't have the key",
+			body:  "grant_type=client_credentials",
+			matcher: Matcher{
+				PartOfForm: url.Values{
+					"client_secret": nil,
+				},
+			},
+		},
+		{
+			title: "part of form value doesn't match",
+			body:  "grant_type=password",
+			matcher: Matcher{
+				PartOfForm: url.Values{
+					"grant_type": []string{"client_credentials"},
+				},
+			},
+		},
+		{
+			title: "invalid form doesn't match",
+			body:  "a=%zz",
+			matcher: Matcher{
+				PartOfForm: url.Values{
+					"a": nil,
+				},
+			},
+		},
+		{
+			title:       "JSON body doesn't match",
+			body:        `{"rate": "100%"}`,
+			contentType: "application/json",
+			matcher: Matcher{
+				Form: url.Values{
+					"rate": []string{"100%"},
+				},
+			},
+		},
+		{
+			title:       "form with the charset",
+			body:        "grant_type=client_credentials",
+			contentType: "application/x-www-form-urlencoded; charset=utf-8",
+			matcher: Matcher{
+				Form: url.Values{
+					"grant_type": []string{"client_credentials"},
+				},
+			},
+			exp: true,
+		},
+	}
+
+	for _, d := range data {
+		d := d
+		t.Run(d.title, func(t *testing.T) {
+			req := &http.Request{Header: http.Header{}}
+			if d.contentType != "" {
+				req.Header.Set("Content-Type", d.contentType)
+			}
+			if !d.noBody {
+				req.Body = io.NopCloser(strings.NewReader(d.body))
+			}
+			b, err := isMatch(req, d.matcher)
+			if d.isErr {
+				require.Error(t, err)
+				return
+			}
+			require.NoError(t, err)
+			require.Equal(t, d.exp, b)
+		})
+	}
+}
+
+func Test_testPartOfForm(t *testing.T) {
+	tb := newFakeTB(t)
+	req := &http.Request{
+		Body: io.NopCloser(strings.NewReader("grant_type=password&username=foo")),
+	}
+	route := Route{
+		Name: "issue a token",
+		Tester: Tester{
+			PartOfForm: url.Values{
+				"grant_type": []string{"client_credentials"},
+			},
+			Form: url.Values{
+				"grant_type": []string{"password"},
+				"username":   []string{"foo"},
+			},
+		},
+	}
+	testRequest(tb, req, Service{Endpoint: "http://example.com"}, route)
+	errs := tb.Errors()
+	require.Len(t, errs, 1)
+	require.Contains(t, errs[0], `the request form "grant_type" should match`)
+
+	tb = newFakeTB(t)
+	setBody(req, []byte("username=foo"))
+	testPartOfForm(tb, req, Service{}, Route{
+		Tester: Tester{
+			PartOfForm: url.Values{
+				"password": nil,
+			},
+		},
+	})
+	errs = tb.Errors()
+	require.Len(t, errs, 1)
+	require.Contains(t, errs[0], "the following request form is required: password")
+}
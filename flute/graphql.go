@@ -0,0 +1,581 @@
+package flute
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"net/url"
+	"reflect"
+	"sort"
+	"strings"
+)
+
+type (
+	// GraphQL has the conditions of the GraphQL request.
+	// The request is either POST with the JSON body or GET with the query parameters.
+	// If the request is POST with a JSON array body and its path and method match a route with GraphQL,
+	// the request is a batch of operations and each operation is routed and responded separately.
+	// The responses are combined into a JSON array, and their headers such as Set-Cookie are merged.
+	// The operation which no route matches fails the test and gets the GraphQL error.
+	GraphQL struct {
+		// OperationName is the name of the operation.
+		// If the request doesn't have operationName, the name of the only operation in the query is used.
+		OperationName string
+		// Query is the query document.
+		// The query is compared after normalization, so whitespace, commas, comments,
+		// and the order of the fields in the selection sets are ignored.
+		Query string
+		// Variables are marshaled to JSON and compared to the request variables.
+		Variables map[string]interface{}
+		// PartOfVariables are marshaled to JSON, and the request variables must contain them
+		// like Matcher.PartOfBodyJSON.
+		PartOfVariables map[string]interface{}
+		// PersistedQueryHash is the SHA-256 hash of the persisted query in extensions.persistedQuery.sha256Hash.
+		PersistedQueryHash string
+	}
+
+	// GraphQLError is an error of the GraphQL response.
+	GraphQLError struct {
+		Message    string                 `json:"message"`
+		Path       []interface{}          `json:"path,omitempty"`
+		Extensions map[string]interface{} `json:"extensions,omitempty"`
+	}
+
+	// graphQLRequest is the GraphQL operation of the request.
+	graphQLRequest struct {
+		Query         string                 `json:"query"`
+		OperationName string                 `json:"operationName"`
+		Variables     map[string]interface{} `json:"variables"`
+		Extensions    struct {
+			PersistedQuery struct {
+				SHA256Hash string `json:"sha256Hash"`
+			} `json:"persistedQuery"`
+		} `json:"extensions"`
+	}
+
+	// graphQLMismatch is the condition of GraphQL which the request doesn't meet.
+	graphQLMismatch struct {
+		// subject is the checked target such as "operation name".
+		subject  string
+		expected string
+		actual   string
+	}
+)
+
+// GraphQLResponse returns the response of the GraphQL operation.
+// The response body is {"data": data, "errors": errs}, and "errors" is omitted if errs is empty.
+func GraphQLResponse(data interface{}, errs ...GraphQLError) Response {
+	body := map[string]interface{}{
+		"data": data,
+	}
+	if len(errs) != 0 {
+		body["errors"] = errs
+	}
+	return Response{
+		Base: http.Response{
+			StatusCode: http.StatusOK,
+			Header: http.Header{
+				"Content-Type": []string{"application/json"},
+			},
+		},
+		BodyJSON: body,
+	}
+}
+
+func (m graphQLMismatch) String() string {
+	return fmt.Sprintf("the GraphQL %s should be %s\nactual: %s", m.subject, m.expected, m.actual)
+}
+
+// readGraphQLRequest returns the GraphQL operation of the request.
+func readGraphQLRequest(req *http.Request) (*graphQLRequest, error) {
+	if req.Method == http.MethodGet {
+		return readGraphQLQuery(req.URL.Query())
+	}
+	if req.Body == nil {
+		return nil, errors.New("the request has no body")
+	}
+	b, err := readBody(req)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read the request body: %w", err)
+	}
+	op := &graphQLRequest{}
+	if err := json.Unmarshal(b, op); err != nil {
+		return nil, fmt.Errorf("the request body isn't a GraphQL request: %w", err)
+	}
+	return op, nil
+}
+
+func readGraphQLQuery(query url.Values) (*graphQLRequest, error) {
+	op := &graphQLRequest{
+		Query:         query.Get("query"),
+		OperationName: query.Get("operationName"),
+	}
+	if v := query.Get("variables"); v != "" {
+		if err := json.Unmarshal([]byte(v), &op.Variables); err != nil {
+			return nil, fmt.Errorf("the query parameter variables is invalid: %w", err)
+		}
+	}
+	if v := query.Get("extensions"); v != "" {
+		if err := json.Unmarshal([]byte(v), &op.Extensions); err != nil {
+			return nil, fmt.Errorf("the query parameter extensions is invalid: %w", err)
+		}
+	}
+	return op, nil
+}
+
+// operationName returns the name of the operation.
+// If the request doesn't have operationName, operationName returns the name of the only operation in the query.
+func (op *graphQLRequest) operationName() string {
+	if op.OperationName != "" || op.Query == "" {
+		return op.OperationName
+	}
+	doc, err := parseGraphQL(op.Query)
+	if err != nil {
+		return ""
+	}
+	var name string
+	n := 0
+	for _, def := range doc {
+		if def.kind == "fragment" {
+			continue
+		}
+		n++
+		name = def.name
+	}
+	if n != 1 {
+		return ""
+	}
+	return name
+}
+
+// findGraphQLMismatches returns the conditions of GraphQL which the request doesn't meet.
+func findGraphQLMismatches(req *http.Request, gql *GraphQL) ([]graphQLMismatch, error) {
+	op, err := readGraphQLRequest(req)
+	if err != nil {
+		return []graphQLMismatch{{subject: "request", expected: "a GraphQL request", actual: err.Error()}}, nil
+	}
+	var mismatches []graphQLMismatch
+	if gql.OperationName != "" {
+		if name := op.operationName(); name != gql.OperationName {
+			mismatches = append(mismatches, graphQLMismatch{
+				subject:  "operation name",
+				expected: fmt.Sprintf("%q", gql.OperationName),
+				actual:   fmt.Sprintf("%q", name),
+			})
+		}
+	}
+	if gql.Query != "" {
+		exp, err := normalizeGraphQL(gql.Query)
+		if err != nil {
+			return nil, fmt.Errorf("the expected GraphQL query is invalid: %w", err)
+		}
+		act, err := normalizeGraphQL(op.Query)
+		if err != nil {
+			act = fmt.Sprintf("invalid query: %v", err)
+		}
+		if exp != act {
+			mismatches = append(mismatches, graphQLMismatch{
+				subject:  "query",
+				expected: exp,
+				actual:   act,
+			})
+		}
+	}
+	if gql.Variables != nil || gql.PartOfVariables != nil {
+		m, err := findGraphQLVariablesMismatch(op.Variables, gql)
+		if err != nil {
+			return nil, err
+		}
+		if m != nil {
+			mismatches = append(mismatches, *m)
+		}
+	}
+	if gql.PersistedQueryHash != "" {
+		if h := op.Extensions.PersistedQuery.SHA256Hash; !strings.EqualFold(h, gql.PersistedQueryHash) {
+			mismatches = append(mismatches, graphQLMismatch{
+				subject:  "persisted query hash",
+				expected: fmt.Sprintf("%q", gql.PersistedQueryHash),
+				actual:   fmt.Sprintf("%q", h),
+			})
+		}
+	}
+	return mismatches, nil
+}
+
+func findGraphQLVariablesMismatch(variables map[string]interface{}, gql *GraphQL) (*graphQLMismatch, error) {
+	var actual interface{} = map[string]interface{}{}
+	if variables != nil {
+		actual = variables
+	}
+	if gql.Variables != nil {
+		exp, err := normalizeJSON(gql.Variables)
+		if err != nil {
+			return nil, fmt.Errorf("failed to marshal GraphQL.Variables as JSON: %w", err)
+		}
+		if !reflect.DeepEqual(exp, actual) {
+			return &graphQLMismatch{
+				subject:  "variables",
+				expected: compactJSON(exp),
+				actual:   compactJSON(actual),
+			}, nil
+		}
+	}
+	if gql.PartOfVariables != nil {
+		exp, err := normalizeJSON(gql.PartOfVariables)
+		if err != nil {
+			return nil, fmt.Errorf("failed to marshal GraphQL.PartOfVariables as JSON: %w", err)
+		}
+		if m := containsJSON(exp, actual, "$", JSONArrayOrdered); m != nil {
+			return &graphQLMismatch{
+				subject:  "variables " + m.path,
+				expected: m.expected,
+				actual:   m.actual,
+			}, nil
+		}
+	}
+	return nil, nil
+}
+
+// isGraphQLRoute returns whether the route has the GraphQL condition.
+func isGraphQLRoute(route Route) bool {
+	return route.Matcher.GraphQL != nil || route.Tester.GraphQL != nil
+}
+
+// unmatchedGraphQLOperation returns the result of the GraphQL operation which no route matches.
+func unmatchedGraphQLOperation(json.RawMessage) json.RawMessage {
+	return json.RawMessage(`{"data":null,"errors":[{"message":"no route matches the GraphQL operation"}]}`)
+}
+
+type (
+	// graphQLToken is a lexical token of the GraphQL document.
+	graphQLToken struct {
+		// kind is "punct", "name", or "value".
+		kind  string
+		value string
+	}
+
+	// graphQLDefinition is an operation or a fragment in the document.
+	graphQLDefinition struct {
+		// kind is "query", "mutation", "subscription", or "fragment".
+		kind string
+		name string
+		// text is the normalized definition.
+		text string
+	}
+
+	graphQLParser struct {
+		tokens []graphQLToken
+		pos    int
+	}
+)
+
+// tokenizeGraphQL splits the GraphQL document into the tokens.
+// Whitespace, commas, and comments are ignored.
+func tokenizeGraphQL(s string) ([]graphQLToken, error) { //nolint:cyclop
+	var tokens []graphQLToken
+	for i := 0; i < len(s); {
+		c := s[i]
+		switch {
+		case c == ' ' || c == '\t' || c == '\n' || c == '\r' || c == ',':
+			i++
+		case c == '#':
+			for i < len(s) && s[i] != '\n' && s[i] != '\r' {
+				i++
+			}
+		case strings.HasPrefix(s[i:], "..."):
+			tokens = append(tokens, graphQLToken{kind: "punct", value: "..."})
+			i += 3
+		case strings.ContainsRune("!$&()=:@[]{}|", rune(c)):
+			tokens = append(tokens, graphQLToken{kind: "punct", value: string(c)})
+			i++
+		case strings.HasPrefix(s[i:], `"""`):
+			end := strings.Index(s[i+3:], `"""`)
+			for end >= 0 && strings.HasSuffix(s[i+3:i+3+end], `\`) {
+				next := strings.Index(s[i+3+end+3:], `"""`)
+				if next < 0 {
+					end = -1
+					break
+				}
+				end += 3 + next
+			}
+			if end < 0 {
+				return nil, errors.New("unterminated block string")
+			}
+			tokens = append(tokens, graphQLToken{kind: "value", value: s[i : i+3+end+3]})
+			i += 3 + end + 3
+		case c == '"':
+			j := i + 1
+			for ; j < len(s) && s[j] != '"'; j++ {
+				if s[j] == '\\' {
+					j++
+				}
+				if j < len(s) && s[j] == '\n' {
+					return nil, errors.New("unterminated string")
+				}
+			}
+			if j >= len(s) {
+				return nil, errors.New("unterminated string")
+			}
+			tokens = append(tokens, graphQLToken{kind: "value", value: s[i : j+1]})
+			i = j + 1
+		case c == '-' || (c >= '0' && c <= '9'):
+			// number such as -1.5e+10
+			j := i + 1
+			for j < len(s) && (isGraphQLNameChar(s[j]) || s[j] == '.' ||
+				((s[j] == '+' || s[j] == '-') && (s[j-1] == 'e' || s[j-1] == 'E'))) {
+				j++
+			}
+			tokens = append(tokens, graphQLToken{kind: "value", value: s[i:j]})
+			i = j
+		case isGraphQLNameChar(c):
+			j := i + 1
+			for j < len(s) && isGraphQLNameChar(s[j]) {
+				j++
+			}
+			tokens = append(tokens, graphQLToken{kind: "name", value: s[i:j]})
+			i = j
+		default:
+			return nil, fmt.Errorf("unexpected character %q", c)
+		}
+	}
+	return tokens, nil
+}
+
+func isGraphQLNameChar(c byte) bool {
+	return c == '_' || (c >= 'a' && c <= 'z') || (c >= 'A' && c <= 'Z') || (c >= '0' && c <= '9')
+}
+
+func (p *graphQLParser) peek() string {
+	if p.pos >= len(p.tokens) {
+		return ""
+	}
+	return p.tokens[p.pos].value
+}
+
+func (p *graphQLParser) next() (string, error) {
+	if p.pos >= len(p.tokens) {
+		return "", errors.New("unexpected end of the document")
+	}
+	p.pos++
+	return p.tokens[p.pos-1].value, nil
+}
+
+func (p *graphQLParser) expect(v string) error {
+	t, err := p.next()
+	if err != nil {
+		return err
+	}
+	if t != v {
+		return fmt.Errorf("expected %q but got %q", v, t)
+	}
+	return nil
+}
+
+// balanced returns the tokens between the open and close punctuators including them.
+func (p *graphQLParser) balanced(open, closing string) ([]string, error) {
+	var tokens []string
+	depth := 0
+	for {
+		t, err := p.next()
+		if err != nil {
+			return nil, err
+		}
+		tokens = append(tokens, t)
+		switch t {
+		case open:
+			depth++
+		case closing:
+			depth--
+		}
+		if depth == 0 {
+			return tokens, nil
+		}
+	}
+}
+
+// directives returns the directives such as "@include(if: $foo)".
+func (p *graphQLParser) directives() ([]string, error) {
+	var tokens []string
+	for p.peek() == "@" {
+		p.pos++
+		name, err := p.next()
+		if err != nil {
+			return nil, err
+		}
+		tokens = append(tokens, "@"+name)
+		if p.peek() == "(" {
+			args, err := p.balanced("(", ")")
+			if err != nil {
+				return nil, err
+			}
+			tokens = append(tokens, args...)
+		}
+	}
+	return tokens, nil
+}
+
+// selectionSet returns the normalized selection set whose selections are sorted.
+func (p *graphQLParser) selectionSet() (string, error) {
+	if err := p.expect("{"); err != nil {
+		return "", err
+	}
+	var selections []string
+	for p.peek() != "}" {
+		if p.pos >= len(p.tokens) {
+			return "", errors.New("unterminated selection set")
+		}
+		s, err := p.selection()
+		if err != nil {
+			return "", err
+		}
+		selections = append(selections, s)
+	}
+	p.pos++
+	sort.Strings(selections)
+	return "{ " + strings.Join(selections, " ") + " }", nil
+}
+
+// selection returns the normalized field, fragment spread, or inline fragment.
+func (p *graphQLParser) selection() (string, error) {
+	var tokens []string
+	if p.peek() == "..." {
+		p.pos++
+		tokens = append(tokens, "...")
+		if p.peek() == "on" {
+			p.pos++
+			typeName, err := p.next()
+			if err != nil {
+				return "", err
+			}
+			tokens = append(tokens, "on", typeName)
+		} else if p.peek() != "@" && p.peek() != "{" {
+			// fragment spread
+			name, err := p.next()
+			if err != nil {
+				return "", err
+			}
+			tokens = append(tokens, name)
+			dirs, err := p.directives()
+			if err != nil {
+				return "", err
+			}
+			return strings.Join(append(tokens, dirs...), " "), nil
+		}
+	} else {
+		name, err := p.next()
+		if err != nil {
+			return "", err
+		}
+		tokens = append(tokens, name)
+		if p.peek() == ":" {
+			p.pos++
+			field, err := p.next()
+			if err != nil {
+				return "", err
+			}
+			tokens = append(tokens, ":", field)
+		}
+		if p.peek() == "(" {
+			args, err := p.balanced("(", ")")
+			if err != nil {
+				return "", err
+			}
+			tokens = append(tokens, args...)
+		}
+	}
+	dirs, err := p.directives()
+	if err != nil {
+		return "", err
+	}
+	tokens = append(tokens, dirs...)
+	if p.peek() == "{" {
+		set, err := p.selectionSet()
+		if err != nil {
+			return "", err
+		}
+		tokens = append(tokens, set)
+	}
+	return strings.Join(tokens, " "), nil
+}
+
+// definition returns the normalized operation or fragment definition.
+func (p *graphQLParser) definition() (graphQLDefinition, error) {
+	def := graphQLDefinition{kind: "query"}
+	var tokens []string
+	if p.peek() != "{" {
+		kind, err := p.next()
+		if err != nil {
+			return def, err
+		}
+		switch kind {
+		case "query", "mutation", "subscription", "fragment":
+		default:
+			return def, fmt.Errorf("unexpected %q", kind)
+		}
+		def.kind = kind
+		tokens = append(tokens, kind)
+		// the header until the selection set, such as the name, variables, type condition, and directives
+		for p.peek() != "{" {
+			if p.peek() == "(" {
+				vars, err := p.balanced("(", ")")
+				if err != nil {
+					return def, err
+				}
+				tokens = append(tokens, vars...)
+				continue
+			}
+			t, err := p.next()
+			if err != nil {
+				return def, err
+			}
+			if len(tokens) == 1 && t != "@" {
+				def.name = t
+			}
+			tokens = append(tokens, t)
+		}
+	}
+	set, err := p.selectionSet()
+	if err != nil {
+		return def, err
+	}
+	def.text = strings.Join(append(tokens, set), " ")
+	return def, nil
+}
+
+// parseGraphQL parses the GraphQL document into the normalized definitions.
+func parseGraphQL(s string) ([]graphQLDefinition, error) {
+	tokens, err := tokenizeGraphQL(s)
+	if err != nil {
+		return nil, err
+	}
+	if len(tokens) == 0 {
+		return nil, errors.New("the document is empty")
+	}
+	p := &graphQLParser{tokens: tokens}
+	var defs []graphQLDefinition
+	for p.pos < len(p.tokens) {
+		def, err := p.definition()
+		if err != nil {
+			return nil, err
+		}
+		defs = append(defs, def)
+	}
+	return defs, nil
+}
+
+// normalizeGraphQL returns the normalized GraphQL document.
+// Whitespace, commas, comments, the order of the fields in the selection sets,
+// and the order of the definitions are ignored.
+func normalizeGraphQL(s string) (string, error) {
+	defs, err := parseGraphQL(s)
+	if err != nil {
+		return "", err
+	}
+	texts := make([]string, len(defs))
+	for i, def := range defs {
+		texts[i] = def.text
+	}
+	sort.Strings(texts)
+	return strings.Join(texts, "\n"), nil
+}
@@ -0,0 +1,218 @@
+package flute
+
+import (
+	"io"
+	"net/http"
+	"net/url"
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/require"
+)
+
+func Test_normalizeGraphQL(t *testing.T) { //nolint:funlen
+	data := []struct {
+		title    string
+		expected string
+		actual   string
+		isErr    bool
+		exp      bool
+	}{
+		{
+			title:    "whitespace, commas, and comments are ignored",
+			expected: `query GetUser($id: ID!) { user(id: $id) { id name } }`,
+			actual: `# get the user
+query GetUser($id: ID!) {
+  user(id: $id) {
+    id,
+    name # the display name
+  }
+}`,
+			exp: true,
+		},
+		{
+			title:    "field order is ignored",
+			expected: `{ user(id: 1) { id name friends { name id } } }`,
+			actual:   `{ user(id: 1) { friends { id name } name id } }`,
+			exp:      true,
+		},
+		{
+			title:    "definition order is ignored",
+			expected: "query A { a } query B { b }",
+			actual:   "query B { b }\nquery A { a }",
+			exp:      true,
+		},
+		{
+			title:    "fragment",
+			expected: `query { user { ...UserFields } } fragment UserFields on User { id name }`,
+			actual:   `fragment UserFields on User { name id } query { user { ...UserFields } }`,
+			exp:      true,
+		},
+		{
+			title:    "string value",
+			expected: `{ user(name: "foo, bar # baz") { id } }`,
+			actual:   `{ user(name: "foo, bar # baz") { id } }`,
+			exp:      true,
+		},
+		{
+			title:    "argument is different",
+			expected: `{ user(id: 1) { id } }`,
+			actual:   `{ user(id: 2) { id } }`,
+		},
+		{
+			title:    "field is different",
+			expected: `{ user { id name } }`,
+			actual:   `{ user { id } }`,
+		},
+		{
+			title:    "alias is different",
+			expected: `{ foo: user { id } }`,
+			actual:   `{ bar: user { id } }`,
+		},
+		{
+			title:    "invalid query",
+			expected: `{ user { id }`,
+			isErr:    true,
+		},
+	}
+
+	for _, d := range data {
+		d := d
+		t.Run(d.title, func(t *testing.T) {
+			exp, err := normalizeGraphQL(d.expected)
+			if d.isErr {
+				require.Error(t, err)
+				return
+			}
+			require.NoError(t, err)
+			act, err := normalizeGraphQL(d.actual)
+			require.NoError(t, err)
+			require.Equal(t, d.exp, exp == act)
+		})
+	}
+}
+
+func Test_findGraphQLMismatches(t *testing.T) { //nolint:funlen
+	body := `{
+  "query": "query GetUser($id: ID!) { user(id: $id) { id name } }",
+  "variables": {"id": "1", "filter": {"active": true, "tags": ["a"]}},
+  "extensions": {"persistedQuery": {"version": 1, "sha256Hash": "ABC123"}}
+}`
+	data := []struct {
+		title    string
+		req      *http.Request
+		gql      GraphQL
+		subjects []string
+	}{
+		{
+			title: "all conditions match",
+			gql: GraphQL{
+				OperationName:      "GetUser",
+				Query:              `query GetUser($id: ID!) { user(id: $id) { name id } }`,
+				PartOfVariables:    map[string]interface{}{"filter": map[string]interface{}{"active": true}},
+				PersistedQueryHash: "abc123",
+			},
+		},
+		{
+			title: "variables",
+			gql: GraphQL{
+				Variables: map[string]interface{}{
+					"id": "1",
+					"filter": map[string]interface{}{
+						"active": true,
+						"tags":   []string{"a"},
+					},
+				},
+			},
+		},
+		{
+			title: "mismatches",
+			gql: GraphQL{
+				OperationName:      "ListUsers",
+				Query:              `{ users { id } }`,
+				Variables:          map[string]interface{}{"id": "1"},
+				PersistedQueryHash: "def456",
+			},
+			subjects: []string{"operation name", "query", "variables", "persisted query hash"},
+		},
+		{
+			title: "part of variables",
+			gql: GraphQL{
+				PartOfVariables: map[string]interface{}{"filter": map[string]interface{}{"active": false}},
+			},
+			subjects: []string{"variables $.filter.active"},
+		},
+		{
+			title: "GET",
+			req: &http.Request{
+				Method: http.MethodGet,
+				URL: &url.URL{
+					Path: "/graphql",
+					RawQuery: url.Values{
+						"query":         []string{"query A { a } query B { b }"},
+						"operationName": []string{"B"},
+						"variables":     []string{`{"id": "1"}`},
+					}.Encode(),
+				},
+			},
+			gql: GraphQL{
+				OperationName:   "B",
+				PartOfVariables: map[string]interface{}{"id": "1"},
+			},
+		},
+		{
+			title: "request isn't GraphQL",
+			req: &http.Request{
+				Method: http.MethodPost,
+				Body:   io.NopCloser(strings.NewReader(`foo`)),
+			},
+			gql: GraphQL{
+				OperationName: "GetUser",
+			},
+			subjects: []string{"request"},
+		},
+	}
+
+	for _, d := range data {
+		d := d
+		t.Run(d.title, func(t *testing.T) {
+			req := d.req
+			if req == nil {
+				req = &http.Request{
+					Method: http.MethodPost,
+					Body:   io.NopCloser(strings.NewReader(body)),
+				}
+			}
+			mismatches, err := findGraphQLMismatches(req, &d.gql)
+			require.NoError(t, err)
+			subjects := make([]string, len(mismatches))
+			for i, m := range mismatches {
+				subjects[i] = m.subject
+			}
+			if d.subjects == nil {
+				require.Empty(t, subjects)
+				return
+			}
+			require.Equal(t, d.subjects, subjects)
+		})
+	}
+}
+
+func Test_testGraphQL(t *testing.T) {
+	tb := newFakeTB(t)
+	testGraphQL(tb, &http.Request{
+		Method: http.MethodPost,
+		Body:   io.NopCloser(strings.NewReader(`{"query": "query ListUsers { users { id } }"}`)),
+	}, Service{Endpoint: "http://example.com"}, Route{
+		Name: "get a user",
+		Tester: Tester{
+			GraphQL: &GraphQL{
+				OperationName: "GetUser",
+			},
+		},
+	})
+	errs := tb.Errors()
+	require.Len(t, errs, 1)
+	require.Contains(t, errs[0], `the GraphQL operation name should be "GetUser"`)
+	require.Contains(t, errs[0], `actual: "ListUsers"`)
+}
@@ -0,0 +1,226 @@
+package flute
+
+import (
+	"net/http"
+	"net/url"
+	"sort"
+	"sync"
+	"time"
+)
+
+type (
+	// Journal records the requests which Transport receives.
+	// The zero value is an empty journal ready to use.
+	Journal struct {
+		entries []Entry
+		// seq is the sequence number of the next request.
+		seq   int
+		mutex sync.Mutex
+	}
+
+	// Entry is a request recorded in the journal.
+	Entry struct {
+		// Request is the snapshot of the request.
+		Request RecordedRequest
+		// Time is the time when Transport received the request.
+		Time time.Time
+		// Matched is true if a route matches the request.
+		// If Matched is false, Service and Route are zero values.
+		// For the batch request, Matched is true if routes match all operations,
+		// and Service and Route are those of the first matched operation.
+		Matched bool
+		// Service is the service which the matched route belongs to.
+		Service Service
+		// Route is the route which matches the request.
+		Route Route
+		// Operations are the operations of the batch request such as GraphQL operations.
+		// If the request isn't a batch, Operations is nil.
+		Operations []Operation
+		// Response is the response which RoundTrip returned.
+		// The body of Response isn't recorded.
+		Response *http.Response
+		// Err is the error which RoundTrip returned.
+		Err error
+		seq int
+	}
+
+	// Operation is an operation of the batch request recorded in the journal.
+	Operation struct {
+		// Body is the operation in the request body.
+		Body []byte
+		// Matched is true if a route matches the operation.
+		// If Matched is false, Service and Route are zero values.
+		Matched bool
+		Service Service
+		Route   Route
+	}
+
+	// RecordedRequest is the snapshot of the request.
+	RecordedRequest struct {
+		Method string
+		URL    *url.URL
+		Header http.Header
+		// Body is nil if the request body is nil.
+		Body []byte
+	}
+)
+
+// BodyString returns the request body as string.
+func (req RecordedRequest) BodyString() string {
+	return string(req.Body)
+}
+
+// newEntry returns the entry of the request.
+// The entry is numbered when the request is received,
+// so Entries can return the entries in the order of the requests even if the requests are concurrent.
+func (journal *Journal) newEntry(req *http.Request, body []byte) *Entry {
+	journal.mutex.Lock()
+	seq := journal.seq
+	journal.seq++
+	journal.mutex.Unlock()
+	entry := &Entry{
+		seq:  seq,
+		Time: time.Now(),
+		Request: RecordedRequest{
+			Method: req.Method,
+			Header: req.Header.Clone(),
+		},
+	}
+	if req.URL != nil {
+		u := *req.URL
+		entry.Request.URL = &u
+	}
+	if body != nil {
+		entry.Request.Body = make([]byte, len(body))
+		copy(entry.Request.Body, body)
+	}
+	return entry
+}
+
+// recordOperations records the operations of the batch request and the routes which match them.
+func (entry *Entry) recordOperations(operations []batchOperation) {
+	entry.Matched = true
+	entry.Operations = make([]Operation, len(operations))
+	first := true
+	for i, op := range operations {
+		entry.Operations[i].Body = append([]byte(nil), op.body...)
+		if op.route == nil {
+			entry.Matched = false
+			continue
+		}
+		entry.Operations[i].Matched = true
+		entry.Operations[i].Service = *op.service
+		entry.Operations[i].Route = *op.route
+		if first {
+			entry.Service = *op.service
+			entry.Route = *op.route
+			first = false
+		}
+	}
+}
+
+// matchedBy returns whether the route which meets the condition matches the request or an operation of the batch.
+func (entry Entry) matchedBy(f func(service Service, route Route) bool) bool {
+	if entry.Operations == nil {
+		return entry.Matched && f(entry.Service, entry.Route)
+	}
+	for _, op := range entry.Operations {
+		if op.Matched && f(op.Service, op.Route) {
+			return true
+		}
+	}
+	return false
+}
+
+func (journal *Journal) add(entry Entry) {
+	journal.mutex.Lock()
+	defer journal.mutex.Unlock()
+	// keep the entries sorted by the sequence number
+	i := sort.Search(len(journal.entries), func(i int) bool {
+		return journal.entries[i].seq > entry.seq
+	})
+	journal.entries = append(journal.entries, Entry{})
+	copy(journal.entries[i+1:], journal.entries[i:])
+	journal.entries[i] = entry
+}
+
+// Entries returns all recorded entries in the order Transport received the requests.
+// An entry is recorded when RoundTrip returns, so the entries of the requests in progress aren't included.
+func (journal *Journal) Entries() []Entry {
+	journal.mutex.Lock()
+	defer journal.mutex.Unlock()
+	entries := make([]Entry, len(journal.entries))
+	copy(entries, journal.entries)
+	return entries
+}
+
+// Len returns the number of recorded entries.
+func (journal *Journal) Len() int {
+	journal.mutex.Lock()
+	defer journal.mutex.Unlock()
+	return len(journal.entries)
+}
+
+// Reset removes all recorded entries.
+func (journal *Journal) Reset() {
+	journal.mutex.Lock()
+	journal.entries = nil
+	journal.mutex.Unlock()
+}
+
+// Filter returns the entries which meet the condition.
+func (journal *Journal) Filter(f func(Entry) bool) []Entry {
+	var entries []Entry
+	for _, entry := range journal.Entries() {
+		if f(entry) {
+			entries = append(entries, entry)
+		}
+	}
+	return entries
+}
+
+// ByService returns the entries which are matched by the routes of the service.
+// The batch request is included if the routes of the service match some of its operations.
+func (journal *Journal) ByService(endpoint string) []Entry {
+	return journal.Filter(func(entry Entry) bool {
+		return entry.matchedBy(func(service Service, _ Route) bool {
+			return service.Endpoint == endpoint
+		})
+	})
+}
+
+// ByRoute returns the entries which are matched by the route.
+// The batch request is included if the route matches some of its operations.
+func (journal *Journal) ByRoute(name string) []Entry {
+	return journal.Filter(func(entry Entry) bool {
+		return entry.matchedBy(func(_ Service, route Route) bool {
+			return route.Name == name
+		})
+	})
+}
+
+// Unmatched returns the entries which no route matches.
+func (journal *Journal) Unmatched() []Entry {
+	return journal.Filter(func(entry Entry) bool {
+		return !entry.Matched
+	})
+}
+
+// Last returns the last recorded entry.
+// If no entry is recorded, the second returned value is false.
+func (journal *Journal) Last() (Entry, bool) {
+	return last(journal.Entries())
+}
+
+// LastByRoute returns the last entry which is matched by the route.
+// If no entry is matched by the route, the second returned value is false.
+func (journal *Journal) LastByRoute(name string) (Entry, bool) {
+	return last(journal.ByRoute(name))
+}
+
+func last(entries []Entry) (Entry, bool) {
+	if len(entries) == 0 {
+		return Entry{}, false
+	}
+	return entries[len(entries)-1], true
+}
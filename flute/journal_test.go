@@ -0,0 +1,106 @@
+package flute_test
+
+import (
+	"io"
+	"net/http"
+	"net/url"
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/require"
+	"github.com/suzuki-shunsuke/flute/v2/flute"
+)
+
+func TestJournal(t *testing.T) { //nolint:funlen
+	journal := &flute.Journal{}
+	transport := flute.Transport{
+		T:       t,
+		Journal: journal,
+		Services: []flute.Service{
+			{
+				Endpoint: "http://example.com",
+				Routes: []flute.Route{
+					{
+						Name: "create a user",
+						Matcher: flute.Matcher{
+							Method: http.MethodPost,
+							Path:   "/users",
+						},
+						Tester: flute.Tester{
+							BodyString: `{"name": "foo"}`,
+						},
+						Response: flute.Response{
+							Base: http.Response{
+								StatusCode: http.StatusCreated,
+							},
+						},
+					},
+				},
+			},
+		},
+		Transport: flute.Transport{},
+	}
+	reqs := []*http.Request{
+		{
+			URL: &url.URL{
+				Scheme: "http",
+				Host:   "example.com",
+				Path:   "/users",
+			},
+			Method: http.MethodPost,
+			Body:   io.NopCloser(strings.NewReader(`{"name": "foo"}`)),
+			Header: http.Header{
+				"Authorization": []string{"token XXXXX"},
+			},
+		},
+		{
+			URL: &url.URL{
+				Scheme: "http",
+				Host:   "example.org",
+				Path:   "/users",
+			},
+			Method: http.MethodGet,
+		},
+	}
+	for _, req := range reqs {
+		resp, err := transport.RoundTrip(req)
+		require.NoError(t, err)
+		resp.Body.Close()
+	}
+
+	require.Equal(t, 2, journal.Len())
+
+	entries := journal.ByRoute("create a user")
+	require.Len(t, entries, 1)
+	entry := entries[0]
+	require.True(t, entry.Matched)
+	require.Equal(t, "http://example.com", entry.Service.Endpoint)
+	require.Equal(t, http.MethodPost, entry.Request.Method)
+	require.Equal(t, "/users", entry.Request.URL.Path)
+	require.Equal(t, "token XXXXX", entry.Request.Header.Get("Authorization"))
+	require.Equal(t, `{"name": "foo"}`, entry.Request.BodyString())
+	require.Equal(t, http.StatusCreated, entry.Response.StatusCode)
+	require.False(t, entry.Time.IsZero())
+
+	require.Len(t, journal.ByService("http://example.com"), 1)
+	require.Empty(t, journal.ByService("http://example.org"))
+
+	unmatched := journal.Unmatched()
+	require.Len(t, unmatched, 1)
+	require.Nil(t, unmatched[0].Request.Body)
+	require.Equal(t, http.StatusNotFound, unmatched[0].Response.StatusCode)
+
+	last, ok := journal.Last()
+	require.True(t, ok)
+	require.Equal(t, "example.org", last.Request.URL.Host)
+
+	last, ok = journal.LastByRoute("create a user")
+	require.True(t, ok)
+	require.Equal(t, http.MethodPost, last.Request.Method)
+
+	_, ok = journal.LastByRoute("unknown")
+	require.False(t, ok)
+
+	journal.Reset()
+	require.Equal(t, 0, journal.Len())
+}
@@ -0,0 +1,310 @@
+package flute
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"reflect"
+
+	"github.com/stretchr/testify/assert"
+)
+
+// The error codes defined by the JSON-RPC 2.0 specification.
+// https://www.jsonrpc.org/specification#error_object
+const (
+	JSONRPCCodeParseError     = -32700
+	JSONRPCCodeInvalidRequest = -32600
+	JSONRPCCodeMethodNotFound = -32601
+	JSONRPCCodeInvalidParams  = -32602
+	JSONRPCCodeInternalError  = -32603
+)
+
+type (
+	// JSONRPC has the conditions of the JSON-RPC 2.0 call.
+	// The call is the JSON object in the request body, so routes are matched by the method instead of the path.
+	// If the request is POST with a JSON array body and its path and method match a route with JSONRPC,
+	// the request is a batch of calls and each call is routed and responded separately.
+	// The responses are combined into a JSON array, and the responses of the notifications are omitted.
+	// The call which no route matches fails the test and gets the error "Method not found" with the echoed id,
+	// both in a batch and as a single request whose path and method match a route with JSONRPC.
+	JSONRPC struct {
+		// Method is the method name of the call.
+		Method string
+		// Params are marshaled to JSON and compared to the params of the call.
+		Params interface{}
+		// PartOfParams are marshaled to JSON, and the params of the call must contain them
+		// like Matcher.PartOfBodyJSON.
+		PartOfParams interface{}
+		// PartOfParamsArrayMode is how arrays are compared in PartOfParams.
+		// The default is JSONArrayOrdered.
+		PartOfParamsArrayMode JSONArrayMode
+	}
+
+	// JSONRPCError is the error object of the JSON-RPC response.
+	JSONRPCError struct {
+		Code    int         `json:"code"`
+		Message string      `json:"message"`
+		Data    interface{} `json:"data,omitempty"`
+	}
+
+	// jsonRPCRequest is the JSON-RPC call of the request.
+	jsonRPCRequest struct {
+		JSONRPC string `json:"jsonrpc"`
+		Method  string `json:"method"`
+		// Params is nil if the call doesn't have params.
+		Params json.RawMessage `json:"params"`
+		// ID is nil if the call is a notification.
+		ID json.RawMessage `json:"id"`
+	}
+
+	// jsonRPCMismatch is the condition of JSONRPC which the request doesn't meet.
+	jsonRPCMismatch struct {
+		// subject is the checked target such as "method".
+		subject  string
+		expected string
+		actual   string
+	}
+)
+
+func (e JSONRPCError) Error() string {
+	return fmt.Sprintf("JSON-RPC error %d: %s", e.Code, e.Message)
+}
+
+// JSONRPCParseError returns the error "Parse error" (-32700).
+func JSONRPCParseError() JSONRPCError {
+	return JSONRPCError{Code: JSONRPCCodeParseError, Message: "Parse error"}
+}
+
+// JSONRPCInvalidRequest returns the error "Invalid Request" (-32600).
+func JSONRPCInvalidRequest() JSONRPCError {
+	return JSONRPCError{Code: JSONRPCCodeInvalidRequest, Message: "Invalid Request"}
+}
+
+// JSONRPCMethodNotFound returns the error "Method not found" (-32601).
+func JSONRPCMethodNotFound() JSONRPCError {
+	return JSONRPCError{Code: JSONRPCCodeMethodNotFound, Message: "Method not found"}
+}
+
+// JSONRPCInvalidParams returns the error "Invalid params" (-32602).
+func JSONRPCInvalidParams() JSONRPCError {
+	return JSONRPCError{Code: JSONRPCCodeInvalidParams, Message: "Invalid params"}
+}
+
+// JSONRPCInternalError returns the error "Internal error" (-32603).
+func JSONRPCInternalError() JSONRPCError {
+	return JSONRPCError{Code: JSONRPCCodeInternalError, Message: "Internal error"}
+}
+
+// JSONRPCResult returns the response of the successful JSON-RPC call.
+// The id of the call is echoed in the response.
+// If the call is a notification, the response is 204 No Content without the body.
+func JSONRPCResult(result interface{}) Response {
+	return jsonRPCResponse("result", result)
+}
+
+// JSONRPCErrorResponse returns the error response of the JSON-RPC call.
+// The id of the call is echoed in the response.
+// If the call is a notification, the response is 204 No Content without the body.
+func JSONRPCErrorResponse(e JSONRPCError) Response {
+	return jsonRPCResponse("error", e)
+}
+
+func jsonRPCResponse(key string, value interface{}) Response {
+	return Response{
+		Response: func(req *http.Request) (*http.Response, error) {
+			id := json.RawMessage("null")
+			if call, err := readJSONRPCRequest(req); err == nil {
+				if call.ID == nil {
+					return &http.Response{
+						Request:    req,
+						StatusCode: http.StatusNoContent,
+						Header:     http.Header{},
+						Body:       http.NoBody,
+					}, nil
+				}
+				id = call.ID
+			}
+			b, err := json.Marshal(map[string]interface{}{
+				"jsonrpc": "2.0",
+				key:       value,
+				"id":      id,
+			})
+			if err != nil {
+				return &http.Response{
+					Request:    req,
+					StatusCode: http.StatusInternalServerError,
+				}, fmt.Errorf("failed to marshal the JSON-RPC response: %w", err)
+			}
+			return &http.Response{
+				Request:    req,
+				StatusCode: http.StatusOK,
+				Header: http.Header{
+					"Content-Type": []string{"application/json"},
+				},
+				Body:          io.NopCloser(bytes.NewReader(b)),
+				ContentLength: int64(len(b)),
+			}, nil
+		},
+	}
+}
+
+func (m jsonRPCMismatch) String() string {
+	return fmt.Sprintf("the JSON-RPC %s should be %s\nactual: %s", m.subject, m.expected, m.actual)
+}
+
+// readJSONRPCRequest returns the JSON-RPC call of the request body.
+func readJSONRPCRequest(req *http.Request) (*jsonRPCRequest, error) {
+	b, err := readBody(req)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read the request body: %w", err)
+	}
+	if b == nil {
+		return nil, errors.New("the request has no body")
+	}
+	call := &jsonRPCRequest{}
+	if err := json.Unmarshal(b, call); err != nil {
+		return nil, fmt.Errorf("the request body isn't a JSON-RPC call: %w", err)
+	}
+	return call, nil
+}
+
+// findJSONRPCMismatches returns the conditions of JSONRPC which the request doesn't meet.
+func findJSONRPCMismatches(req *http.Request, rpc *JSONRPC) ([]jsonRPCMismatch, error) {
+	call, err := readJSONRPCRequest(req)
+	if err != nil {
+		return []jsonRPCMismatch{{subject: "request", expected: "a JSON-RPC call", actual: err.Error()}}, nil
+	}
+	var mismatches []jsonRPCMismatch
+	if call.JSONRPC != "2.0" {
+		mismatches = append(mismatches, jsonRPCMismatch{
+			subject:  "version",
+			expected: `"2.0"`,
+			actual:   fmt.Sprintf("%q", call.JSONRPC),
+		})
+	}
+	if rpc.Method != "" && call.Method != rpc.Method {
+		mismatches = append(mismatches, jsonRPCMismatch{
+			subject:  "method",
+			expected: fmt.Sprintf("%q", rpc.Method),
+			actual:   fmt.Sprintf("%q", call.Method),
+		})
+	}
+	if rpc.Params != nil || rpc.PartOfParams != nil {
+		m, err := findJSONRPCParamsMismatch(call.Params, rpc)
+		if err != nil {
+			return nil, err
+		}
+		if m != nil {
+			mismatches = append(mismatches, *m)
+		}
+	}
+	return mismatches, nil
+}
+
+func findJSONRPCParamsMismatch(params json.RawMessage, rpc *JSONRPC) (*jsonRPCMismatch, error) {
+	var actual interface{}
+	if params != nil {
+		if err := json.Unmarshal(params, &actual); err != nil {
+			return nil, fmt.Errorf("failed to parse the params of the JSON-RPC call: %w", err)
+		}
+	}
+	if rpc.Params != nil {
+		exp, err := normalizeJSON(rpc.Params)
+		if err != nil {
+			return nil, fmt.Errorf("failed to marshal JSONRPC.Params as JSON: %w", err)
+		}
+		if !reflect.DeepEqual(exp, actual) {
+			return &jsonRPCMismatch{
+				subject:  "params",
+				expected: compactJSON(exp),
+				actual:   compactJSON(actual),
+			}, nil
+		}
+	}
+	if rpc.PartOfParams != nil {
+		exp, err := normalizeJSON(rpc.PartOfParams)
+		if err != nil {
+			return nil, fmt.Errorf("failed to marshal JSONRPC.PartOfParams as JSON: %w", err)
+		}
+		if m := containsJSON(exp, actual, "$", rpc.PartOfParamsArrayMode); m != nil {
+			return &jsonRPCMismatch{
+				subject:  "params " + m.path,
+				expected: m.expected,
+				actual:   m.actual,
+			}, nil
+		}
+	}
+	return nil, nil
+}
+
+// isJSONRPCRoute returns whether the route has the JSONRPC condition.
+func isJSONRPCRoute(route Route) bool {
+	return route.Matcher.JSONRPC != nil || route.Tester.JSONRPC != nil
+}
+
+// unmatchedJSONRPCCall returns the error "Method not found" of the call which no route matches.
+// The id of the call is echoed, and the notification gets no response.
+// If the call isn't a JSON object, the error is "Invalid Request".
+func unmatchedJSONRPCCall(op json.RawMessage) json.RawMessage {
+	var call jsonRPCRequest
+	resp := map[string]interface{}{
+		"jsonrpc": "2.0",
+		"error":   JSONRPCMethodNotFound(),
+		"id":      json.RawMessage("null"),
+	}
+	if err := json.Unmarshal(op, &call); err != nil {
+		resp["error"] = JSONRPCInvalidRequest()
+	} else {
+		if call.ID == nil {
+			return nil
+		}
+		resp["id"] = call.ID
+	}
+	b, err := json.Marshal(resp)
+	if err != nil {
+		return nil
+	}
+	return b
+}
+
+// unmatchedJSONRPCRoundTrip fails the test and returns the error "Method not found" of the single JSON-RPC call
+// which no route matches.
+// If the request isn't a JSON-RPC call or its path and method don't match a route with JSONRPC,
+// unmatchedJSONRPCRoundTrip returns false.
+func (transport Transport) unmatchedJSONRPCRoundTrip(req *http.Request) (*http.Response, bool) {
+	call, err := readJSONRPCRequest(req)
+	if err != nil || call.JSONRPC != "2.0" || call.Method == "" {
+		return nil, false
+	}
+	if !transport.hasBatchRoute(req, isJSONRPCRoute) {
+		return nil, false
+	}
+	if transport.T != nil {
+		assert.Fail(transport.T, makeNoMatchedRouteMsgWithCandidates(transport.T, req, transport.Services))
+	}
+	b, err := readBody(req)
+	if err != nil {
+		return nil, false
+	}
+	result := unmatchedJSONRPCCall(b)
+	if result == nil {
+		return &http.Response{
+			Request:    req,
+			StatusCode: http.StatusNoContent,
+			Header:     http.Header{},
+			Body:       http.NoBody,
+		}, true
+	}
+	return &http.Response{
+		Request:    req,
+		StatusCode: http.StatusOK,
+		Header: http.Header{
+			"Content-Type": []string{"application/json"},
+		},
+		Body:          io.NopCloser(bytes.NewReader(result)),
+		ContentLength: int64(len(result)),
+	}, true
+}
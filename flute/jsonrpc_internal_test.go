@@ -0,0 +1,211 @@
+package flute
+
+import (
+	"encoding/json"
+	"io"
+	"net/http"
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/require"
+)
+
+func Test_findJSONRPCMismatches(t *testing.T) { //nolint:funlen
+	data := []struct {
+		title    string
+		body     string
+		rpc      JSONRPC
+		subjects []string
+	}{
+		{
+			title: "method and params",
+			body:  `{"jsonrpc": "2.0", "method": "eth_getBalance", "params": ["0x1", "latest"], "id": 1}`,
+			rpc: JSONRPC{
+				Method: "eth_getBalance",
+				Params: []string{"0x1", "latest"},
+			},
+		},
+		{
+			title: "part of params",
+			body:  `{"jsonrpc": "2.0", "method": "textDocument/hover", "params": {"textDocument": {"uri": "file:///a.go"}, "position": {"line": 1, "character": 2}}, "id": "a"}`,
+			rpc: JSONRPC{
+				Method: "textDocument/hover",
+				PartOfParams: map[string]interface{}{
+					"position": map[string]interface{}{"line": 1},
+				},
+			},
+		},
+		{
+			title: "part of params with the unordered array",
+			body:  `{"jsonrpc": "2.0", "method": "sum", "params": [3, 1, 2], "id": 1}`,
+			rpc: JSONRPC{
+				PartOfParams:          []int{1, 2, 3},
+				PartOfParamsArrayMode: JSONArrayUnordered,
+			},
+		},
+		{
+			title: "method doesn't match",
+			body:  `{"jsonrpc": "2.0", "method": "eth_blockNumber", "id": 1}`,
+			rpc: JSONRPC{
+				Method: "eth_getBalance",
+			},
+			subjects: []string{"method"},
+		},
+		{
+			title: "params don't match",
+			body:  `{"jsonrpc": "2.0", "method": "eth_getBalance", "params": ["0x1", "latest"], "id": 1}`,
+			rpc: JSONRPC{
+				Params: []string{"0x1"},
+			},
+			subjects: []string{"params"},
+		},
+		{
+			title: "part of params doesn't match",
+			body:  `{"jsonrpc": "2.0", "method": "textDocument/hover", "params": {"position": {"line": 1}}, "id": 1}`,
+			rpc: JSONRPC{
+				PartOfParams: map[string]interface{}{
+					"position": map[string]interface{}{"line": 2},
+				},
+			},
+			subjects: []string{"params $.position.line"},
+		},
+		{
+			title:    "version",
+			body:     `{"jsonrpc": "1.0", "method": "sum", "id": 1}`,
+			rpc:      JSONRPC{Method: "sum"},
+			subjects: []string{"version"},
+		},
+		{
+			title:    "not JSON-RPC",
+			body:     `foo`,
+			rpc:      JSONRPC{Method: "sum"},
+			subjects: []string{"request"},
+		},
+	}
+
+	for _, d := range data {
+		d := d
+		t.Run(d.title, func(t *testing.T) {
+			mismatches, err := findJSONRPCMismatches(&http.Request{
+				Method: http.MethodPost,
+				Body:   io.NopCloser(strings.NewReader(d.body)),
+			}, &d.rpc)
+			require.NoError(t, err)
+			subjects := make([]string, len(mismatches))
+			for i, m := range mismatches {
+				subjects[i] = m.subject
+			}
+			if d.subjects == nil {
+				require.Empty(t, subjects)
+				return
+			}
+			require.Equal(t, d.subjects, subjects)
+		})
+	}
+}
+
+func TestJSONRPCResult(t *testing.T) {
+	data := []struct {
+		title      string
+		body       string
+		statusCode int
+		exp        string
+	}{
+		{
+			title:      "number id",
+			body:       `{"jsonrpc": "2.0", "method": "sum", "id": 1}`,
+			statusCode: http.StatusOK,
+			exp:        `{"jsonrpc": "2.0", "result": 6, "id": 1}`,
+		},
+		{
+			title:      "string id",
+			body:       `{"jsonrpc": "2.0", "method": "sum", "id": "a"}`,
+			statusCode: http.StatusOK,
+			exp:        `{"jsonrpc": "2.0", "result": 6, "id": "a"}`,
+		},
+		{
+			title:      "null id",
+			body:       `{"jsonrpc": "2.0", "method": "sum", "id": null}`,
+			statusCode: http.StatusOK,
+			exp:        `{"jsonrpc": "2.0", "result": 6, "id": null}`,
+		},
+		{
+			title:      "notification",
+			body:       `{"jsonrpc": "2.0", "method": "sum"}`,
+			statusCode: http.StatusNoContent,
+		},
+	}
+
+	for _, d := range data {
+		d := d
+		t.Run(d.title, func(t *testing.T) {
+			resp, err := createHTTPResponse(&http.Request{
+				Method: http.MethodPost,
+				Body:   io.NopCloser(strings.NewReader(d.body)),
+			}, JSONRPCResult(6))
+			require.NoError(t, err)
+			defer resp.Body.Close()
+			require.Equal(t, d.statusCode, resp.StatusCode)
+			b, err := io.ReadAll(resp.Body)
+			require.NoError(t, err)
+			if d.exp == "" {
+				require.Empty(t, b)
+				return
+			}
+			require.JSONEq(t, d.exp, string(b))
+		})
+	}
+}
+
+func Test_testJSONRPC(t *testing.T) {
+	tb := newFakeTB(t)
+	testJSONRPC(tb, &http.Request{
+		Method: http.MethodPost,
+		Body:   io.NopCloser(strings.NewReader(`{"jsonrpc": "2.0", "method": "eth_getBalance", "params": ["0x2", "latest"], "id": 1}`)),
+	}, Service{Endpoint: "http://example.com"}, Route{
+		Name: "get the balance",
+		Tester: Tester{
+			JSONRPC: &JSONRPC{
+				Params: []string{"0x1", "latest"},
+			},
+		},
+	})
+	errs := tb.Errors()
+	require.Len(t, errs, 1)
+	require.Contains(t, errs[0], `the JSON-RPC params should be ["0x1","latest"]`)
+	require.Contains(t, errs[0], `actual: ["0x2","latest"]`)
+}
+
+func Test_unmatchedJSONRPCCall(t *testing.T) {
+	data := []struct {
+		title string
+		op    string
+		exp   string
+	}{
+		{
+			title: "id is echoed",
+			op:    `{"jsonrpc": "2.0", "method": "foo", "id": "a"}`,
+			exp:   `{"jsonrpc": "2.0", "error": {"code": -32601, "message": "Method not found"}, "id": "a"}`,
+		},
+		{
+			title: "notification",
+			op:    `{"jsonrpc": "2.0", "method": "foo"}`,
+		},
+		{
+			title: "invalid request",
+			op:    `1`,
+			exp:   `{"jsonrpc": "2.0", "error": {"code": -32600, "message": "Invalid Request"}, "id": null}`,
+		},
+	}
+	for _, d := range data {
+		d := d
+		t.Run(d.title, func(t *testing.T) {
+			b := unmatchedJSONRPCCall(json.RawMessage(d.op))
+			if d.exp == "" {
+				require.Nil(t, b)
+				return
+			}
+			require.JSONEq(t, d.exp, string(b))
+		})
+	}
+}
@@ -2,7 +2,6 @@ package flute
 
 import (
 	"fmt"
-	"io"
 	"net/http"
 	"reflect"
 	"strings"
@@ -11,15 +10,24 @@ import (
 )
 
 // isMatchService returns whether the request matches with the service.
-// isMatchService checks the request URL.Scheme and URL.Host are equal to the service endpoint.
+// isMatchService checks the scheme, host, port, and path of the request URL match one of the service endpoints.
+// The invalid endpoints are skipped.
 func isMatchService(req *http.Request, service Service) bool {
-	return req.URL.Scheme+"://"+req.URL.Host == service.Endpoint
+	_, f, _ := matchService(req, service)
+	return f
 }
 
 type matchFunc func(req *http.Request, matcher Matcher) (bool, error)
 
 func matchPath(req *http.Request, matcher Matcher) (bool, error) {
-	return matcher.Path == "" || matcher.Path == req.URL.Path, nil
+	if matcher.Path == "" {
+		return true, nil
+	}
+	if !isPathPattern(matcher.Path) {
+		return matcher.Path == req.URL.Path, nil
+	}
+	_, f, err := matchPathPattern(matcher.Path, req.URL)
+	return f, err
 }
 
 func matchMethod(req *http.Request, matcher Matcher) (bool, error) {
@@ -34,20 +42,159 @@ func matchQuery(req *http.Request, matcher Matcher) (bool, error) {
 	return matcher.Query == nil || reflect.DeepEqual(matcher.Query, req.URL.Query()), nil
 }
 
-var matchFuncs = [...]matchFunc{ //nolint:gochecknoglobals
-	matchPath, matchMethod, matchBodyString, matchBodyJSON, matchBodyJSONString,
-	matchPartOfHeader, matchHeader, matchPartOfQuery, matchQuery,
+// condition is a condition of the matcher.
+type condition struct {
+	// isSet returns whether the matcher has the condition.
+	isSet func(matcher Matcher) bool
+	match matchFunc
+	// explain describes why the request doesn't meet the condition.
+	explain explainFunc
+}
+
+var conditions = [...]condition{ //nolint:gochecknoglobals
+	{
+		isSet:   func(m Matcher) bool { return m.Path != "" },
+		match:   matchPath,
+		explain: explainPath,
+	},
+	{
+		isSet:   func(m Matcher) bool { return m.Method != "" },
+		match:   matchMethod,
+		explain: explainMethod,
+	},
+	{
+		isSet:   func(m Matcher) bool { return m.BodyString != "" },
+		match:   matchBodyString,
+		explain: explainBodyString,
+	},
+	{
+		isSet:   func(m Matcher) bool { return m.BodyJSON != nil },
+		match:   matchBodyJSON,
+		explain: explainBodyJSON,
+	},
+	{
+		isSet:   func(m Matcher) bool { return m.BodyJSONString != "" },
+		match:   matchBodyJSONString,
+		explain: explainBodyJSONString,
+	},
+	{
+		isSet:   func(m Matcher) bool { return m.BodyXML != nil || m.BodyXMLString != "" },
+		match:   matchBodyXML,
+		explain: explainBodyXML,
+	},
+	{
+		isSet:   func(m Matcher) bool { return m.SOAPAction != "" },
+		match:   matchSOAPAction,
+		explain: explainSOAPAction,
+	},
+	{
+		isSet:   func(m Matcher) bool { return m.SOAPOperation != "" },
+		match:   matchSOAPOperation,
+		explain: explainSOAPOperation,
+	},
+	{
+		isSet:   func(m Matcher) bool { return m.Auth != nil },
+		match:   matchAuth,
+		explain: explainAuth,
+	},
+	{
+		isSet:   func(m Matcher) bool { return m.Cookie != nil },
+		match:   matchCookie,
+		explain: explainCookie,
+	},
+	{
+		isSet:   func(m Matcher) bool { return len(m.AbsentCookies) != 0 },
+		match:   matchAbsentCookies,
+		explain: explainAbsentCookies,
+	},
+	{
+		isSet:   func(m Matcher) bool { return m.JSONRPC != nil },
+		match:   matchJSONRPC,
+		explain: explainJSONRPC,
+	},
+	{
+		isSet:   func(m Matcher) bool { return m.GraphQL != nil },
+		match:   matchGraphQL,
+		explain: explainGraphQL,
+	},
+	{
+		isSet:   func(m Matcher) bool { return len(m.PartOfHeader) != 0 },
+		match:   matchPartOfHeader,
+		explain: explainPartOfHeader,
+	},
+	{
+		isSet:   func(m Matcher) bool { return m.Header != nil },
+		match:   matchHeader,
+		explain: explainHeader,
+	},
+	{
+		isSet:   func(m Matcher) bool { return len(m.PartOfQuery) != 0 },
+		match:   matchPartOfQuery,
+		explain: explainPartOfQuery,
+	},
+	{
+		isSet:   func(m Matcher) bool { return m.Query != nil },
+		match:   matchQuery,
+		explain: explainQuery,
+	},
+	{
+		isSet:   func(m Matcher) bool { return len(m.PartOfForm) != 0 },
+		match:   matchPartOfForm,
+		explain: explainPartOfForm,
+	},
+	{
+		isSet:   func(m Matcher) bool { return m.Form != nil },
+		match:   matchForm,
+		explain: explainForm,
+	},
+	{
+		isSet:   func(m Matcher) bool { return m.Multipart != nil },
+		match:   matchMultipart,
+		explain: explainMultipart,
+	},
+	{
+		isSet:   func(m Matcher) bool { return m.PathMatcher != nil },
+		match:   matchPathMatcher,
+		explain: explainPathMatcher,
+	},
+	{
+		isSet:   func(m Matcher) bool { return len(m.HeaderMatcher) != 0 },
+		match:   matchHeaderMatcher,
+		explain: explainHeaderMatcher,
+	},
+	{
+		isSet:   func(m Matcher) bool { return len(m.QueryMatcher) != 0 },
+		match:   matchQueryMatcher,
+		explain: explainQueryMatcher,
+	},
+	{
+		isSet:   func(m Matcher) bool { return m.PartOfBodyJSON != nil || m.PartOfBodyJSONString != "" },
+		match:   matchPartOfBodyJSON,
+		explain: explainPartOfBodyJSON,
+	},
+	{
+		isSet:   func(m Matcher) bool { return len(m.BodyJSONExprs) != 0 },
+		match:   matchBodyJSONExprs,
+		explain: explainBodyJSONExprs,
+	},
+	{
+		isSet:   func(m Matcher) bool { return m.Condition != nil },
+		match:   matchCondition,
+		explain: explainCondition,
+	},
 }
 
 // isMatch returns whether the request matches with the matcher.
 // If the matcher has multiple conditions, IsMatch returns true if the request meets all conditions.
 func isMatch(req *http.Request, matcher Matcher) (bool, error) {
-	for _, match := range matchFuncs {
-		if f, err := match(req, matcher); err != nil || !f {
+	for _, cond := range conditions {
+		if f, err := cond.match(req, matcher); err != nil || !f {
 			return f, err
 		}
 	}
 	if matcher.Match != nil {
+		// Match gets the body from the beginning even if a condition such as Condition has read it
+		rewindBody(req)
 		f, err := matcher.Match(req)
 		if err != nil || !f {
 			return f, err
@@ -90,6 +237,50 @@ func matchPartOfQuery(req *http.Request, matcher Matcher) (bool, error) {
 	return true, nil
 }
 
+func matchForm(req *http.Request, matcher Matcher) (bool, error) {
+	if matcher.Form == nil {
+		return true, nil
+	}
+	form, err := matchableForm(req)
+	if err != nil || form == nil {
+		return false, err
+	}
+	return reflect.DeepEqual(matcher.Form, form), nil
+}
+
+func matchPartOfForm(req *http.Request, matcher Matcher) (bool, error) {
+	if matcher.PartOfForm == nil {
+		return true, nil
+	}
+	form, err := matchableForm(req)
+	if err != nil || form == nil {
+		return false, err
+	}
+	for k, v := range matcher.PartOfForm {
+		a, ok := form[k]
+		if !ok {
+			return false, nil
+		}
+		if v != nil {
+			if !reflect.DeepEqual(a, v) {
+				return false, nil
+			}
+		}
+	}
+	return true, nil
+}
+
+func matchMultipart(req *http.Request, matcher Matcher) (bool, error) {
+	if matcher.Multipart == nil {
+		return true, nil
+	}
+	mismatches, err := findMultipartMismatches(req, matcher.Multipart)
+	if err != nil {
+		return false, err
+	}
+	return len(mismatches) == 0, nil
+}
+
 func matchBodyString(req *http.Request, matcher Matcher) (bool, error) {
 	if matcher.BodyString == "" {
 		return true, nil
@@ -97,7 +288,7 @@ func matchBodyString(req *http.Request, matcher Matcher) (bool, error) {
 	if req.Body == nil {
 		return false, nil
 	}
-	b, err := io.ReadAll(req.Body)
+	b, err := readBody(req)
 	if err != nil {
 		return false, fmt.Errorf("failed to read the request body: %w", err)
 	}
@@ -111,7 +302,7 @@ func matchBodyJSONString(req *http.Request, matcher Matcher) (bool, error) {
 	if req.Body == nil {
 		return false, nil
 	}
-	b, err := io.ReadAll(req.Body)
+	b, err := readBody(req)
 	if err != nil {
 		return false, fmt.Errorf("failed to read the request body: %w", err)
 	}
@@ -125,9 +316,136 @@ func matchBodyJSON(req *http.Request, matcher Matcher) (bool, error) {
 	if req.Body == nil {
 		return false, nil
 	}
-	b, err := io.ReadAll(req.Body)
+	b, err := readBody(req)
 	if err != nil {
 		return false, fmt.Errorf("failed to read the request body: %w", err)
 	}
 	return dataeq.JSON.Equal(b, matcher.BodyJSON)
 }
+
+func matchPathMatcher(req *http.Request, matcher Matcher) (bool, error) {
+	return matcher.PathMatcher == nil || matcher.PathMatcher.MatchValue(req.URL.Path), nil
+}
+
+func matchHeaderMatcher(req *http.Request, matcher Matcher) (bool, error) {
+	if matcher.HeaderMatcher == nil {
+		return true, nil
+	}
+	return len(findValueMismatches(matcher.HeaderMatcher, headerValues(req))) == 0, nil
+}
+
+func matchQueryMatcher(req *http.Request, matcher Matcher) (bool, error) {
+	if matcher.QueryMatcher == nil {
+		return true, nil
+	}
+	return len(findValueMismatches(matcher.QueryMatcher, queryValues(req))) == 0, nil
+}
+
+func matchCondition(req *http.Request, matcher Matcher) (bool, error) {
+	if matcher.Condition == nil {
+		return true, nil
+	}
+	return matcher.Condition.MatchRequest(req)
+}
+
+func matchPartOfBodyJSON(req *http.Request, matcher Matcher) (bool, error) {
+	expected, err := partOfBodyJSON(matcher.PartOfBodyJSON, matcher.PartOfBodyJSONString)
+	if err != nil || expected == nil {
+		return err == nil, err
+	}
+	m, err := findPartOfBodyJSONMismatch(req, expected, matcher.PartOfBodyJSONArrayMode)
+	if err != nil {
+		return false, err
+	}
+	return m == nil, nil
+}
+
+func matchBodyJSONExprs(req *http.Request, matcher Matcher) (bool, error) {
+	if len(matcher.BodyJSONExprs) == 0 {
+		return true, nil
+	}
+	failures, err := findJSONExprFailures(req, matcher.BodyJSONExprs)
+	if err != nil {
+		return false, err
+	}
+	return len(failures) == 0, nil
+}
+
+func matchBodyXML(req *http.Request, matcher Matcher) (bool, error) {
+	expected, err := bodyXML(matcher.BodyXML, matcher.BodyXMLString)
+	if err != nil || expected == nil {
+		return err == nil, err
+	}
+	if req.Body == nil {
+		return false, nil
+	}
+	b, err := readBody(req)
+	if err != nil {
+		return false, fmt.Errorf("failed to read the request body: %w", err)
+	}
+	return equalXML(expected, b)
+}
+
+func matchSOAPAction(req *http.Request, matcher Matcher) (bool, error) {
+	return matcher.SOAPAction == "" || matcher.SOAPAction == soapAction(req), nil
+}
+
+func matchSOAPOperation(req *http.Request, matcher Matcher) (bool, error) {
+	if matcher.SOAPOperation == "" {
+		return true, nil
+	}
+	if req.Body == nil {
+		return false, nil
+	}
+	b, err := readBody(req)
+	if err != nil {
+		return false, fmt.Errorf("failed to read the request body: %w", err)
+	}
+	op, err := soapOperation(b)
+	if err != nil {
+		// the request isn't a SOAP request
+		return false, nil //nolint:nilerr
+	}
+	return matchSOAPOperationName(matcher.SOAPOperation, op), nil
+}
+
+func matchGraphQL(req *http.Request, matcher Matcher) (bool, error) {
+	if matcher.GraphQL == nil {
+		return true, nil
+	}
+	mismatches, err := findGraphQLMismatches(req, matcher.GraphQL)
+	if err != nil {
+		return false, err
+	}
+	return len(mismatches) == 0, nil
+}
+
+func matchJSONRPC(req *http.Request, matcher Matcher) (bool, error) {
+	if matcher.JSONRPC == nil {
+		return true, nil
+	}
+	mismatches, err := findJSONRPCMismatches(req, matcher.JSONRPC)
+	if err != nil {
+		return false, err
+	}
+	return len(mismatches) == 0, nil
+}
+
+func matchCookie(req *http.Request, matcher Matcher) (bool, error) {
+	if matcher.Cookie == nil {
+		return true, nil
+	}
+	return len(findValueMismatches(matcher.Cookie, cookieValues(req))) == 0, nil
+}
+
+func matchAbsentCookies(req *http.Request, matcher Matcher) (bool, error) {
+	return len(findPresentCookies(req, matcher.AbsentCookies)) == 0, nil
+}
+
+func matchAuth(req *http.Request, matcher Matcher) (bool, error) {
+	f, err := findAuthFailure(req, matcher.Auth)
+	if err != nil {
+		return false, err
+	}
+	return f == nil, nil
+}
@@ -10,13 +10,16 @@ import (
 	"github.com/stretchr/testify/require"
 )
 
-func Test_isMatchService(t *testing.T) {
+func Test_isMatchService(t *testing.T) { //nolint:funlen
 	data := []struct {
-		title    string
-		scheme   string
-		host     string
-		endpoint string
-		exp      bool
+		title       string
+		scheme      string
+		host        string
+		path        string
+		endpoint    string
+		endpoints   []string
+		hostMatcher ValueMatcher
+		exp         bool
 	}{
 		{
 			title:    "normal",
@@ -25,6 +28,118 @@ func Test_isMatchService(t *testing.T) {
 			endpoint: "http://example.com",
 			exp:      true,
 		},
+		{
+			title:    "host doesn't match",
+			scheme:   "http",
+			host:     "example.org",
+			endpoint: "http://example.com",
+		},
+		{
+			title:    "scheme doesn't match",
+			scheme:   "http",
+			host:     "example.com",
+			endpoint: "https://example.com",
+		},
+		{
+			title:    "default port of the request",
+			scheme:   "https",
+			host:     "api.example.com:443",
+			endpoint: "https://api.example.com",
+			exp:      true,
+		},
+		{
+			title:    "default port of the endpoint",
+			scheme:   "http",
+			host:     "example.com",
+			endpoint: "http://example.com:80",
+			exp:      true,
+		},
+		{
+			title:    "port doesn't match",
+			scheme:   "http",
+			host:     "example.com:8080",
+			endpoint: "http://example.com",
+		},
+		{
+			title:    "case insensitive host",
+			scheme:   "http",
+			host:     "Example.COM",
+			endpoint: "http://example.com",
+			exp:      true,
+		},
+		{
+			title:    "base path",
+			scheme:   "https",
+			host:     "example.com",
+			path:     "/api/v2/users",
+			endpoint: "https://example.com/api/v2",
+			exp:      true,
+		},
+		{
+			title:    "base path with the trailing slash",
+			scheme:   "https",
+			host:     "example.com",
+			path:     "/api/v2",
+			endpoint: "https://example.com/api/v2/",
+			exp:      true,
+		},
+		{
+			title:    "base path doesn't match a partial segment",
+			scheme:   "https",
+			host:     "example.com",
+			path:     "/api/v20/users",
+			endpoint: "https://example.com/api/v2",
+		},
+		{
+			title:    "wildcard host",
+			scheme:   "https",
+			host:     "my-bucket.s3.amazonaws.com",
+			endpoint: "https://*.s3.amazonaws.com",
+			exp:      true,
+		},
+		{
+			title:    "wildcard matches only a single label",
+			scheme:   "https",
+			host:     "a.b.s3.amazonaws.com",
+			endpoint: "https://*.s3.amazonaws.com",
+		},
+		{
+			title:       "host matcher",
+			scheme:      "https",
+			host:        "my.bucket.s3.amazonaws.com",
+			endpoint:    "https://*",
+			hostMatcher: Regexp(`^[a-z0-9.-]+\.s3\.amazonaws\.com$`),
+			exp:         true,
+		},
+		{
+			title:       "host matcher doesn't match",
+			scheme:      "https",
+			host:        "example.com",
+			endpoint:    "https://*",
+			hostMatcher: Regexp(`^[a-z0-9.-]+\.s3\.amazonaws\.com$`),
+		},
+		{
+			title:     "additional endpoint",
+			scheme:    "http",
+			host:      "localhost:8080",
+			endpoint:  "https://example.com",
+			endpoints: []string{"http://localhost:8080"},
+			exp:       true,
+		},
+		{
+			title:    "invalid endpoint",
+			scheme:   "http",
+			host:     "example.com",
+			endpoint: "example.com",
+		},
+		{
+			title:     "invalid endpoint is skipped",
+			scheme:    "http",
+			host:      "localhost:8080",
+			endpoint:  "example.com",
+			endpoints: []string{"http://localhost:8080"},
+			exp:       true,
+		},
 	}
 
 	for _, d := range data {
@@ -34,9 +149,12 @@ func Test_isMatchService(t *testing.T) {
 				URL: &url.URL{
 					Scheme: d.scheme,
 					Host:   d.host,
+					Path:   d.path,
 				},
 			}, Service{
-				Endpoint: d.endpoint,
+				Endpoint:    d.endpoint,
+				Endpoints:   d.endpoints,
+				HostMatcher: d.hostMatcher,
 			})
 			if d.exp {
 				require.True(t, b)
@@ -116,6 +234,25 @@ func Test_isMatch(t *testing.T) { //nolint:funlen
 				BodyJSONString: `"bar"`,
 			},
 		},
+		{
+			title: "part of body json matches",
+			req: &http.Request{
+				Body: io.NopCloser(strings.NewReader(`{"id": "generated", "name": "foo"}`)),
+			},
+			matcher: Matcher{
+				PartOfBodyJSONString: `{"name": "foo"}`,
+			},
+			exp: true,
+		},
+		{
+			title: "part of body json doesn't match",
+			req: &http.Request{
+				Body: io.NopCloser(strings.NewReader(`{"id": "generated", "name": "foo"}`)),
+			},
+			matcher: Matcher{
+				PartOfBodyJSON: map[string]interface{}{"name": "bar"},
+			},
+		},
 		{
 			title: "header doesn't match",
 			req: &http.Request{
@@ -0,0 +1,236 @@
+package flute
+
+import (
+	"bytes"
+	"crypto/sha256"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"io"
+	"mime"
+	"mime/multipart"
+	"net/http"
+	"net/url"
+	"reflect"
+	"sort"
+	"strings"
+)
+
+type (
+	// Multipart has the conditions of the multipart/form-data request body.
+	Multipart struct {
+		// Fields are the parts without the filename by the form name.
+		// If the field value is nil, RoundTrip checks whether the field is included in the request.
+		// Otherwise, RoundTrip also checks whether the values are equal.
+		Fields url.Values
+		// Files are the file parts by the form name.
+		// If the form has multiple files, one of them must meet the conditions.
+		Files map[string]MultipartFile
+		// PartCount is the number of all parts.
+		// If PartCount is zero, the number of parts isn't checked.
+		PartCount int
+	}
+
+	// MultipartFile has the conditions of the file part.
+	// The empty parameters aren't checked.
+	MultipartFile struct {
+		// Filename is the filename of the Content-Disposition header.
+		Filename string
+		// ContentType is the Content-Type header of the part.
+		ContentType string
+		// Content is the content of the file.
+		Content []byte
+		// SHA256 is the hex encoded SHA-256 hash of the content.
+		// SHA256 is useful for the large file.
+		SHA256 string
+	}
+
+	// multipartPart is the parsed part of the request body.
+	multipartPart struct {
+		formName    string
+		filename    string
+		contentType string
+		content     []byte
+	}
+
+	// multipartMismatch is the condition of Multipart which the request doesn't meet.
+	multipartMismatch struct {
+		// subject is the checked target such as `field "name"`.
+		subject  string
+		expected string
+		actual   string
+	}
+)
+
+func (m multipartMismatch) String() string {
+	return fmt.Sprintf("the request multipart %s should be %s\nactual: %s", m.subject, m.expected, m.actual)
+}
+
+// readMultipart parses the request body as multipart/form-data.
+// If the request isn't multipart/form-data, readMultipart returns a mismatch.
+func readMultipart(req *http.Request) ([]multipartPart, *multipartMismatch, error) {
+	contentType := req.Header.Get("Content-Type")
+	mediaType, params, err := mime.ParseMediaType(contentType)
+	if err != nil || mediaType != "multipart/form-data" || params["boundary"] == "" {
+		return nil, &multipartMismatch{
+			subject:  "Content-Type",
+			expected: `"multipart/form-data" with the boundary`,
+			actual:   fmt.Sprintf("%q", contentType),
+		}, nil
+	}
+	if req.Body == nil {
+		return nil, &multipartMismatch{
+			subject:  "body",
+			expected: "present",
+			actual:   "no body",
+		}, nil
+	}
+	b, err := readBody(req)
+	if err != nil {
+		return nil, nil, fmt.Errorf("failed to read the request body: %w", err)
+	}
+	reader := multipart.NewReader(bytes.NewReader(b), params["boundary"])
+	var parts []multipartPart
+	for {
+		part, err := reader.NextPart()
+		if errors.Is(err, io.EOF) {
+			return parts, nil, nil
+		}
+		if err != nil {
+			return nil, nil, fmt.Errorf("failed to parse the request body as multipart: %w", err)
+		}
+		content, err := io.ReadAll(part)
+		if err != nil {
+			return nil, nil, fmt.Errorf("failed to read the multipart part: %w", err)
+		}
+		parts = append(parts, multipartPart{
+			formName:    part.FormName(),
+			filename:    part.FileName(),
+			contentType: part.Header.Get("Content-Type"),
+			content:     content,
+		})
+	}
+}
+
+func describeContent(b []byte) string {
+	h := sha256.Sum256(b)
+	return fmt.Sprintf("%d bytes (sha256: %s)", len(b), hex.EncodeToString(h[:]))
+}
+
+// check returns the conditions which the file part doesn't meet.
+func (f MultipartFile) check(name string, part multipartPart) []multipartMismatch {
+	var mismatches []multipartMismatch
+	if f.Filename != "" && f.Filename != part.filename {
+		mismatches = append(mismatches, multipartMismatch{
+			subject:  fmt.Sprintf("file %q filename", name),
+			expected: fmt.Sprintf("%q", f.Filename),
+			actual:   fmt.Sprintf("%q", part.filename),
+		})
+	}
+	if f.ContentType != "" && f.ContentType != part.contentType {
+		mismatches = append(mismatches, multipartMismatch{
+			subject:  fmt.Sprintf("file %q Content-Type", name),
+			expected: fmt.Sprintf("%q", f.ContentType),
+			actual:   fmt.Sprintf("%q", part.contentType),
+		})
+	}
+	if f.Content != nil && !bytes.Equal(f.Content, part.content) {
+		mismatches = append(mismatches, multipartMismatch{
+			subject:  fmt.Sprintf("file %q content", name),
+			expected: describeContent(f.Content),
+			actual:   describeContent(part.content),
+		})
+	}
+	if f.SHA256 != "" {
+		h := sha256.Sum256(part.content)
+		if a := hex.EncodeToString(h[:]); !strings.EqualFold(f.SHA256, a) {
+			mismatches = append(mismatches, multipartMismatch{
+				subject:  fmt.Sprintf("file %q SHA-256", name),
+				expected: f.SHA256,
+				actual:   a,
+			})
+		}
+	}
+	return mismatches
+}
+
+// findMultipartMismatches returns the conditions of Multipart which the request doesn't meet.
+func findMultipartMismatches(req *http.Request, m *Multipart) ([]multipartMismatch, error) {
+	parts, mm, err := readMultipart(req)
+	if err != nil {
+		return nil, err
+	}
+	if mm != nil {
+		return []multipartMismatch{*mm}, nil
+	}
+	var mismatches []multipartMismatch
+
+	fields := url.Values{}
+	files := map[string][]multipartPart{}
+	for _, part := range parts {
+		if part.filename == "" {
+			fields[part.formName] = append(fields[part.formName], string(part.content))
+			continue
+		}
+		files[part.formName] = append(files[part.formName], part)
+	}
+
+	for _, k := range sortedKeys(m.Fields) {
+		v := m.Fields[k]
+		a, ok := fields[k]
+		if !ok {
+			mismatches = append(mismatches, multipartMismatch{
+				subject:  fmt.Sprintf("field %q", k),
+				expected: "present",
+				actual:   "missing",
+			})
+			continue
+		}
+		if v != nil && !reflect.DeepEqual(v, a) {
+			mismatches = append(mismatches, multipartMismatch{
+				subject:  fmt.Sprintf("field %q", k),
+				expected: fmt.Sprintf("%q", v),
+				actual:   fmt.Sprintf("%q", a),
+			})
+		}
+	}
+
+	names := make([]string, 0, len(m.Files))
+	for k := range m.Files {
+		names = append(names, k)
+	}
+	sort.Strings(names)
+	for _, name := range names {
+		candidates, ok := files[name]
+		if !ok {
+			mismatches = append(mismatches, multipartMismatch{
+				subject:  fmt.Sprintf("file %q", name),
+				expected: "present",
+				actual:   "missing",
+			})
+			continue
+		}
+		// report the mismatches of the first file if no file meets the conditions
+		var first []multipartMismatch
+		for i, part := range candidates {
+			ms := m.Files[name].check(name, part)
+			if len(ms) == 0 {
+				first = nil
+				break
+			}
+			if i == 0 {
+				first = ms
+			}
+		}
+		mismatches = append(mismatches, first...)
+	}
+
+	if m.PartCount != 0 && m.PartCount != len(parts) {
+		mismatches = append(mismatches, multipartMismatch{
+			subject:  "part count",
+			expected: fmt.Sprintf("%d", m.PartCount),
+			actual:   fmt.Sprintf("%d", len(parts)),
+		})
+	}
+	return mismatches, nil
+}
@@ -0,0 +1,152 @@
+package flute
+
+import (
+	"bytes"
+	"crypto/sha256"
+	"encoding/hex"
+	"io"
+	"mime/multipart"
+	"net/http"
+	"net/textproto"
+	"net/url"
+	"testing"
+
+	"github.com/stretchr/testify/require"
+)
+
+func newMultipartRequest(t *testing.T) *http.Request {
+	t.Helper()
+	buf := &bytes.Buffer{}
+	w := multipart.NewWriter(buf)
+	require.NoError(t, w.WriteField("title", "holiday"))
+	require.NoError(t, w.WriteField("tags", "beach"))
+	require.NoError(t, w.WriteField("tags", "sea"))
+	h := textproto.MIMEHeader{}
+	h.Set("Content-Disposition", `form-data; name="file"; filename="photo.png"`)
+	h.Set("Content-Type", "image/png")
+	part, err := w.CreatePart(h)
+	require.NoError(t, err)
+	_, err = part.Write([]byte("PNG DATA"))
+	require.NoError(t, err)
+	require.NoError(t, w.Close())
+	return &http.Request{
+		Header: http.Header{
+			"Content-Type": []string{w.FormDataContentType()},
+		},
+		Body: io.NopCloser(buf),
+	}
+}
+
+func Test_findMultipartMismatches(t *testing.T) { //nolint:funlen
+	hash := sha256.Sum256([]byte("PNG DATA"))
+	jpegHash := sha256.Sum256([]byte("JPEG"))
+	data := []struct {
+		title     string
+		req       *http.Request
+		multipart *Multipart
+		exp       []multipartMismatch
+	}{
+		{
+			title: "all conditions are met",
+			multipart: &Multipart{
+				Fields: url.Values{
+					"title": []string{"holiday"},
+					"tags":  nil,
+				},
+				Files: map[string]MultipartFile{
+					"file": {
+						Filename:    "photo.png",
+						ContentType: "image/png",
+						Content:     []byte("PNG DATA"),
+						SHA256:      hex.EncodeToString(hash[:]),
+					},
+				},
+				PartCount: 4,
+			},
+		},
+		{
+			title: "conditions aren't met",
+			multipart: &Multipart{
+				Fields: url.Values{
+					"title":       []string{"work"},
+					"description": nil,
+				},
+				Files: map[string]MultipartFile{
+					"file": {
+						Filename:    "photo.jpg",
+						ContentType: "image/jpeg",
+					},
+					"thumbnail": {},
+				},
+				PartCount: 3,
+			},
+			exp: []multipartMismatch{
+				{subject: `field "description"`, expected: "present", actual: "missing"},
+				{subject: `field "title"`, expected: `["work"]`, actual: `["holiday"]`},
+				{subject: `file "file" filename`, expected: `"photo.jpg"`, actual: `"photo.png"`},
+				{subject: `file "file" Content-Type`, expected: `"image/jpeg"`, actual: `"image/png"`},
+				{subject: `file "thumbnail"`, expected: "present", actual: "missing"},
+				{subject: "part count", expected: "3", actual: "4"},
+			},
+		},
+		{
+			title: "content doesn't match",
+			multipart: &Multipart{
+				Files: map[string]MultipartFile{
+					"file": {
+						Content: []byte("JPEG"),
+					},
+				},
+			},
+			exp: []multipartMismatch{
+				{
+					subject:  `file "file" content`,
+					expected: "4 bytes (sha256: " + hex.EncodeToString(jpegHash[:]) + ")",
+					actual:   "8 bytes (sha256: " + hex.EncodeToString(hash[:]) + ")",
+				},
+			},
+		},
+		{
+			title: "not multipart",
+			req: &http.Request{
+				Header: http.Header{
+					"Content-Type": []string{"application/json"},
+				},
+			},
+			multipart: &Multipart{},
+			exp: []multipartMismatch{
+				{subject: "Content-Type", expected: `"multipart/form-data" with the boundary`, actual: `"application/json"`},
+			},
+		},
+	}
+
+	for _, d := range data {
+		d := d
+		t.Run(d.title, func(t *testing.T) {
+			req := d.req
+			if req == nil {
+				req = newMultipartRequest(t)
+			}
+			mismatches, err := findMultipartMismatches(req, d.multipart)
+			require.NoError(t, err)
+			require.Equal(t, d.exp, mismatches)
+		})
+	}
+}
+
+func Test_testMultipart(t *testing.T) {
+	tb := newFakeTB(t)
+	testMultipart(tb, newMultipartRequest(t), Service{Endpoint: "http://example.com"}, Route{
+		Name: "upload a photo",
+		Tester: Tester{
+			Multipart: &Multipart{
+				Files: map[string]MultipartFile{
+					"file": {Filename: "photo.jpg"},
+				},
+			},
+		},
+	})
+	errs := tb.Errors()
+	require.Len(t, errs, 1)
+	require.Contains(t, errs[0], `the request multipart file "file" filename should be "photo.jpg"`)
+}
@@ -0,0 +1,162 @@
+package flute
+
+import (
+	"fmt"
+	"strings"
+	"sync"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+type (
+	// Order is an ordered list of routes which the client should call in the order.
+	// A route in Order should be called only after all previous routes in Order are called at least once.
+	// Routes can belong to different services, and a route can appear in Order more than once.
+	// Order records the calls, so an Order shouldn't be shared by multiple transports.
+	Order struct {
+		// Name is embedded the assertion and useful to specify which order fails.
+		Name string
+		// Routes are the routes in the expected order.
+		Routes   []RouteRef
+		called   []bool
+		observed []string
+		mutex    sync.Mutex
+	}
+
+	// RouteRef refers to a route by the service endpoint and the route name.
+	RouteRef struct {
+		// If Endpoint is empty, the route of any service is referred to.
+		Endpoint string
+		Name     string
+	}
+)
+
+// String returns the description of the route such as "http://example.com create a user".
+func (ref RouteRef) String() string {
+	if ref.Endpoint == "" {
+		return ref.Name
+	}
+	return ref.Endpoint + " " + ref.Name
+}
+
+func (ref RouteRef) refers(service Service, route Route) bool {
+	return ref.Name == route.Name && (ref.Endpoint == "" || ref.Endpoint == service.Endpoint)
+}
+
+// Reset clears the recorded calls.
+func (order *Order) Reset() {
+	order.mutex.Lock()
+	order.called = nil
+	order.observed = nil
+	order.mutex.Unlock()
+}
+
+// call records the call of the route.
+// If the route is called out of order, call returns the message which describes the expected and observed order.
+// If the route isn't in the order, call does nothing and returns an empty string.
+// The call is assigned to the first position of the route which isn't called yet.
+// If the route has already been called and the positions before that one aren't called yet,
+// the call is regarded as a repeat and isn't assigned to any position.
+func (order *Order) call(service Service, route Route) string {
+	order.mutex.Lock()
+	defer order.mutex.Unlock()
+	if order.called == nil {
+		order.called = make([]bool, len(order.Routes))
+	}
+	idx := -1
+	first := -1
+	repeated := false
+	for i, ref := range order.Routes {
+		if !ref.refers(service, route) {
+			continue
+		}
+		if first < 0 {
+			first = i
+		}
+		if order.called[i] {
+			repeated = true
+			continue
+		}
+		if idx < 0 {
+			idx = i
+		}
+	}
+	if first < 0 {
+		return ""
+	}
+	order.observed = append(order.observed, order.Routes[first].String())
+	if idx < 0 {
+		return ""
+	}
+	skipped := order.firstUncalled(idx)
+	if skipped >= 0 && repeated {
+		return ""
+	}
+	order.called[idx] = true
+	if skipped < 0 {
+		return ""
+	}
+	return fmt.Sprintf("the route %s should be called first, but the route %s is called before it\n%s",
+		order.Routes[skipped], order.Routes[idx], order.describe())
+}
+
+// firstUncalled returns the index of the first route before idx which isn't called yet, or -1.
+func (order *Order) firstUncalled(idx int) int {
+	for i := 0; i < idx; i++ {
+		if !order.called[i] {
+			return i
+		}
+	}
+	return -1
+}
+
+// unfinished returns the message which describes the routes not called yet.
+// If all routes in the order are called, unfinished returns an empty string.
+func (order *Order) unfinished() string {
+	order.mutex.Lock()
+	defer order.mutex.Unlock()
+	var notCalled []string
+	for i, ref := range order.Routes {
+		if order.called == nil || !order.called[i] {
+			notCalled = append(notCalled, ref.String())
+		}
+	}
+	if len(notCalled) == 0 {
+		return ""
+	}
+	return fmt.Sprintf("the order isn't finished, the following routes aren't called: %s\n%s",
+		strings.Join(notCalled, ", "), order.describe())
+}
+
+// describe returns the name and the expected and observed orders.
+func (order *Order) describe() string {
+	expected := make([]string, len(order.Routes))
+	for i, ref := range order.Routes {
+		expected[i] = ref.String()
+	}
+	return fmt.Sprintf(`order: %s
+expected order: %s
+observed order: %s`,
+		order.Name, strings.Join(expected, " -> "), strings.Join(order.observed, " -> "))
+}
+
+// checkOrders records the call of the route and reports the route called out of order.
+func (transport Transport) checkOrders(service Service, route Route) {
+	for _, order := range transport.Orders {
+		msg := order.call(service, route)
+		if msg == "" || transport.T == nil {
+			continue
+		}
+		assert.Fail(transport.T, makeMsg(msg, service.Endpoint, route.Name))
+	}
+}
+
+// verifyOrders reports the orders whose routes aren't all called.
+func (transport Transport) verifyOrders(t testing.TB) {
+	for _, order := range transport.Orders {
+		if msg := order.unfinished(); msg != "" {
+			assert.Fail(t, msg)
+		}
+	}
+}
@@ -0,0 +1,152 @@
+package flute
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/require"
+)
+
+func TestOrder_call(t *testing.T) { //nolint:funlen
+	auth := Service{Endpoint: "http://auth.example.com"}
+	api := Service{Endpoint: "http://api.example.com"}
+	data := []struct {
+		title string
+		calls []RouteRef
+		exp   []string
+	}{
+		{
+			title: "in order",
+			calls: []RouteRef{
+				{Endpoint: auth.Endpoint, Name: "issue a token"},
+				{Endpoint: api.Endpoint, Name: "upload"},
+				{Endpoint: api.Endpoint, Name: "commit"},
+				{Endpoint: api.Endpoint, Name: "upload"},
+			},
+			exp: []string{"", "", "", ""},
+		},
+		{
+			title: "route not in the order is ignored",
+			calls: []RouteRef{
+				{Endpoint: api.Endpoint, Name: "get a user"},
+				{Endpoint: api.Endpoint, Name: "issue a token"},
+			},
+			exp: []string{"", ""},
+		},
+		{
+			title: "out of order",
+			calls: []RouteRef{
+				{Endpoint: auth.Endpoint, Name: "issue a token"},
+				{Endpoint: api.Endpoint, Name: "commit"},
+			},
+			exp: []string{
+				"",
+				`the route upload should be called first, but the route commit is called before it
+order: upload
+expected order: http://auth.example.com issue a token -> upload -> commit
+observed order: http://auth.example.com issue a token -> commit`,
+			},
+		},
+	}
+
+	for _, d := range data {
+		d := d
+		t.Run(d.title, func(t *testing.T) {
+			order := &Order{
+				Name: "upload",
+				Routes: []RouteRef{
+					{Endpoint: auth.Endpoint, Name: "issue a token"},
+					{Name: "upload"},
+					{Name: "commit"},
+				},
+			}
+			for i, ref := range d.calls {
+				require.Equal(t, d.exp[i], order.call(Service{Endpoint: ref.Endpoint}, Route{Name: ref.Name}))
+			}
+			order.Reset()
+			require.Nil(t, order.observed)
+		})
+	}
+}
+
+func TestOrder_call_repeatedRoute(t *testing.T) {
+	data := []struct {
+		title      string
+		calls      []string
+		exp        []string
+		unfinished string
+	}{
+		{
+			title: "in order",
+			calls: []string{"list", "update", "list"},
+			exp:   []string{"", "", ""},
+		},
+		{
+			title: "repeat the first call",
+			calls: []string{"list", "list", "update", "list"},
+			exp:   []string{"", "", "", ""},
+		},
+		{
+			title: "the last call is missing",
+			calls: []string{"list", "update"},
+			exp:   []string{"", ""},
+			unfinished: `the order isn't finished, the following routes aren't called: list
+order: update
+expected order: list -> update -> list
+observed order: list -> update`,
+		},
+		{
+			title: "out of order",
+			calls: []string{"update", "list"},
+			exp: []string{
+				`the route list should be called first, but the route update is called before it
+order: update
+expected order: list -> update -> list
+observed order: update`,
+				"",
+			},
+			unfinished: `the order isn't finished, the following routes aren't called: list
+order: update
+expected order: list -> update -> list
+observed order: update -> list`,
+		},
+	}
+
+	for _, d := range data {
+		d := d
+		t.Run(d.title, func(t *testing.T) {
+			order := &Order{
+				Name: "update",
+				Routes: []RouteRef{
+					{Name: "list"},
+					{Name: "update"},
+					{Name: "list"},
+				},
+			}
+			for i, name := range d.calls {
+				require.Equal(t, d.exp[i], order.call(Service{}, Route{Name: name}))
+			}
+			require.Equal(t, d.unfinished, order.unfinished())
+		})
+	}
+}
+
+func TestOrder_unfinished(t *testing.T) {
+	order := &Order{
+		Name: "upload",
+		Routes: []RouteRef{
+			{Name: "upload"},
+			{Name: "commit"},
+		},
+	}
+	require.Equal(t, `the order isn't finished, the following routes aren't called: upload, commit
+order: upload
+expected order: upload -> commit
+observed order: `, order.unfinished())
+	require.Empty(t, order.call(Service{}, Route{Name: "upload"}))
+	require.Equal(t, `the order isn't finished, the following routes aren't called: commit
+order: upload
+expected order: upload -> commit
+observed order: upload`, order.unfinished())
+	require.Empty(t, order.call(Service{}, Route{Name: "commit"}))
+	require.Empty(t, order.unfinished())
+}
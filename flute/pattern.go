@@ -0,0 +1,209 @@
+package flute
+
+import (
+	"context"
+	"fmt"
+	"net/http"
+	"net/url"
+	"strings"
+	"sync"
+	"unicode"
+)
+
+type (
+	// pathPattern is the parsed path pattern such as "/users/{id}".
+	// The syntax follows the wildcards of net/http.ServeMux in Go 1.22.
+	pathPattern struct {
+		segments []patternSegment
+		// prefix is true if the pattern ends with a slash,
+		// then the pattern matches all paths which start with the pattern.
+		prefix bool
+	}
+
+	patternSegment struct {
+		literal string
+		// wildcard is the name of the wildcard.
+		// If wildcard is empty, the segment is the literal.
+		wildcard string
+		// multi is true if the wildcard is "{name...}", which matches the remainder of the path.
+		multi bool
+		// end is true if the segment is "{$}", which matches only the end of the path after a slash.
+		end bool
+	}
+
+	pathValuesKey struct{}
+)
+
+// isPathPattern returns whether the path has wildcards.
+// The path without wildcards is compared to the request path exactly.
+func isPathPattern(p string) bool {
+	return strings.Contains(p, "{")
+}
+
+func parsePathPattern(p string) (*pathPattern, error) { //nolint:cyclop
+	if !strings.HasPrefix(p, "/") {
+		return nil, fmt.Errorf("path pattern must start with a slash: %s", p)
+	}
+	pattern := &pathPattern{}
+	names := map[string]struct{}{}
+	segs := strings.Split(p[1:], "/")
+	for i, seg := range segs {
+		last := i == len(segs)-1
+		if seg == "" && last {
+			pattern.prefix = true
+			break
+		}
+		if !strings.HasPrefix(seg, "{") || !strings.HasSuffix(seg, "}") {
+			if strings.ContainsAny(seg, "{}") {
+				return nil, fmt.Errorf("wildcard must be a full path segment: %s", p)
+			}
+			literal, err := url.PathUnescape(seg)
+			if err != nil {
+				return nil, fmt.Errorf("path pattern is invalid: %s: %w", p, err)
+			}
+			pattern.segments = append(pattern.segments, patternSegment{literal: literal})
+			continue
+		}
+		name := seg[1 : len(seg)-1]
+		if name == "$" {
+			if !last {
+				return nil, fmt.Errorf("{$} must be at the end of the path pattern: %s", p)
+			}
+			pattern.segments = append(pattern.segments, patternSegment{end: true})
+			break
+		}
+		multi := strings.HasSuffix(name, "...")
+		if multi {
+			if !last {
+				return nil, fmt.Errorf("{%s} must be at the end of the path pattern: %s", name, p)
+			}
+			name = strings.TrimSuffix(name, "...")
+		}
+		if !isIdentifier(name) {
+			return nil, fmt.Errorf("wildcard name must be a valid Go identifier: %s", p)
+		}
+		if _, ok := names[name]; ok {
+			return nil, fmt.Errorf("wildcard name is duplicated: %s: %s", name, p)
+		}
+		names[name] = struct{}{}
+		pattern.segments = append(pattern.segments, patternSegment{wildcard: name, multi: multi})
+	}
+	return pattern, nil
+}
+
+func isIdentifier(s string) bool {
+	if s == "" {
+		return false
+	}
+	for i, c := range s {
+		if !unicode.IsLetter(c) && c != '_' && (i == 0 || !unicode.IsDigit(c)) {
+			return false
+		}
+	}
+	return true
+}
+
+// match returns the values of the wildcards if the escaped path matches the pattern.
+func (pattern *pathPattern) match(escapedPath string) (map[string]string, bool) { //nolint:cyclop
+	if !strings.HasPrefix(escapedPath, "/") {
+		return nil, false
+	}
+	segs := strings.Split(escapedPath[1:], "/")
+	values := map[string]string{}
+	for i, ps := range pattern.segments {
+		if ps.multi {
+			// like net/http.ServeMux, "/files/{path...}" matches "/files/" but not "/files"
+			if i >= len(segs) {
+				return nil, false
+			}
+			v, err := url.PathUnescape(strings.Join(segs[i:], "/"))
+			if err != nil {
+				return nil, false
+			}
+			values[ps.wildcard] = v
+			return values, true
+		}
+		if i >= len(segs) {
+			return nil, false
+		}
+		if ps.end {
+			return values, i == len(segs)-1 && segs[i] == ""
+		}
+		seg, err := url.PathUnescape(segs[i])
+		if err != nil {
+			return nil, false
+		}
+		if ps.wildcard == "" {
+			if seg != ps.literal {
+				return nil, false
+			}
+			continue
+		}
+		if seg == "" {
+			return nil, false
+		}
+		values[ps.wildcard] = seg
+	}
+	n := len(pattern.segments)
+	if pattern.prefix {
+		// the request path must have the slash after the pattern's last segment
+		return values, len(segs) > n
+	}
+	return values, len(segs) == n
+}
+
+// parsedPathPattern is the result of parsePathPattern cached in pathPatterns.
+type parsedPathPattern struct {
+	pattern *pathPattern
+	err     error
+}
+
+// pathPatterns caches the parsed path patterns by the pattern string,
+// so the pattern isn't parsed every time the request is sent.
+var pathPatterns sync.Map //nolint:gochecknoglobals
+
+// loadPathPattern returns the parsed path pattern.
+func loadPathPattern(p string) (*pathPattern, error) {
+	if v, ok := pathPatterns.Load(p); ok {
+		parsed := v.(parsedPathPattern) //nolint:forcetypeassert
+		return parsed.pattern, parsed.err
+	}
+	pattern, err := parsePathPattern(p)
+	pathPatterns.Store(p, parsedPathPattern{pattern: pattern, err: err})
+	return pattern, err
+}
+
+// matchPathPattern returns the values of the wildcards if the request path matches the pattern.
+func matchPathPattern(p string, u *url.URL) (map[string]string, bool, error) {
+	pattern, err := loadPathPattern(p)
+	if err != nil {
+		return nil, false, err
+	}
+	values, ok := pattern.match(u.EscapedPath())
+	return values, ok, nil
+}
+
+// withPathValues returns the shallow copy of the request which has the values of the path wildcards.
+// If the path isn't a pattern, withPathValues returns the request as it is.
+func withPathValues(req *http.Request, p string) *http.Request {
+	if !isPathPattern(p) {
+		return req
+	}
+	values, ok, err := matchPathPattern(p, req.URL)
+	if err != nil || !ok {
+		return req
+	}
+	return req.WithContext(context.WithValue(req.Context(), pathValuesKey{}, values))
+}
+
+// PathValue returns the value of the wildcard in the route's Matcher.Path pattern.
+// For example, if the pattern is "/users/{id}" and the request path is "/users/10", PathValue(req, "id") returns "10".
+// PathValue is available in Tester.TestTB and Response.Response.
+// If the wildcard isn't found, PathValue returns an empty string.
+func PathValue(req *http.Request, name string) string {
+	values, ok := req.Context().Value(pathValuesKey{}).(map[string]string)
+	if !ok {
+		return ""
+	}
+	return values[name]
+}
@@ -0,0 +1,137 @@
+package flute
+
+import (
+	"net/url"
+	"testing"
+
+	"github.com/stretchr/testify/require"
+)
+
+func Test_matchPathPattern(t *testing.T) { //nolint:funlen
+	data := []struct {
+		title   string
+		pattern string
+		path    string
+		isErr   bool
+		exp     bool
+		values  map[string]string
+	}{
+		{
+			title:   "single wildcard",
+			pattern: "/users/{id}",
+			path:    "/users/10",
+			exp:     true,
+			values:  map[string]string{"id": "10"},
+		},
+		{
+			title:   "escaped segment",
+			pattern: "/users/{name}/groups/{group}",
+			path:    "/users/foo%2Fbar/groups/a%20b",
+			exp:     true,
+			values:  map[string]string{"name": "foo/bar", "group": "a b"},
+		},
+		{
+			title:   "wildcard doesn't match multiple segments",
+			pattern: "/users/{id}",
+			path:    "/users/10/groups",
+		},
+		{
+			title:   "wildcard doesn't match an empty segment",
+			pattern: "/users/{id}",
+			path:    "/users/",
+		},
+		{
+			title:   "literal doesn't match",
+			pattern: "/users/{id}",
+			path:    "/groups/10",
+		},
+		{
+			title:   "remainder wildcard",
+			pattern: "/files/{path...}",
+			path:    "/files/a/b/c.txt",
+			exp:     true,
+			values:  map[string]string{"path": "a/b/c.txt"},
+		},
+		{
+			title:   "remainder wildcard matches an empty remainder",
+			pattern: "/files/{path...}",
+			path:    "/files/",
+			exp:     true,
+			values:  map[string]string{"path": ""},
+		},
+		{
+			title:   "remainder wildcard doesn't match the path without the slash",
+			pattern: "/files/{path...}",
+			path:    "/files",
+		},
+		{
+			title:   "end of the path",
+			pattern: "/users/{id}/{$}",
+			path:    "/users/10/",
+			exp:     true,
+			values:  map[string]string{"id": "10"},
+		},
+		{
+			title:   "{$} doesn't match the longer path",
+			pattern: "/users/{id}/{$}",
+			path:    "/users/10/groups",
+		},
+		{
+			title:   "trailing slash matches the subtree",
+			pattern: "/users/{id}/",
+			path:    "/users/10/groups/1",
+			exp:     true,
+			values:  map[string]string{"id": "10"},
+		},
+		{
+			title:   "trailing slash doesn't match the path without the slash",
+			pattern: "/users/{id}/",
+			path:    "/users/10",
+		},
+		{
+			title:   "remainder wildcard must be the last",
+			pattern: "/files/{path...}/foo",
+			isErr:   true,
+		},
+		{
+			title:   "wildcard must be a full segment",
+			pattern: "/users/id-{id}",
+			isErr:   true,
+		},
+		{
+			title:   "invalid wildcard name",
+			pattern: "/users/{1d}",
+			isErr:   true,
+		},
+		{
+			title:   "duplicated wildcard name",
+			pattern: "/users/{id}/groups/{id}",
+			isErr:   true,
+		},
+		{
+			title:   "pattern must start with a slash",
+			pattern: "users/{id}",
+			isErr:   true,
+		},
+	}
+
+	for _, d := range data {
+		d := d
+		t.Run(d.title, func(t *testing.T) {
+			u, err := url.Parse(d.path)
+			require.NoError(t, err)
+			values, b, err := matchPathPattern(d.pattern, u)
+			if d.isErr {
+				require.Error(t, err)
+				return
+			}
+			require.NoError(t, err)
+			if !d.exp {
+				require.False(t, b)
+				return
+			}
+			require.True(t, b)
+			require.Equal(t, d.values, values)
+		})
+	}
+}
@@ -8,6 +8,24 @@ import (
 )
 
 func createHTTPResponse(req *http.Request, resp Response) (*http.Response, error) {
+	if err := resp.Fault.wait(req.Context()); err != nil {
+		return nil, err
+	}
+	if resp.Fault.Err != nil {
+		return nil, resp.Fault.Err
+	}
+	r, err := buildHTTPResponse(req, resp)
+	if err != nil || r == nil || r.Body == nil || !resp.Fault.BreakBody {
+		return r, err
+	}
+	r.Body = &brokenBody{
+		body:      r.Body,
+		remaining: resp.Fault.BodyBytes,
+	}
+	return r, nil
+}
+
+func buildHTTPResponse(req *http.Request, resp Response) (*http.Response, error) {
 	if resp.Response != nil {
 		return resp.Response(req)
 	}
@@ -37,5 +55,17 @@ func createHTTPResponse(req *http.Request, resp Response) (*http.Response, error
 	}
 
 	r.Body = body
+	if len(resp.Cookies) != 0 {
+		// Base is shared by the requests, so the header is copied before the cookies are added.
+		r.Header = r.Header.Clone()
+		if r.Header == nil {
+			r.Header = http.Header{}
+		}
+		for _, cookie := range resp.Cookies {
+			if v := cookie.String(); v != "" {
+				r.Header.Add("Set-Cookie", v)
+			}
+		}
+	}
 	return &r, nil
 }
@@ -193,3 +193,24 @@ func Benchmark_createHTTPResponse(b *testing.B) { //nolint:funlen
 		})
 	}
 }
+
+func Test_createHTTPResponse_cookies(t *testing.T) {
+	header := http.Header{"Foo": []string{"foo"}}
+	resp := Response{
+		Base: http.Response{Header: header},
+		Cookies: []*http.Cookie{
+			{Name: "session", Value: "abc", Path: "/", HttpOnly: true},
+			{Name: "theme", Value: "dark", MaxAge: 3600},
+		},
+	}
+	for i := 0; i < 2; i++ {
+		r, err := createHTTPResponse(&http.Request{}, resp)
+		require.NoError(t, err)
+		require.Equal(t, []string{
+			"session=abc; Path=/; HttpOnly",
+			"theme=dark; Max-Age=3600",
+		}, r.Header.Values("Set-Cookie"))
+		require.Equal(t, "foo", r.Header.Get("Foo"))
+	}
+	require.Empty(t, header.Values("Set-Cookie"), "the base header shouldn't be modified")
+}
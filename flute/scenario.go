@@ -0,0 +1,112 @@
+package flute
+
+import "sync"
+
+// ScenarioStarted is the initial state of scenarios.
+const ScenarioStarted = "Started"
+
+// Scenario is a named state which routes depend on and change.
+// Routes of the same scenario should share the same *Scenario.
+// The zero value is a scenario in the state ScenarioStarted.
+type Scenario struct {
+	Name  string
+	state string
+	mutex sync.Mutex
+}
+
+// State returns the current state of the scenario.
+func (scenario *Scenario) State() string {
+	scenario.mutex.Lock()
+	defer scenario.mutex.Unlock()
+	if scenario.state == "" {
+		return ScenarioStarted
+	}
+	return scenario.state
+}
+
+// SetState changes the state of the scenario.
+func (scenario *Scenario) SetState(state string) {
+	scenario.mutex.Lock()
+	scenario.state = state
+	scenario.mutex.Unlock()
+}
+
+// Reset changes the state of the scenario to ScenarioStarted.
+func (scenario *Scenario) Reset() {
+	scenario.SetState(ScenarioStarted)
+}
+
+// isMatchScenario returns whether the route's scenario is in the required state.
+func isMatchScenario(route Route) bool {
+	if route.Scenario == nil || route.ScenarioState == "" {
+		return true
+	}
+	return route.Scenario.State() == route.ScenarioState
+}
+
+// transitScenario moves the route's scenario to the route's NewScenarioState.
+// The scenario moves only if it is still in the route's ScenarioState,
+// so that only one of the concurrent requests can move the scenario.
+// If another request has changed the state, transitScenario returns false.
+func transitScenario(route Route) bool {
+	if route.Scenario == nil {
+		return true
+	}
+	return route.Scenario.transit(route.ScenarioState, route.NewScenarioState)
+}
+
+// transit moves the scenario from the state "from" to the state "to" atomically.
+// If "from" is empty, the scenario moves from any state.
+// If "to" is empty, the state isn't changed.
+func (scenario *Scenario) transit(from, to string) bool {
+	scenario.mutex.Lock()
+	defer scenario.mutex.Unlock()
+	state := scenario.state
+	if state == "" {
+		state = ScenarioStarted
+	}
+	if from != "" && state != from {
+		return false
+	}
+	if to != "" {
+		scenario.state = to
+	}
+	return true
+}
+
+// Scenarios returns the scenarios which the routes use.
+func (transport Transport) Scenarios() []*Scenario {
+	var scenarios []*Scenario
+	found := map[*Scenario]struct{}{}
+	for _, service := range transport.Services {
+		for _, route := range service.Routes {
+			if route.Scenario == nil {
+				continue
+			}
+			if _, ok := found[route.Scenario]; ok {
+				continue
+			}
+			found[route.Scenario] = struct{}{}
+			scenarios = append(scenarios, route.Scenario)
+		}
+	}
+	return scenarios
+}
+
+// Scenario returns the scenario with the name.
+// If no route uses the scenario, Scenario returns nil.
+func (transport Transport) Scenario(name string) *Scenario {
+	for _, scenario := range transport.Scenarios() {
+		if scenario.Name == name {
+			return scenario
+		}
+	}
+	return nil
+}
+
+// ResetScenarios changes the states of all scenarios to ScenarioStarted.
+func (transport Transport) ResetScenarios() {
+	for _, scenario := range transport.Scenarios() {
+		scenario.Reset()
+	}
+}
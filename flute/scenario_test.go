@@ -0,0 +1,86 @@
+package flute_test
+
+import (
+	"io"
+	"net/http"
+	"net/url"
+	"testing"
+
+	"github.com/stretchr/testify/require"
+	"github.com/suzuki-shunsuke/flute/v2/flute"
+)
+
+func TestTransport_RoundTrip_scenario(t *testing.T) { //nolint:funlen
+	job := &flute.Scenario{Name: "job"}
+	pollRoute := func(state, newState, status string) flute.Route {
+		return flute.Route{
+			Name: "poll the job (" + state + ")",
+			Matcher: flute.Matcher{
+				Method: http.MethodGet,
+				Path:   "/jobs/1",
+			},
+			Scenario:         job,
+			ScenarioState:    state,
+			NewScenarioState: newState,
+			Response: flute.Response{
+				BodyString: status,
+			},
+		}
+	}
+	transport := flute.Transport{
+		T: t,
+		Services: []flute.Service{
+			{
+				Endpoint: "http://example.com",
+				Routes: []flute.Route{
+					{
+						Name: "create a job",
+						Matcher: flute.Matcher{
+							Method: http.MethodPost,
+							Path:   "/jobs",
+						},
+						Scenario:         job,
+						ScenarioState:    flute.ScenarioStarted,
+						NewScenarioState: "pending-1",
+						Response: flute.Response{
+							BodyString: "created",
+						},
+					},
+					pollRoute("pending-1", "pending-2", "pending"),
+					pollRoute("pending-2", "pending-3", "pending"),
+					pollRoute("pending-3", "done", "done"),
+					pollRoute("done", "", "done"),
+				},
+			},
+		},
+	}
+	roundTrip := func(method, path string) string {
+		resp, err := transport.RoundTrip(&http.Request{
+			URL: &url.URL{
+				Scheme: "http",
+				Host:   "example.com",
+				Path:   path,
+			},
+			Method: method,
+		})
+		require.NoError(t, err)
+		defer resp.Body.Close()
+		b, err := io.ReadAll(resp.Body)
+		require.NoError(t, err)
+		return string(b)
+	}
+
+	require.Equal(t, flute.ScenarioStarted, transport.Scenario("job").State())
+	require.Equal(t, "created", roundTrip(http.MethodPost, "/jobs"))
+	require.Equal(t, "pending-1", transport.Scenario("job").State())
+	for _, exp := range []string{"pending", "pending", "done", "done"} {
+		require.Equal(t, exp, roundTrip(http.MethodGet, "/jobs/1"))
+	}
+	require.Equal(t, "done", job.State())
+	require.Len(t, transport.Scenarios(), 1)
+	require.Nil(t, transport.Scenario("unknown"))
+
+	transport.ResetScenarios()
+	require.Equal(t, flute.ScenarioStarted, job.State())
+	require.Equal(t, "created", roundTrip(http.MethodPost, "/jobs"))
+}
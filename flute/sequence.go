@@ -0,0 +1,88 @@
+package flute
+
+import (
+	"errors"
+	"fmt"
+	"sync"
+)
+
+// SequencePolicy is the behavior of Sequence after the last step.
+type SequencePolicy int
+
+const (
+	// RepeatLast returns the last step's response repeatedly.
+	RepeatLast SequencePolicy = iota
+	// Cycle starts the sequence from the first step again.
+	Cycle
+	// FailAfterLast fails the test and RoundTrip returns an error.
+	FailAfterLast
+)
+
+var errSequenceExhausted = errors.New("the sequence of the route has no more steps")
+
+type (
+	// Sequence is an ordered list of steps which a route returns.
+	// The first call of the route returns the first step's response, the second call returns the second step's response, and so on.
+	// Sequence counts the calls, so a Sequence shouldn't be shared by multiple routes.
+	Sequence struct {
+		Steps []Step
+		// AfterLast is the behavior after the last step.
+		// The default is RepeatLast.
+		AfterLast SequencePolicy
+		count     int
+		mutex     sync.Mutex
+	}
+
+	// Step is a pair of the tester and the response for one call of the route.
+	Step struct {
+		// Tester is run in addition to the route's tester.
+		Tester   Tester
+		Response Response
+	}
+)
+
+// Count returns the number of times the sequence has been called.
+func (seq *Sequence) Count() int {
+	seq.mutex.Lock()
+	defer seq.mutex.Unlock()
+	return seq.count
+}
+
+// Reset starts the sequence from the first step again.
+func (seq *Sequence) Reset() {
+	seq.mutex.Lock()
+	seq.count = 0
+	seq.mutex.Unlock()
+}
+
+// next returns the step for the next call and the index of the step.
+// If no step is available, next returns false.
+func (seq *Sequence) next() (Step, int, bool) {
+	seq.mutex.Lock()
+	defer seq.mutex.Unlock()
+	n := seq.count
+	seq.count++
+	size := len(seq.Steps)
+	if size == 0 {
+		return Step{}, 0, false
+	}
+	if n < size {
+		return seq.Steps[n], n, true
+	}
+	switch seq.AfterLast {
+	case RepeatLast:
+		return seq.Steps[size-1], size - 1, true
+	case Cycle:
+		return seq.Steps[n%size], n % size, true
+	default:
+		return Step{}, 0, false
+	}
+}
+
+// stepRoute returns the route whose tester and response are the step's ones.
+func stepRoute(route Route, step Step, idx int) Route {
+	route.Name = fmt.Sprintf("%s (step %d)", route.Name, idx+1)
+	route.Tester = step.Tester
+	route.Response = step.Response
+	return route
+}
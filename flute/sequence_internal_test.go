@@ -0,0 +1,80 @@
+package flute
+
+import (
+	"net/http"
+	"testing"
+
+	"github.com/stretchr/testify/require"
+)
+
+func TestSequence_next(t *testing.T) { //nolint:funlen
+	steps := []Step{
+		{
+			Response: Response{
+				Base: http.Response{
+					StatusCode: http.StatusServiceUnavailable,
+				},
+			},
+		},
+		{
+			Response: Response{
+				Base: http.Response{
+					StatusCode: http.StatusOK,
+				},
+			},
+		},
+	}
+	data := []struct {
+		title string
+		seq   *Sequence
+		exp   []int
+	}{
+		{
+			title: "repeat last",
+			seq: &Sequence{
+				Steps: steps,
+			},
+			exp: []int{0, 1, 1, 1},
+		},
+		{
+			title: "cycle",
+			seq: &Sequence{
+				Steps:     steps,
+				AfterLast: Cycle,
+			},
+			exp: []int{0, 1, 0, 1},
+		},
+		{
+			title: "fail after last",
+			seq: &Sequence{
+				Steps:     steps,
+				AfterLast: FailAfterLast,
+			},
+			exp: []int{0, 1, -1, -1},
+		},
+		{
+			title: "no step",
+			seq:   &Sequence{},
+			exp:   []int{-1},
+		},
+	}
+
+	for _, d := range data {
+		d := d
+		t.Run(d.title, func(t *testing.T) {
+			for i, exp := range d.exp {
+				step, idx, ok := d.seq.next()
+				if exp < 0 {
+					require.False(t, ok)
+					continue
+				}
+				require.True(t, ok)
+				require.Equal(t, exp, idx)
+				require.Equal(t, steps[exp].Response.Base.StatusCode, step.Response.Base.StatusCode)
+				require.Equal(t, i+1, d.seq.Count())
+			}
+			d.seq.Reset()
+			require.Equal(t, 0, d.seq.Count())
+		})
+	}
+}
@@ -0,0 +1,376 @@
+package flute
+
+import (
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/hex"
+	"fmt"
+	"net/http"
+	"net/url"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+)
+
+const (
+	sigV4Algorithm  = "AWS4-HMAC-SHA256"
+	sigV4TimeFormat = "20060102T150405Z"
+	sigV4DateFormat = "20060102"
+	// unsignedPayload is the payload hash of the presigned URL and the request whose payload isn't signed.
+	unsignedPayload = "UNSIGNED-PAYLOAD"
+)
+
+type (
+	// SigV4 is the condition of the AWS Signature Version 4.
+	// The signature is either in the Authorization header or in the query parameters of the presigned URL.
+	SigV4 struct {
+		AccessKeyID     string
+		SecretAccessKey string
+		// SessionToken is the session token of the temporary credentials.
+		// If SessionToken isn't empty, the request must have it as X-Amz-Security-Token.
+		SessionToken string
+		// Region is the region such as "us-east-1".
+		Region string
+		// Service is the signing name of the service such as "s3" and "sqs".
+		// The path of the canonical request is encoded twice except for "s3" like AWS SDKs.
+		Service string
+		// Time is the fixed time when the client signs the request.
+		// If Time isn't zero, X-Amz-Date must be Time.
+		// The presigned URL is used after it is signed, so Time is the time when the URL is used.
+		// X-Amz-Date of the presigned URL must not be after Time,
+		// and X-Amz-Expires is required and Time must not be after X-Amz-Date + X-Amz-Expires.
+		Time time.Time
+	}
+
+	// sigV4Request is the signature parameters of the request.
+	sigV4Request struct {
+		presigned     bool
+		credential    string
+		signedHeaders []string
+		signature     string
+		date          string
+		securityToken string
+		// expires is X-Amz-Expires of the presigned URL.
+		expires string
+	}
+)
+
+// SigV4Signature returns the Auth which requires the AWS Signature Version 4 signed with the credentials.
+// The payload hash is X-Amz-Content-Sha256 if the request has it.
+// Otherwise, the payload hash is the SHA-256 hash of the request body as it was sent
+// for the Authorization header and UNSIGNED-PAYLOAD for the presigned URL.
+// If the signature doesn't match, the failure message has the expected canonical request and string to sign.
+func SigV4Signature(s SigV4) Auth {
+	return authFunc{
+		check:       s.verify,
+		description: fmt.Sprintf("AWS SigV4 signature of the access key %q for %s/%s", s.AccessKeyID, s.Region, s.Service),
+	}
+}
+
+// scope returns the credential scope of the date.
+func (s SigV4) scope(date string) string {
+	return strings.Join([]string{date, s.Region, s.Service, "aws4_request"}, "/")
+}
+
+// signingKey derives the signing key of the date from the secret access key.
+func (s SigV4) signingKey(date string) []byte {
+	key := []byte("AWS4" + s.SecretAccessKey)
+	for _, v := range []string{date, s.Region, s.Service, "aws4_request"} {
+		key = hmacSHA256(key, v)
+	}
+	return key
+}
+
+func hmacSHA256(key []byte, s string) []byte {
+	mac := hmac.New(sha256.New, key)
+	mac.Write([]byte(s))
+	return mac.Sum(nil)
+}
+
+func sha256Hex(b []byte) string {
+	h := sha256.Sum256(b)
+	return hex.EncodeToString(h[:])
+}
+
+// readSigV4Request returns the signature parameters of the request.
+func readSigV4Request(req *http.Request) (*sigV4Request, *authFailure) {
+	query := originalURL(req).Query()
+	if query.Get("X-Amz-Algorithm") != "" {
+		if v := query.Get("X-Amz-Algorithm"); v != sigV4Algorithm {
+			return nil, &authFailure{
+				subject:  "SigV4 query X-Amz-Algorithm",
+				expected: fmt.Sprintf("%q", sigV4Algorithm),
+				actual:   fmt.Sprintf("%q", v),
+			}
+		}
+		return &sigV4Request{
+			presigned:     true,
+			credential:    query.Get("X-Amz-Credential"),
+			signedHeaders: strings.Split(query.Get("X-Amz-SignedHeaders"), ";"),
+			signature:     query.Get("X-Amz-Signature"),
+			date:          query.Get("X-Amz-Date"),
+			securityToken: query.Get("X-Amz-Security-Token"),
+			expires:       query.Get("X-Amz-Expires"),
+		}, nil
+	}
+	v := req.Header.Get("Authorization")
+	if v == "" {
+		return nil, &authFailure{
+			subject:  "Authorization header",
+			expected: sigV4Algorithm + " credentials or the presigned query",
+			actual:   "missing",
+		}
+	}
+	algorithm, params, _ := strings.Cut(v, " ")
+	if algorithm != sigV4Algorithm {
+		return nil, &authFailure{
+			subject:  "Authorization scheme",
+			expected: fmt.Sprintf("%q", sigV4Algorithm),
+			actual:   fmt.Sprintf("%q", algorithm),
+		}
+	}
+	sr := &sigV4Request{
+		date:          req.Header.Get("X-Amz-Date"),
+		securityToken: req.Header.Get("X-Amz-Security-Token"),
+	}
+	for _, param := range strings.Split(params, ",") {
+		k, v, _ := strings.Cut(strings.TrimSpace(param), "=")
+		switch k {
+		case "Credential":
+			sr.credential = v
+		case "SignedHeaders":
+			sr.signedHeaders = strings.Split(v, ";")
+		case "Signature":
+			sr.signature = v
+		}
+	}
+	return sr, nil
+}
+
+// verify returns the part of the signature which the request doesn't meet.
+func (s SigV4) verify(req *http.Request) (*authFailure, error) { //nolint:cyclop
+	sr, f := readSigV4Request(req)
+	if f != nil {
+		return f, nil
+	}
+	accessKeyID, scope, _ := strings.Cut(sr.credential, "/")
+	if accessKeyID != s.AccessKeyID {
+		return &authFailure{
+			subject:  "SigV4 access key ID",
+			expected: fmt.Sprintf("%q", s.AccessKeyID),
+			actual:   fmt.Sprintf("%q", accessKeyID),
+		}, nil
+	}
+	signedAt, err := time.Parse(sigV4TimeFormat, sr.date)
+	if err != nil {
+		return &authFailure{
+			subject:  "SigV4 X-Amz-Date",
+			expected: "the time in the format " + sigV4TimeFormat,
+			actual:   fmt.Sprintf("%q", sr.date),
+		}, nil
+	}
+	if f := s.checkTime(sr, signedAt); f != nil {
+		return f, nil
+	}
+	if exp := s.scope(signedAt.Format(sigV4DateFormat)); scope != exp {
+		return &authFailure{
+			subject:  "SigV4 credential scope",
+			expected: exp,
+			actual:   scope,
+		}, nil
+	}
+	if !containsString(sr.signedHeaders, "host") {
+		return &authFailure{
+			subject:  "SigV4 signed headers",
+			expected: "include host",
+			actual:   strings.Join(sr.signedHeaders, ";"),
+		}, nil
+	}
+	if s.SessionToken != "" && !equalSecret(s.SessionToken, sr.securityToken) {
+		return &authFailure{
+			subject:  "SigV4 security token",
+			expected: maskSecret(s.SessionToken),
+			actual:   maskSecret(sr.securityToken),
+		}, nil
+	}
+	canonicalRequest, err := s.canonicalRequest(req, sr)
+	if err != nil {
+		return nil, err
+	}
+	stringToSign := strings.Join([]string{
+		sigV4Algorithm,
+		sr.date,
+		scope,
+		sha256Hex([]byte(canonicalRequest)),
+	}, "\n")
+	signature := hex.EncodeToString(hmacSHA256(s.signingKey(signedAt.Format(sigV4DateFormat)), stringToSign))
+	if !hmac.Equal([]byte(signature), []byte(strings.ToLower(sr.signature))) {
+		return &authFailure{
+			subject:  "SigV4 signature",
+			expected: signature,
+			actual:   sr.signature,
+			detail:   fmt.Sprintf("canonical request:\n%s\nstring to sign:\n%s", canonicalRequest, stringToSign),
+		}, nil
+	}
+	return nil, nil
+}
+
+// checkTime returns the failure if the request isn't signed at Time or the presigned URL isn't valid at Time.
+func (s SigV4) checkTime(sr *sigV4Request, signedAt time.Time) *authFailure {
+	if s.Time.IsZero() {
+		return nil
+	}
+	now := s.Time.UTC().Truncate(time.Second)
+	if !sr.presigned {
+		if !signedAt.Equal(now) {
+			return &authFailure{
+				subject:  "SigV4 X-Amz-Date",
+				expected: now.Format(sigV4TimeFormat),
+				actual:   sr.date,
+			}
+		}
+		return nil
+	}
+	if signedAt.After(now) {
+		return &authFailure{
+			subject:  "SigV4 X-Amz-Date",
+			expected: "not after " + now.Format(sigV4TimeFormat),
+			actual:   sr.date,
+		}
+	}
+	expires, err := strconv.Atoi(sr.expires)
+	if err != nil || expires < 0 {
+		return &authFailure{
+			subject:  "SigV4 X-Amz-Expires",
+			expected: "the number of seconds",
+			actual:   fmt.Sprintf("%q", sr.expires),
+		}
+	}
+	if expiresAt := signedAt.Add(time.Duration(expires) * time.Second); now.After(expiresAt) {
+		return &authFailure{
+			subject:  "SigV4 X-Amz-Expires",
+			expected: "not expired at " + now.Format(sigV4TimeFormat),
+			actual:   "expired at " + expiresAt.Format(sigV4TimeFormat),
+		}
+	}
+	return nil
+}
+
+// canonicalRequest returns the canonical request of the request.
+// https://docs.aws.amazon.com/IAM/latest/UserGuide/create-signed-request.html#create-canonical-request
+func (s SigV4) canonicalRequest(req *http.Request, sr *sigV4Request) (string, error) {
+	u := originalURL(req)
+	path := u.EscapedPath()
+	if path == "" {
+		path = "/"
+	}
+	if s.Service != "s3" {
+		path = sigV4Escape(path, false)
+	}
+	headers := make([]string, len(sr.signedHeaders))
+	for i, name := range sr.signedHeaders {
+		headers[i] = name + ":" + canonicalHeaderValue(req, u, name) + "\n"
+	}
+	payload, err := payloadHash(req, sr)
+	if err != nil {
+		return "", err
+	}
+	return strings.Join([]string{
+		req.Method,
+		path,
+		canonicalQuery(u.Query(), sr.presigned),
+		strings.Join(headers, ""),
+		strings.Join(sr.signedHeaders, ";"),
+		payload,
+	}, "\n"), nil
+}
+
+// canonicalQuery returns the encoded query string sorted by the encoded key and then by the encoded value.
+// The pairs are sorted before they are joined with "=",
+// so "a=1" comes before "a-b=2" though "=" is greater than "-".
+// The signature itself is excluded from the presigned URL.
+func canonicalQuery(query url.Values, presigned bool) string {
+	type param struct {
+		key   string
+		value string
+	}
+	var params []param
+	for k, values := range query {
+		if presigned && k == "X-Amz-Signature" {
+			continue
+		}
+		for _, v := range values {
+			params = append(params, param{key: sigV4Escape(k, true), value: sigV4Escape(v, true)})
+		}
+	}
+	sort.Slice(params, func(i, j int) bool {
+		if params[i].key != params[j].key {
+			return params[i].key < params[j].key
+		}
+		return params[i].value < params[j].value
+	})
+	pairs := make([]string, len(params))
+	for i, p := range params {
+		pairs[i] = p.key + "=" + p.value
+	}
+	return strings.Join(pairs, "&")
+}
+
+// canonicalHeaderValue returns the trimmed header value whose sequential spaces are replaced with a single space.
+// The host and content length aren't in req.Header, so they are got from the request.
+func canonicalHeaderValue(req *http.Request, u *url.URL, name string) string {
+	values := req.Header.Values(name)
+	if len(values) == 0 {
+		switch name {
+		case "host":
+			if req.Host != "" {
+				return req.Host
+			}
+			return u.Host
+		case "content-length":
+			return strconv.FormatInt(req.ContentLength, 10)
+		}
+	}
+	trimmed := make([]string, len(values))
+	for i, v := range values {
+		trimmed[i] = strings.Join(strings.Fields(v), " ")
+	}
+	return strings.Join(trimmed, ",")
+}
+
+// payloadHash returns the hash of the payload in the canonical request.
+// The payload is the request body as it was sent,
+// so the body compressed with Content-Encoding is hashed before it is decoded.
+func payloadHash(req *http.Request, sr *sigV4Request) (string, error) {
+	if v := req.Header.Get("X-Amz-Content-Sha256"); v != "" {
+		return v, nil
+	}
+	if sr.presigned {
+		return unsignedPayload, nil
+	}
+	b, err := rawBody(req)
+	if err != nil {
+		return "", fmt.Errorf("failed to read the request body: %w", err)
+	}
+	return sha256Hex(b), nil
+}
+
+// sigV4Escape percent-encodes the characters except the unreserved characters of RFC 3986.
+// If encodeSlash is false, "/" isn't encoded.
+func sigV4Escape(s string, encodeSlash bool) string {
+	const hexChars = "0123456789ABCDEF"
+	var b strings.Builder
+	for i := 0; i < len(s); i++ {
+		c := s[i]
+		if ('A' <= c && c <= 'Z') || ('a' <= c && c <= 'z') || ('0' <= c && c <= '9') ||
+			c == '-' || c == '_' || c == '.' || c == '~' || (c == '/' && !encodeSlash) {
+			b.WriteByte(c)
+			continue
+		}
+		b.WriteByte('%')
+		b.WriteByte(hexChars[c>>4])
+		b.WriteByte(hexChars[c&0xF])
+	}
+	return b.String()
+}
@@ -8,21 +8,61 @@ import (
 
 type (
 	// Transport implements http.RoundTripper.
+	//
+	// RoundTrip is safe for concurrent use by multiple goroutines.
+	// Expectation, Sequence, Scenario, Order, and Journal keep their state behind pointers with locks,
+	// so copies of Transport share the state and concurrent requests don't race.
+	// Each call of a Sequence returns a different step, and only one of concurrent requests
+	// can move a Scenario from a state.
+	// Transport's fields, including Services and Routes, shouldn't be modified while RoundTrip is running.
 	Transport struct {
 		// Each service's endpoint should be unique.
 		Services []Service
-		// If *testing.T is nil, the transport is a just mock and doesn't run the test.
-		T *testing.T
+		// If T is nil, the transport is a just mock and doesn't run the test.
+		// T accepts *testing.T, *testing.B, *testing.F, and any other testing.TB.
+		T testing.TB
 		// Transport is used when the request doesn't match with any services.
 		Transport http.RoundTripper
+		// If Journal isn't nil, every request is recorded in Journal.
+		Journal *Journal
+		// Orders are the orders in which the routes should be called.
+		// The request which arrives out of order is reported with T.
+		Orders []*Order
+		// ContentDecoders are the decoders of the request body by the content coding such as "compress".
+		// gzip, deflate, br, and zstd are supported by default, and ContentDecoders take precedence over them.
+		// The keys are case-insensitive like Content-Encoding.
+		// The request body encoded with an unsupported coding is matched and tested without decoding.
+		ContentDecoders map[string]ContentDecoder
+		// If Session isn't nil, the cookies set by the responses are recorded in Session,
+		// and the later requests to the same service must have them.
+		Session *Session
 	}
 
 	// Service is a service.
 	Service struct {
-		// The format of Endpoint should be "scheme://host", and other parameters
-		// such as path and queries shouldn't be set.
+		// The format of Endpoint should be "scheme://host[:port][/base/path]", and other parameters
+		// such as queries shouldn't be set.
 		// These parameters should be set at the matcher or tester.
+		//
+		// If the port is omitted, the default port of the scheme is used,
+		// so "https://example.com" matches the request to "https://example.com:443".
+		// A label "*" of the host matches any single label, for example "https://*.s3.amazonaws.com".
+		// The host "*" matches any host.
+		//
+		// If Endpoint has the base path, the service matches only the request under the base path,
+		// and the path of the request given to the matcher and tester is relative to the base path.
+		// For example, if Endpoint is "https://example.com/api/v2",
+		// the request to "https://example.com/api/v2/users" matches Matcher.Path "/users".
+		// The request given to Response.Response and set to http.Response.Request has the URL which the client sent.
 		Endpoint string
+		// Endpoints are additional endpoints of the service.
+		// The format is the same as Endpoint.
+		// Endpoint is still used to specify the service in the failure message.
+		Endpoints []string
+		// If HostMatcher isn't nil, the host of the request without the port must also match HostMatcher.
+		// HostMatcher is useful to match the host with a regular expression, for example
+		// Endpoint "https://*" and HostMatcher Regexp(`^[a-z0-9.-]+\.s3\.amazonaws\.com$`).
+		HostMatcher ValueMatcher
 		// If the request matches with a route, other routes are ignored.
 		Routes []Route
 	}
@@ -34,36 +74,130 @@ type (
 		Matcher  Matcher
 		Tester   Tester
 		Response Response
+		// Expect is the expected number of times the route is called.
+		// If Expect is nil, the route can be called any number of times.
+		// The expectations are checked by Transport.Verify.
+		Expect *Expectation
+		// If Sequence isn't nil, the route returns the responses of the sequence in order and Response is ignored.
+		// The tester of each step is run in addition to Tester.
+		Sequence *Sequence
+		// Scenario is the scenario which the route depends on and changes.
+		Scenario *Scenario
+		// If ScenarioState isn't empty, the route matches the request only when the scenario is in the state.
+		ScenarioState string
+		// If NewScenarioState isn't empty, the scenario moves to the state when the route matches the request.
+		NewScenarioState string
 	}
 
 	// Matcher has conditions the request matches with the route.
 	Matcher struct {
 		// Match is a custom function to check the request matches with the route.
 		Match func(req *http.Request) (bool, error)
+		// SOAPAction is the SOAP action of the request.
+		// SOAPAction is compared to the SOAPAction header of SOAP 1.1 without quotes,
+		// or the action parameter of the Content-Type header of SOAP 1.2.
+		SOAPAction string
+		// SOAPOperation is the name of the first element in the SOAP body, which is the operation.
+		// SOAPOperation is either the local name such as "GetPrice"
+		// or the name with the namespace such as "{http://example.com/stock}GetPrice".
+		SOAPOperation string
+		// Condition is the condition composed of RequestMatchers such as AllOf, AnyOf, and Not.
+		// For example, AllOf(AnyOf(Method("GET"), Method("HEAD")), Not(PathMatches(Prefix("/internal/")))).
+		// Condition may be checked more than once for a request to describe why the request doesn't match,
+		// so the RequestMatchers in it shouldn't have side effects.
+		Condition RequestMatcher
 		// Path is the request method such as "GET".
 		Method string
 		// Path is the request path.
+		// Path can be a pattern with wildcards such as "/users/{id}" and "/files/{path...}".
+		// The syntax follows the patterns of net/http.ServeMux in Go 1.22:
+		// "{name}" matches a path segment, "{name...}" matches the remainder of the path,
+		// "{$}" matches only the end of the path, and in a pattern with wildcards a trailing slash matches any path under it.
+		// Unlike net/http.ServeMux, the path without wildcards is compared to the request path exactly
+		// even if it ends with a slash, so "/users/" matches only "/users/".
+		// Use PathMatches(Prefix("/users/")) in Condition to match any path under it.
+		// The values of the wildcards can be got by PathValue in Tester.TestTB and Response.Response.
 		Path string
 		// PartOfQuery is the request query parameters.
 		PartOfQuery url.Values
 		// Query is the request query parameters.
 		Query url.Values
+		// PartOfForm is the request body's conditions parsed as application/x-www-form-urlencoded.
+		// If the form value is nil, RoundTrip checks whether the key is included in the request form.
+		// Otherwise, RoundTrip also checks whether the value is equal.
+		PartOfForm url.Values
+		// Form is the request body parsed as application/x-www-form-urlencoded.
+		// Form is compared to the request form regardless of the order of the parameters.
+		Form url.Values
+		// Multipart is the conditions of the multipart/form-data request body.
+		Multipart *Multipart
 		// BodyString is the request body.
 		BodyString string
 		// BodyJSON is marshaled to JSON and compared to the request body as JSON.
 		BodyJSON interface{}
 		// BodyJSONString is a JSON string and compared to the request body as JSON.
 		BodyJSONString string
+		// PartOfBodyJSON is marshaled to JSON, and the request body must contain it.
+		// Objects match if the request body has all keys of the expected object, and the values match recursively.
+		// Arrays are compared according to PartOfBodyJSONArrayMode.
+		PartOfBodyJSON interface{}
+		// PartOfBodyJSONString is a JSON string, and the request body must contain it like PartOfBodyJSON.
+		// PartOfBodyJSON and PartOfBodyJSONString can't be set at the same time.
+		// If both are set, the route doesn't match and the tester fails.
+		PartOfBodyJSONString string
+		// PartOfBodyJSONArrayMode is how arrays are compared in PartOfBodyJSON and PartOfBodyJSONString.
+		// The default is JSONArrayOrdered.
+		PartOfBodyJSONArrayMode JSONArrayMode
+		// BodyJSONExprs are the assertions on the JSON request body with JMESPath expressions.
+		// The request body is parsed once and all expressions are evaluated.
+		BodyJSONExprs []JSONExpr
+		// BodyXML is marshaled to XML with encoding/xml and compared to the request body as XML.
+		// XML documents are compared after canonicalization, so whitespace between elements,
+		// the attribute order, namespace prefixes, and comments are ignored.
+		// The prefixes in the attribute values such as xsi:type="ns1:Foo" are also ignored.
+		// Texts and elements in mixed content are compared in the document order.
+		BodyXML interface{}
+		// BodyXMLString is a XML string and compared to the request body as XML like BodyXML.
+		// BodyXML and BodyXMLString can't be set at the same time.
+		BodyXMLString string
+		// GraphQL is the conditions of the GraphQL operation.
+		GraphQL *GraphQL
+		// JSONRPC is the conditions of the JSON-RPC 2.0 call.
+		JSONRPC *JSONRPC
 		// PartOfHeader is the request header's conditions.
 		// If the header value is nil, RoundTrip checks whether the key is included in the request header.
 		// Otherwise, RoundTrip also checks whether the value is equal.
 		PartOfHeader http.Header
 		// Header is the request header's conditions.
 		Header http.Header
+		// PathMatcher is the condition of the request path.
+		PathMatcher ValueMatcher
+		// HeaderMatcher is the request header's conditions.
+		// The header must have the key and all values of the key must match the ValueMatcher.
+		// If the ValueMatcher is nil, RoundTrip only checks whether the key is included in the request header.
+		HeaderMatcher map[string]ValueMatcher
+		// QueryMatcher is the request query parameters' conditions.
+		// The query must have the key and all values of the key must match the ValueMatcher.
+		// If the ValueMatcher is nil, RoundTrip only checks whether the key is included in the request query.
+		QueryMatcher map[string]ValueMatcher
+		// Cookie is the request cookies' conditions by the cookie name.
+		// The request must have the cookie and all values of the cookie must match the ValueMatcher.
+		// If the ValueMatcher is nil, RoundTrip only checks whether the request has the cookie.
+		Cookie map[string]ValueMatcher
+		// AbsentCookies are the names of the cookies which the request shouldn't have.
+		AbsentCookies []string
+		// Auth is the credential which the request must have such as BasicAuth, BearerToken, and SigV4Signature.
+		Auth Auth
 	}
 
 	// Tester has the request's tests.
 	Tester struct {
+		// TestTB is a custom test function.
+		TestTB func(testing.TB, *http.Request, Service, Route)
+		// Test is a custom test function which requires *testing.T.
+		// If Transport.T isn't *testing.T, Test isn't called and the test fails, so use TestTB with other testing.TB.
+		//
+		// Deprecated: Use TestTB instead. TestTB works with any testing.TB such as *testing.B.
 		Test func(*testing.T, *http.Request, Service, Route)
 		// Path is the request path.
 		Path string
@@ -75,6 +209,33 @@ type (
 		BodyJSON interface{}
 		// BodyJSONString is a JSON string and compared to the request body as JSON.
 		BodyJSONString string
+		// PartOfBodyJSON is marshaled to JSON, and the request body must contain it.
+		// Objects match if the request body has all keys of the expected object, and the values match recursively.
+		// Arrays are compared according to PartOfBodyJSONArrayMode.
+		PartOfBodyJSON interface{}
+		// PartOfBodyJSONString is a JSON string, and the request body must contain it like PartOfBodyJSON.
+		// PartOfBodyJSON and PartOfBodyJSONString can't be set at the same time.
+		// If both are set, the route doesn't match and the tester fails.
+		PartOfBodyJSONString string
+		// PartOfBodyJSONArrayMode is how arrays are compared in PartOfBodyJSON and PartOfBodyJSONString.
+		// The default is JSONArrayOrdered.
+		PartOfBodyJSONArrayMode JSONArrayMode
+		// BodyJSONExprs are the assertions on the JSON request body with JMESPath expressions.
+		// The request body is parsed once and all expressions are evaluated.
+		BodyJSONExprs []JSONExpr
+		// BodyXML is marshaled to XML with encoding/xml and compared to the request body as XML.
+		// XML documents are compared after canonicalization, so whitespace between elements,
+		// the attribute order, namespace prefixes, and comments are ignored.
+		// The prefixes in the attribute values such as xsi:type="ns1:Foo" are also ignored.
+		// Texts and elements in mixed content are compared in the document order.
+		BodyXML interface{}
+		// BodyXMLString is a XML string and compared to the request body as XML like BodyXML.
+		// BodyXML and BodyXMLString can't be set at the same time.
+		BodyXMLString string
+		// GraphQL is the conditions of the GraphQL operation.
+		GraphQL *GraphQL
+		// JSONRPC is the conditions of the JSON-RPC 2.0 call.
+		JSONRPC *JSONRPC
 		// PartOfHeader is the request header's conditions.
 		// If the header value is nil, RoundTrip checks whether the key is included in the request header.
 		// Otherwise, RoundTrip also checks whether the value is equal.
@@ -87,6 +248,36 @@ type (
 		PartOfQuery url.Values
 		// Query is the request query parameters.
 		Query url.Values
+		// PartOfForm is the request body's conditions parsed as application/x-www-form-urlencoded.
+		// If the form value is nil, RoundTrip checks whether the key is included in the request form.
+		// Otherwise, RoundTrip also checks whether the value is equal.
+		PartOfForm url.Values
+		// Form is the request body parsed as application/x-www-form-urlencoded.
+		// Form is compared to the request form regardless of the order of the parameters.
+		Form url.Values
+		// Multipart is the conditions of the multipart/form-data request body.
+		Multipart *Multipart
+		// If ContentEncoding isn't empty, the request must have the Content-Encoding header equal to ContentEncoding
+		// and the request body must be decoded successfully with it, such as "gzip" and "br".
+		ContentEncoding string
+		// PathMatcher is the condition of the request path.
+		PathMatcher ValueMatcher
+		// HeaderMatcher is the request header's conditions.
+		// The header must have the key and all values of the key must match the ValueMatcher.
+		// If the ValueMatcher is nil, RoundTrip only checks whether the key is included in the request header.
+		HeaderMatcher map[string]ValueMatcher
+		// QueryMatcher is the request query parameters' conditions.
+		// The query must have the key and all values of the key must match the ValueMatcher.
+		// If the ValueMatcher is nil, RoundTrip only checks whether the key is included in the request query.
+		QueryMatcher map[string]ValueMatcher
+		// Cookie is the request cookies' conditions by the cookie name.
+		// The request must have the cookie and all values of the cookie must match the ValueMatcher.
+		// If the ValueMatcher is nil, RoundTrip only checks whether the request has the cookie.
+		Cookie map[string]ValueMatcher
+		// AbsentCookies are the names of the cookies which the request shouldn't have.
+		AbsentCookies []string
+		// Auth is the credential which the request must have such as BasicAuth, BearerToken, and SigV4Signature.
+		Auth Auth
 	}
 
 	// Response has the response parameters.
@@ -101,5 +292,10 @@ type (
 		// BodyString is the response body.
 		// BodyJSON and BodyString should only be set to one or the other.
 		BodyString string
+		// Cookies are added to the response header as Set-Cookie.
+		Cookies []*http.Cookie
+		// Fault is the failure injected into the response such as latency and transport errors.
+		// Fault is applied to the response returned by Response too.
+		Fault Fault
 	}
 )
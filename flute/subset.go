@@ -0,0 +1,219 @@
+package flute
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"reflect"
+	"regexp"
+	"sort"
+)
+
+// JSONArrayMode is how arrays are compared in the partial JSON matching.
+type JSONArrayMode int
+
+const (
+	// JSONArrayOrdered requires the arrays to have the same length,
+	// and each expected element to be a subset of the actual element at the same index.
+	JSONArrayOrdered JSONArrayMode = iota
+	// JSONArrayUnordered requires the arrays to have the same length,
+	// and each expected element to be a subset of a different actual element in any order.
+	JSONArrayUnordered
+	// JSONArrayContains requires each expected element to be a subset of a different actual element in any order.
+	// The actual array can have extra elements.
+	JSONArrayContains
+)
+
+func (mode JSONArrayMode) String() string {
+	switch mode {
+	case JSONArrayOrdered:
+		return "ordered"
+	case JSONArrayUnordered:
+		return "unordered"
+	case JSONArrayContains:
+		return "contains"
+	}
+	return fmt.Sprintf("JSONArrayMode(%d)", int(mode))
+}
+
+// jsonMismatch is the first difference between the expected JSON and the actual JSON.
+type jsonMismatch struct {
+	// path is the JSON path of the difference such as "$.users[0].name".
+	path     string
+	expected string
+	actual   string
+}
+
+func (m jsonMismatch) String() string {
+	return fmt.Sprintf("path: %s\nexpected: %s\nactual: %s", m.path, m.expected, m.actual)
+}
+
+var jsonIdentifier = regexp.MustCompile(`^[A-Za-z_][A-Za-z0-9_]*$`) //nolint:gochecknoglobals
+
+func jsonKeyPath(path, key string) string {
+	if jsonIdentifier.MatchString(key) {
+		return path + "." + key
+	}
+	return fmt.Sprintf("%s[%q]", path, key)
+}
+
+func jsonIndexPath(path string, i int) string {
+	return fmt.Sprintf("%s[%d]", path, i)
+}
+
+// compactJSON formats the decoded JSON value as a compact JSON string.
+func compactJSON(v interface{}) string {
+	b, err := json.Marshal(v)
+	if err != nil {
+		return fmt.Sprintf("%v", v)
+	}
+	return string(b)
+}
+
+// containsJSON returns the first difference if expected isn't a subset of actual.
+// Objects match if the actual object has all keys of the expected object and the values match.
+// Arrays are compared according to mode. Other values must be equal.
+// If expected is a subset of actual, containsJSON returns nil.
+func containsJSON(expected, actual interface{}, path string, mode JSONArrayMode) *jsonMismatch {
+	switch exp := expected.(type) {
+	case map[string]interface{}:
+		act, ok := actual.(map[string]interface{})
+		if !ok {
+			return &jsonMismatch{path: path, expected: compactJSON(expected), actual: compactJSON(actual)}
+		}
+		keys := make([]string, 0, len(exp))
+		for k := range exp {
+			keys = append(keys, k)
+		}
+		sort.Strings(keys)
+		for _, k := range keys {
+			p := jsonKeyPath(path, k)
+			a, ok := act[k]
+			if !ok {
+				return &jsonMismatch{path: p, expected: compactJSON(exp[k]), actual: "missing"}
+			}
+			if m := containsJSON(exp[k], a, p, mode); m != nil {
+				return m
+			}
+		}
+		return nil
+	case []interface{}:
+		act, ok := actual.([]interface{})
+		if !ok {
+			return &jsonMismatch{path: path, expected: compactJSON(expected), actual: compactJSON(actual)}
+		}
+		return containsJSONArray(exp, act, path, mode)
+	default:
+		if reflect.DeepEqual(expected, actual) {
+			return nil
+		}
+		return &jsonMismatch{path: path, expected: compactJSON(expected), actual: compactJSON(actual)}
+	}
+}
+
+func containsJSONArray(expected, actual []interface{}, path string, mode JSONArrayMode) *jsonMismatch {
+	if mode != JSONArrayContains && len(expected) != len(actual) {
+		return &jsonMismatch{
+			path:     path,
+			expected: fmt.Sprintf("%d elements %s", len(expected), compactJSON(expected)),
+			actual:   fmt.Sprintf("%d elements %s", len(actual), compactJSON(actual)),
+		}
+	}
+	if mode == JSONArrayOrdered {
+		for i, e := range expected {
+			if m := containsJSON(e, actual[i], jsonIndexPath(path, i), mode); m != nil {
+				return m
+			}
+		}
+		return nil
+	}
+	// match each expected element with a different actual element
+	matches := make([][]bool, len(expected))
+	for i, e := range expected {
+		matches[i] = make([]bool, len(actual))
+		for j, a := range actual {
+			matches[i][j] = containsJSON(e, a, "", mode) == nil
+		}
+	}
+	owners := make([]int, len(actual))
+	for j := range owners {
+		owners[j] = -1
+	}
+	for i := range expected {
+		if !assignElement(i, matches, owners, make([]bool, len(actual))) {
+			return &jsonMismatch{
+				path:     jsonIndexPath(path, i),
+				expected: compactJSON(expected[i]),
+				actual:   "no matching element in " + compactJSON(actual),
+			}
+		}
+	}
+	return nil
+}
+
+// assignElement finds the actual element for the expected element i by the augmenting path.
+// owners[j] is the expected element assigned to the actual element j, or -1.
+func assignElement(i int, matches [][]bool, owners []int, visited []bool) bool {
+	for j, ok := range matches[i] {
+		if !ok || visited[j] {
+			continue
+		}
+		visited[j] = true
+		if owners[j] < 0 || assignElement(owners[j], matches, owners, visited) {
+			owners[j] = i
+			return true
+		}
+	}
+	return false
+}
+
+// matchPartOfJSON returns the first difference if the expected JSON isn't a subset of the actual JSON.
+// If the expected JSON is invalid, matchPartOfJSON returns an error.
+func matchPartOfJSON(expected, actual []byte, mode JSONArrayMode) (*jsonMismatch, error) {
+	var exp interface{}
+	if err := json.Unmarshal(expected, &exp); err != nil {
+		return nil, fmt.Errorf("failed to parse the expected JSON: %w", err)
+	}
+	var act interface{}
+	if err := json.Unmarshal(actual, &act); err != nil {
+		return &jsonMismatch{
+			path:     "$",
+			expected: compactJSON(exp),
+			actual:   fmt.Sprintf("invalid JSON: %v", err),
+		}, nil
+	}
+	return containsJSON(exp, act, "$", mode), nil
+}
+
+// partOfBodyJSON returns the expected JSON of the partial JSON matching.
+// If the condition isn't set, partOfBodyJSON returns nil.
+// If both body and bodyString are set, partOfBodyJSON returns an error because it's ambiguous which is expected.
+func partOfBodyJSON(body interface{}, bodyString string) ([]byte, error) {
+	if body != nil && bodyString != "" {
+		return nil, errors.New("PartOfBodyJSON and PartOfBodyJSONString can't be set at the same time")
+	}
+	if bodyString != "" {
+		return []byte(bodyString), nil
+	}
+	if body == nil {
+		return nil, nil
+	}
+	b, err := json.Marshal(body)
+	if err != nil {
+		return nil, fmt.Errorf("failed to marshal PartOfBodyJSON as JSON: %w", err)
+	}
+	return b, nil
+}
+
+// findPartOfBodyJSONMismatch returns the first difference between the expected JSON and the request body.
+func findPartOfBodyJSONMismatch(req *http.Request, expected []byte, mode JSONArrayMode) (*jsonMismatch, error) {
+	if req.Body == nil {
+		return &jsonMismatch{path: "$", expected: string(expected), actual: "no body"}, nil
+	}
+	b, err := readBody(req)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read the request body: %w", err)
+	}
+	return matchPartOfJSON(expected, b, mode)
+}
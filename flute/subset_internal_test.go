@@ -0,0 +1,176 @@
+package flute
+
+import (
+	"io"
+	"net/http"
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/require"
+)
+
+func Test_matchPartOfJSON(t *testing.T) { //nolint:funlen
+	data := []struct {
+		title    string
+		expected string
+		actual   string
+		mode     JSONArrayMode
+		isErr    bool
+		exp      *jsonMismatch
+	}{
+		{
+			title:    "subset of the object",
+			expected: `{"name": "foo", "owner": {"id": 10}}`,
+			actual:   `{"id": "generated", "name": "foo", "owner": {"id": 10, "name": "bar"}, "created_at": "2024-01-01"}`,
+		},
+		{
+			title:    "value is different",
+			expected: `{"name": "foo", "owner": {"id": 10}}`,
+			actual:   `{"name": "foo", "owner": {"id": 11}}`,
+			exp:      &jsonMismatch{path: "$.owner.id", expected: "10", actual: "11"},
+		},
+		{
+			title:    "key is missing",
+			expected: `{"labels": {"app.kubernetes.io/name": "foo"}}`,
+			actual:   `{"labels": {}}`,
+			exp:      &jsonMismatch{path: `$.labels["app.kubernetes.io/name"]`, expected: `"foo"`, actual: "missing"},
+		},
+		{
+			title:    "type is different",
+			expected: `{"tags": ["a"]}`,
+			actual:   `{"tags": "a"}`,
+			exp:      &jsonMismatch{path: "$.tags", expected: `["a"]`, actual: `"a"`},
+		},
+		{
+			title:    "ordered array",
+			expected: `{"users": [{"name": "foo"}, {"name": "bar"}]}`,
+			actual:   `{"users": [{"id": 1, "name": "foo"}, {"id": 2, "name": "bar"}]}`,
+		},
+		{
+			title:    "ordered array in the different order",
+			expected: `{"users": [{"name": "foo"}, {"name": "bar"}]}`,
+			actual:   `{"users": [{"id": 2, "name": "bar"}, {"id": 1, "name": "foo"}]}`,
+			exp:      &jsonMismatch{path: "$.users[0].name", expected: `"foo"`, actual: `"bar"`},
+		},
+		{
+			title:    "ordered array with the different length",
+			expected: `[1, 2]`,
+			actual:   `[1, 2, 3]`,
+			exp:      &jsonMismatch{path: "$", expected: "2 elements [1,2]", actual: "3 elements [1,2,3]"},
+		},
+		{
+			title:    "unordered array",
+			expected: `{"users": [{"name": "foo"}, {"name": "bar"}]}`,
+			actual:   `{"users": [{"id": 2, "name": "bar"}, {"id": 1, "name": "foo"}]}`,
+			mode:     JSONArrayUnordered,
+		},
+		{
+			title:    "unordered array needs the different elements",
+			expected: `[{"a": 1}, {"a": 1, "b": 2}]`,
+			actual:   `[{"a": 1, "b": 2}, {"a": 1}]`,
+			mode:     JSONArrayUnordered,
+		},
+		{
+			title:    "unordered array doesn't have the element",
+			expected: `["a", "b"]`,
+			actual:   `["a", "a"]`,
+			mode:     JSONArrayUnordered,
+			exp:      &jsonMismatch{path: "$[1]", expected: `"b"`, actual: `no matching element in ["a","a"]`},
+		},
+		{
+			title:    "unordered array with the different length",
+			expected: `["a"]`,
+			actual:   `["a", "b"]`,
+			mode:     JSONArrayUnordered,
+			exp:      &jsonMismatch{path: "$", expected: `1 elements ["a"]`, actual: `2 elements ["a","b"]`},
+		},
+		{
+			title:    "contains",
+			expected: `{"tags": ["b", "d"]}`,
+			actual:   `{"tags": ["a", "b", "c", "d"]}`,
+			mode:     JSONArrayContains,
+		},
+		{
+			title:    "contains doesn't have the element",
+			expected: `{"tags": ["b", "e"]}`,
+			actual:   `{"tags": ["a", "b", "c", "d"]}`,
+			mode:     JSONArrayContains,
+			exp:      &jsonMismatch{path: "$.tags[1]", expected: `"e"`, actual: `no matching element in ["a","b","c","d"]`},
+		},
+		{
+			title:    "actual is invalid",
+			expected: `{}`,
+			actual:   `foo`,
+			exp: &jsonMismatch{
+				path: "$", expected: "{}",
+				actual: "invalid JSON: invalid character 'o' in literal false (expecting 'a')",
+			},
+		},
+		{
+			title:    "expected is invalid",
+			expected: `{`,
+			actual:   `{}`,
+			isErr:    true,
+		},
+	}
+
+	for _, d := range data {
+		d := d
+		t.Run(d.title, func(t *testing.T) {
+			m, err := matchPartOfJSON([]byte(d.expected), []byte(d.actual), d.mode)
+			if d.isErr {
+				require.Error(t, err)
+				return
+			}
+			require.NoError(t, err)
+			require.Equal(t, d.exp, m)
+		})
+	}
+}
+
+func Test_testPartOfBodyJSON(t *testing.T) {
+	tb := newFakeTB(t)
+	req := &http.Request{
+		Body: io.NopCloser(strings.NewReader(`{"id": "generated", "name": "foo", "tags": ["b", "a"]}`)),
+	}
+	testPartOfBodyJSON(tb, req, Service{Endpoint: "http://example.com"}, Route{
+		Name: "create a user",
+		Tester: Tester{
+			PartOfBodyJSON: map[string]interface{}{
+				"name": "bar",
+				"tags": []string{"a", "b"},
+			},
+			PartOfBodyJSONArrayMode: JSONArrayUnordered,
+		},
+	})
+	errs := tb.Errors()
+	require.Len(t, errs, 1)
+	require.Contains(t, errs[0], "request body should contain the expected JSON")
+	require.Contains(t, errs[0], `path: $.name`)
+	require.Contains(t, errs[0], `expected: "bar"`)
+	require.Contains(t, errs[0], `actual: "foo"`)
+}
+
+func Test_testPartOfBodyJSON_conflict(t *testing.T) {
+	tb := newFakeTB(t)
+	req := &http.Request{
+		Body: io.NopCloser(strings.NewReader(`{"name": "foo"}`)),
+	}
+	route := Route{
+		Name: "create a user",
+		Matcher: Matcher{
+			PartOfBodyJSON:       map[string]interface{}{"name": "foo"},
+			PartOfBodyJSONString: `{"name": "bar"}`,
+		},
+		Tester: Tester{
+			PartOfBodyJSON:       map[string]interface{}{"name": "foo"},
+			PartOfBodyJSONString: `{"name": "bar"}`,
+		},
+	}
+	_, err := matchPartOfBodyJSON(req, route.Matcher)
+	require.Error(t, err)
+	testPartOfBodyJSON(tb, req, Service{Endpoint: "http://example.com"}, route)
+	errs := tb.Errors()
+	require.Len(t, errs, 1)
+	require.Contains(t, errs[0], "PartOfBodyJSON and PartOfBodyJSONString can't be set at the same time")
+}
@@ -3,7 +3,6 @@ package flute
 import (
 	"encoding/json"
 	"fmt"
-	"io"
 	"net/http"
 	"strings"
 	"testing"
@@ -11,15 +10,18 @@ import (
 	"github.com/stretchr/testify/assert"
 )
 
-type testFunc func(t *testing.T, req *http.Request, service Service, route Route)
+type testFunc func(t testing.TB, req *http.Request, service Service, route Route)
 
 var testFuncs = [...]testFunc{ //nolint:gochecknoglobals
 	testPath, testMethod, testBodyString, testBodyJSON,
 	testBodyJSONString, testPartOfHeader, testHeader, testPartOfQuery,
-	testQuery,
+	testQuery, testPathMatcher, testHeaderMatcher, testQueryMatcher,
+	testPartOfBodyJSON, testBodyJSONExprs, testPartOfForm, testForm,
+	testMultipart, testContentEncoding, testBodyXML, testGraphQL, testJSONRPC,
+	testCookie, testAbsentCookies, testAuth,
 }
 
-func testHeader(t *testing.T, req *http.Request, service Service, route Route) {
+func testHeader(t testing.TB, req *http.Request, service Service, route Route) {
 	if route.Tester.Header == nil {
 		return
 	}
@@ -28,7 +30,7 @@ func testHeader(t *testing.T, req *http.Request, service Service, route Route) {
 		makeMsg("request header should match", service.Endpoint, route.Name))
 }
 
-func testQuery(t *testing.T, req *http.Request, service Service, route Route) {
+func testQuery(t testing.TB, req *http.Request, service Service, route Route) {
 	if route.Tester.Query == nil {
 		return
 	}
@@ -37,13 +39,25 @@ func testQuery(t *testing.T, req *http.Request, service Service, route Route) {
 		makeMsg("request query parameter should match", service.Endpoint, route.Name))
 }
 
-func testRequest(t *testing.T, req *http.Request, service Service, route Route) {
+func testRequest(t testing.TB, req *http.Request, service Service, route Route) {
 	for _, fn := range testFuncs {
 		fn(t, req, service, route)
 	}
 	tester := route.Tester
+	if tester.TestTB != nil {
+		rewindBody(req)
+		tester.TestTB(t, req, service, route)
+	}
 	if tester.Test != nil {
-		tester.Test(t, req, service, route)
+		rewindBody(req)
+		tt, ok := t.(*testing.T)
+		if !ok {
+			assert.Fail(
+				t, makeMsg(
+					"Tester.Test requires *testing.T. Use Tester.TestTB instead", service.Endpoint, route.Name))
+			return
+		}
+		tester.Test(tt, req, service, route)
 	}
 }
 
@@ -53,7 +67,7 @@ service: %s
 request name: %s`, msg, srv, reqName)
 }
 
-func testBodyString(t *testing.T, req *http.Request, service Service, route Route) {
+func testBodyString(t testing.TB, req *http.Request, service Service, route Route) {
 	if route.Tester.BodyString == "" {
 		return
 	}
@@ -64,7 +78,7 @@ func testBodyString(t *testing.T, req *http.Request, service Service, route Rout
 			makeMsg("request body should match", service.Endpoint, route.Name))
 		return
 	}
-	b, err := io.ReadAll(req.Body)
+	b, err := readBody(req)
 	if err != nil {
 		assert.Fail(
 			t, makeMsg(
@@ -77,7 +91,7 @@ func testBodyString(t *testing.T, req *http.Request, service Service, route Rout
 		makeMsg("request body should match", service.Endpoint, route.Name))
 }
 
-func testPath(t *testing.T, req *http.Request, service Service, route Route) {
+func testPath(t testing.TB, req *http.Request, service Service, route Route) {
 	if route.Tester.Path == "" {
 		return
 	}
@@ -86,7 +100,7 @@ func testPath(t *testing.T, req *http.Request, service Service, route Route) {
 		makeMsg("request path should match", service.Endpoint, route.Name))
 }
 
-func testMethod(t *testing.T, req *http.Request, service Service, route Route) {
+func testMethod(t testing.TB, req *http.Request, service Service, route Route) {
 	if route.Tester.Method == "" {
 		return
 	}
@@ -96,7 +110,7 @@ func testMethod(t *testing.T, req *http.Request, service Service, route Route) {
 		makeMsg("request method should match", service.Endpoint, route.Name))
 }
 
-func testBodyJSON(t *testing.T, req *http.Request, service Service, route Route) {
+func testBodyJSON(t testing.TB, req *http.Request, service Service, route Route) {
 	if route.Tester.BodyJSON == nil {
 		return
 	}
@@ -107,7 +121,7 @@ func testBodyJSON(t *testing.T, req *http.Request, service Service, route Route)
 			makeMsg("request body should match", service.Endpoint, route.Name))
 		return
 	}
-	b, err := io.ReadAll(req.Body)
+	b, err := readBody(req)
 	if err != nil {
 		assert.Fail(
 			t, makeMsg(
@@ -127,7 +141,7 @@ func testBodyJSON(t *testing.T, req *http.Request, service Service, route Route)
 		makeMsg("request body should match", service.Endpoint, route.Name))
 }
 
-func testBodyJSONString(t *testing.T, req *http.Request, service Service, route Route) {
+func testBodyJSONString(t testing.TB, req *http.Request, service Service, route Route) {
 	if route.Tester.BodyJSONString == "" {
 		return
 	}
@@ -138,7 +152,7 @@ func testBodyJSONString(t *testing.T, req *http.Request, service Service, route
 			makeMsg("request body should match", service.Endpoint, route.Name))
 		return
 	}
-	b, err := io.ReadAll(req.Body)
+	b, err := readBody(req)
 	if err != nil {
 		assert.Fail(
 			t, makeMsg(
@@ -151,7 +165,7 @@ func testBodyJSONString(t *testing.T, req *http.Request, service Service, route
 		makeMsg("request body should match", service.Endpoint, route.Name))
 }
 
-func testPartOfHeader(t *testing.T, req *http.Request, service Service, route Route) {
+func testPartOfHeader(t testing.TB, req *http.Request, service Service, route Route) {
 	if route.Tester.PartOfHeader == nil {
 		return
 	}
@@ -172,7 +186,7 @@ func testPartOfHeader(t *testing.T, req *http.Request, service Service, route Ro
 	}
 }
 
-func testPartOfQuery(t *testing.T, req *http.Request, service Service, route Route) {
+func testPartOfQuery(t testing.TB, req *http.Request, service Service, route Route) {
 	if route.Tester.PartOfQuery == nil {
 		return
 	}
@@ -193,3 +207,255 @@ func testPartOfQuery(t *testing.T, req *http.Request, service Service, route Rou
 		}
 	}
 }
+
+func testPathMatcher(t testing.TB, req *http.Request, service Service, route Route) {
+	vm := route.Tester.PathMatcher
+	if vm == nil || vm.MatchValue(req.URL.Path) {
+		return
+	}
+	assert.Fail(
+		t, makeMsg(
+			fmt.Sprintf("request path should %s\nactual: %q", vm, req.URL.Path),
+			service.Endpoint, route.Name))
+}
+
+func testHeaderMatcher(t testing.TB, req *http.Request, service Service, route Route) {
+	if route.Tester.HeaderMatcher == nil {
+		return
+	}
+	testValueMismatches(
+		t, "header", findValueMismatches(route.Tester.HeaderMatcher, headerValues(req)), service, route)
+}
+
+func testQueryMatcher(t testing.TB, req *http.Request, service Service, route Route) {
+	if route.Tester.QueryMatcher == nil {
+		return
+	}
+	testValueMismatches(
+		t, "query", findValueMismatches(route.Tester.QueryMatcher, queryValues(req)), service, route)
+}
+
+func testCookie(t testing.TB, req *http.Request, service Service, route Route) {
+	if route.Tester.Cookie == nil {
+		return
+	}
+	testValueMismatches(
+		t, "cookie", findValueMismatches(route.Tester.Cookie, cookieValues(req)), service, route)
+}
+
+func testAbsentCookies(t testing.TB, req *http.Request, service Service, route Route) {
+	for _, name := range findPresentCookies(req, route.Tester.AbsentCookies) {
+		assert.Fail(
+			t, makeMsg(
+				fmt.Sprintf("the following request cookie shouldn't be sent: %s", name),
+				service.Endpoint, route.Name))
+	}
+}
+
+func testValueMismatches(t testing.TB, name string, mismatches []valueMismatch, service Service, route Route) {
+	for _, m := range mismatches {
+		if !m.found {
+			assert.Fail(
+				t, makeMsg(
+					fmt.Sprintf("the following request %s is required: %s", name, m.key),
+					service.Endpoint, route.Name))
+			continue
+		}
+		assert.Fail(
+			t, makeMsg(
+				fmt.Sprintf("the request %s %q should %s\nactual: %s", name, m.key, m.expected(), m.actual()),
+				service.Endpoint, route.Name))
+	}
+}
+
+func testPartOfBodyJSON(t testing.TB, req *http.Request, service Service, route Route) {
+	expected, err := partOfBodyJSON(route.Tester.PartOfBodyJSON, route.Tester.PartOfBodyJSONString)
+	if err != nil {
+		assert.Fail(t, makeMsg(err.Error(), service.Endpoint, route.Name))
+		return
+	}
+	if expected == nil {
+		return
+	}
+	m, err := findPartOfBodyJSONMismatch(req, expected, route.Tester.PartOfBodyJSONArrayMode)
+	if err != nil {
+		assert.Fail(t, makeMsg(err.Error(), service.Endpoint, route.Name))
+		return
+	}
+	if m == nil {
+		return
+	}
+	assert.Fail(
+		t, makeMsg(
+			"request body should contain the expected JSON\n"+m.String(),
+			service.Endpoint, route.Name))
+}
+
+func testBodyJSONExprs(t testing.TB, req *http.Request, service Service, route Route) {
+	if len(route.Tester.BodyJSONExprs) == 0 {
+		return
+	}
+	failures, err := findJSONExprFailures(req, route.Tester.BodyJSONExprs)
+	if err != nil {
+		assert.Fail(t, makeMsg(err.Error(), service.Endpoint, route.Name))
+		return
+	}
+	for _, f := range failures {
+		assert.Fail(
+			t, makeMsg(
+				fmt.Sprintf("the request body should meet the expression: %s\nactual: %s", f.expr, f.actual),
+				service.Endpoint, route.Name))
+	}
+}
+
+func testForm(t testing.TB, req *http.Request, service Service, route Route) {
+	if route.Tester.Form == nil {
+		return
+	}
+	form, err := readForm(req)
+	if err != nil {
+		assert.Fail(t, makeMsg(err.Error(), service.Endpoint, route.Name))
+		return
+	}
+	assert.Equal(
+		t, route.Tester.Form, form,
+		makeMsg("request form should match", service.Endpoint, route.Name))
+}
+
+func testPartOfForm(t testing.TB, req *http.Request, service Service, route Route) {
+	if route.Tester.PartOfForm == nil {
+		return
+	}
+	form, err := readForm(req)
+	if err != nil {
+		assert.Fail(t, makeMsg(err.Error(), service.Endpoint, route.Name))
+		return
+	}
+	for k, v := range route.Tester.PartOfForm {
+		a, ok := form[k]
+		if !ok {
+			assert.Fail(
+				t, makeMsg(
+					"the following request form is required: "+k, service.Endpoint, route.Name))
+			return
+		}
+		if v != nil {
+			assert.Equal(
+				t, v, a,
+				makeMsg(fmt.Sprintf(`the request form "%s" should match`, k), service.Endpoint, route.Name))
+		}
+	}
+}
+
+func testMultipart(t testing.TB, req *http.Request, service Service, route Route) {
+	if route.Tester.Multipart == nil {
+		return
+	}
+	mismatches, err := findMultipartMismatches(req, route.Tester.Multipart)
+	if err != nil {
+		assert.Fail(t, makeMsg(err.Error(), service.Endpoint, route.Name))
+		return
+	}
+	for _, m := range mismatches {
+		assert.Fail(t, makeMsg(m.String(), service.Endpoint, route.Name))
+	}
+}
+
+func testContentEncoding(t testing.TB, req *http.Request, service Service, route Route) {
+	if route.Tester.ContentEncoding == "" {
+		return
+	}
+	d := requestContentDecoding(req)
+	actual := strings.Join(d.encodings, ", ")
+	if !strings.EqualFold(route.Tester.ContentEncoding, actual) {
+		assert.Fail(
+			t, makeMsg(
+				fmt.Sprintf("the request Content-Encoding should be %q\nactual: %q", route.Tester.ContentEncoding, actual),
+				service.Endpoint, route.Name))
+		return
+	}
+	if d.err != nil {
+		assert.Fail(
+			t, makeMsg(
+				fmt.Sprintf("the request body should be encoded with %q: %v", route.Tester.ContentEncoding, d.err),
+				service.Endpoint, route.Name))
+	}
+}
+
+func testBodyXML(t testing.TB, req *http.Request, service Service, route Route) {
+	expected, err := bodyXML(route.Tester.BodyXML, route.Tester.BodyXMLString)
+	if err != nil {
+		assert.Fail(t, makeMsg(err.Error(), service.Endpoint, route.Name))
+		return
+	}
+	if expected == nil {
+		return
+	}
+	exp, err := canonicalXML(expected)
+	if err != nil {
+		assert.Fail(
+			t, makeMsg(
+				fmt.Sprintf("the expected body is invalid: %v", err), service.Endpoint, route.Name))
+		return
+	}
+	if req.Body == nil {
+		assert.Fail(t, makeMsg("request body should match as XML\nactual: no body", service.Endpoint, route.Name))
+		return
+	}
+	b, err := readBody(req)
+	if err != nil {
+		assert.Fail(
+			t, makeMsg(
+				fmt.Sprintf("failed to read the request body: %v", err), service.Endpoint, route.Name))
+		return
+	}
+	act, err := canonicalXML(b)
+	if err != nil {
+		assert.Fail(
+			t, makeMsg(
+				fmt.Sprintf("request body should be a valid XML: %v", err), service.Endpoint, route.Name))
+		return
+	}
+	assert.Equal(
+		t, exp, act,
+		makeMsg("request body should match as XML", service.Endpoint, route.Name))
+}
+
+func testGraphQL(t testing.TB, req *http.Request, service Service, route Route) {
+	if route.Tester.GraphQL == nil {
+		return
+	}
+	mismatches, err := findGraphQLMismatches(req, route.Tester.GraphQL)
+	if err != nil {
+		assert.Fail(t, makeMsg(err.Error(), service.Endpoint, route.Name))
+		return
+	}
+	for _, m := range mismatches {
+		assert.Fail(t, makeMsg(m.String(), service.Endpoint, route.Name))
+	}
+}
+
+func testJSONRPC(t testing.TB, req *http.Request, service Service, route Route) {
+	if route.Tester.JSONRPC == nil {
+		return
+	}
+	mismatches, err := findJSONRPCMismatches(req, route.Tester.JSONRPC)
+	if err != nil {
+		assert.Fail(t, makeMsg(err.Error(), service.Endpoint, route.Name))
+		return
+	}
+	for _, m := range mismatches {
+		assert.Fail(t, makeMsg(m.String(), service.Endpoint, route.Name))
+	}
+}
+
+func testAuth(t testing.TB, req *http.Request, service Service, route Route) {
+	f, err := findAuthFailure(req, route.Tester.Auth)
+	if err != nil {
+		assert.Fail(t, makeMsg(err.Error(), service.Endpoint, route.Name))
+		return
+	}
+	if f != nil {
+		assert.Fail(t, makeMsg(f.String(), service.Endpoint, route.Name))
+	}
+}
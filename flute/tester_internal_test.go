@@ -76,6 +76,23 @@ func Test_testRequest(t *testing.T) { //nolint:funlen
 				},
 			},
 		},
+		{
+			title: "custom test function with testing.TB",
+			req: &http.Request{
+				Method: http.MethodGet,
+				URL: &url.URL{
+					Path: "/users",
+				},
+			},
+			service: Service{},
+			route: Route{
+				Tester: Tester{
+					TestTB: func(t testing.TB, req *http.Request, service Service, route Route) {
+						require.Equal(t, "/users", req.URL.Path)
+					},
+				},
+			},
+		},
 		{
 			title: "body string",
 			req: &http.Request{
@@ -9,7 +9,6 @@ import (
 	"testing"
 
 	"github.com/stretchr/testify/assert"
-	"github.com/stretchr/testify/require"
 )
 
 const (
@@ -26,41 +25,179 @@ body:
 
 // RoundTrip implements http.RoundTripper.
 // RoundTrip traverses the matched route and run the test and returns response.
+// The request body is read only once, and every matcher, tester, and response function
+// gets a fresh reader of the body, so they can read the body independently.
+// If the request has the Content-Encoding header, the body is decoded before it is given to them.
+// The Content-Encoding header is kept, but ContentLength of the request given to the route is the length of the decoded body.
+// Transport.Transport and Journal get the body as it was sent.
+// A batch of GraphQL operations or JSON-RPC calls is split and each of them is routed separately,
+// and the responses are combined into a response.
 func (transport Transport) RoundTrip(req *http.Request) (*http.Response, error) {
-	for _, service := range transport.Services {
-		service := service
-		if !isMatchService(req, service) {
+	// RoundTrip shouldn't modify the request, so replace the body of the shallow copy.
+	req = req.WithContext(req.Context())
+	body, err := readBody(req)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read the request body: %w", err)
+	}
+	// the request signature such as HMAC is calculated with the body as it was sent
+	req = withRawBody(req, body)
+	// the body is decoded only once and the decoded body is shared by the batch splitting and routing
+	req, decoded, err := transport.decodeRequestBody(req, body)
+	if err != nil {
+		transport.logf("the request body is matched without decoding: %v", err)
+	}
+	if ops, protocol, ok := transport.splitBatch(req, decoded); ok {
+		return transport.roundTripBatch(req, body, ops, protocol)
+	}
+	return transport.roundTrip(req, body, decoded)
+}
+
+// roundTrip routes the request and returns the response.
+// req is the shallow copy of the original request which has the result of decodeRequestBody.
+// body is the request body as it was sent, and decoded is the body decoded according to Content-Encoding.
+func (transport Transport) roundTrip(req *http.Request, body, decoded []byte) (*http.Response, error) {
+	var entry *Entry
+	if transport.Journal != nil {
+		entry = transport.Journal.newEntry(req, body)
+	}
+	service, route, routeReq := transport.findRoute(req, decoded)
+	if route != nil {
+		// the cookie path is compared to the path which the client sent
+		transport.checkSession(req, *service, *route)
+		req = routeReq
+		setBody(req, decoded)
+		if d := requestContentDecoding(req); len(d.encodings) != 0 && d.err == nil {
+			// ContentLength describes the decoded body given to the route
+			req.ContentLength = int64(len(decoded))
+		}
+	} else if transport.Transport == nil {
+		// the closest routes are diagnosed with the decoded body like findRoute
+		setBody(req, decoded)
+	} else {
+		// the request is forwarded as it was sent
+		setBody(req, body)
+	}
+	resp, err := transport.respond(req, service, route)
+	if route != nil && err == nil {
+		transport.updateSession(*service, *route, resp)
+	}
+	if entry != nil {
+		if route != nil {
+			entry.Matched = true
+			entry.Service = *service
+			entry.Route = *route
+		}
+		entry.Response = resp
+		entry.Err = err
+		transport.Journal.add(*entry)
+	}
+	return resp, err
+}
+
+// findRoute returns the first route which matches the request.
+// findRoute also returns the request given to the route,
+// whose path is relative to the base path of the service endpoint.
+// If no route matches the request, findRoute returns nil.
+func (transport Transport) findRoute(req *http.Request, body []byte) (*Service, *Route, *http.Request) {
+	for i := range transport.Services {
+		service := &transport.Services[i]
+		ep, f, err := matchService(req, *service)
+		if err != nil {
+			transport.reportInvalidEndpoint(*service, err)
+		}
+		if !f {
 			continue
 		}
-		for _, route := range service.Routes {
-			route := route
-			b, err := isMatch(req, route.Matcher)
+		routeReq := ep.relativeRequest(req)
+		for j := range service.Routes {
+			route := &service.Routes[j]
+			if !isMatchScenario(*route) {
+				continue
+			}
+			setBody(routeReq, body)
+			b, err := isMatch(routeReq, route.Matcher)
 			if err != nil {
-				if transport.T != nil {
-					transport.T.Logf("failed to check whether the route matches the request: %v", err)
-				} else {
-					fmt.Fprintf(os.Stderr, "failed to check whether the route matches the request: %v\n", err)
-				}
+				transport.logf("failed to check whether the route matches the request: %v", err)
 			}
 			if !b {
 				continue
 			}
-			// test
-			if transport.T != nil {
-				testRequest(transport.T, req, service, route)
+			if !transitScenario(*route) {
+				// another request has changed the scenario state after the check
+				continue
+			}
+			if route.Expect != nil {
+				route.Expect.called()
 			}
-			// return response
-			return createHTTPResponse(req, route.Response)
+			return service, route, routeReq
+		}
+	}
+	return nil, nil, nil
+}
+
+// reportInvalidEndpoint fails the test because the service has an invalid endpoint.
+// If T isn't set, the error is written to the standard error output.
+func (transport Transport) reportInvalidEndpoint(service Service, err error) {
+	if transport.T == nil {
+		transport.logf("the service has an invalid endpoint: %v", err)
+		return
+	}
+	assert.Fail(transport.T, fmt.Sprintf("the service has an invalid endpoint: %v\nservice: %s", err, service.Endpoint))
+}
+
+// logf logs the message with T, or writes it to the standard error output if T isn't set.
+func (transport Transport) logf(format string, args ...interface{}) {
+	if transport.T != nil {
+		transport.T.Logf(format, args...)
+		return
+	}
+	fmt.Fprintf(os.Stderr, format+"\n", args...)
+}
+
+// respond runs the test and returns the response of the route.
+// If route is nil, respond calls transport.Transport or fails the test.
+func (transport Transport) respond(req *http.Request, service *Service, route *Route) (*http.Response, error) {
+	if route == nil {
+		// no route matches the request
+		if transport.Transport != nil {
+			return transport.Transport.RoundTrip(req)
+		}
+		if resp, ok := transport.unmatchedJSONRPCRoundTrip(req); ok {
+			return resp, nil
 		}
+		return noMatchedRouteRoundTrip(transport.T, req, transport.Services)
 	}
-	// no route matches the request
-	if transport.Transport != nil {
-		return transport.Transport.RoundTrip(req)
+	transport.checkOrders(*service, *route)
+	req = withPathValues(req, route.Matcher.Path)
+	// test
+	if transport.T != nil {
+		testRequest(transport.T, req, *service, *route)
+		rewindBody(req)
+	}
+	response := route.Response
+	if route.Sequence != nil {
+		step, idx, ok := route.Sequence.next()
+		if !ok {
+			if transport.T != nil {
+				assert.Fail(
+					transport.T, makeMsg(
+						fmt.Sprintf("the route is called more times than the number of the sequence steps (%d)", len(route.Sequence.Steps)),
+						service.Endpoint, route.Name))
+			}
+			return nil, errSequenceExhausted
+		}
+		if transport.T != nil {
+			testRequest(transport.T, req, *service, stepRoute(*route, step, idx))
+			rewindBody(req)
+		}
+		response = step.Response
 	}
-	return noMatchedRouteRoundTrip(transport.T, req)
+	// return response
+	// the response gets the URL which the client sent as http.Response.Request
+	return createHTTPResponse(withOriginalURL(req), response)
 }
 
-func makeNoMatchedRouteMsg(t *testing.T, req *http.Request) string {
+func makeNoMatchedRouteMsg(t testing.TB, req *http.Request) string {
 	query := req.URL.Query()
 	qArr := make([]string, len(query))
 	i := 0
@@ -78,7 +215,7 @@ func makeNoMatchedRouteMsg(t *testing.T, req *http.Request) string {
 
 	body := ""
 	if req.Body != nil {
-		b, err := io.ReadAll(req.Body)
+		b, err := readBody(req)
 		if err != nil {
 			assert.Nil(t, err, "failed to reqd the request body")
 		} else {
@@ -95,9 +232,20 @@ func makeNoMatchedRouteMsg(t *testing.T, req *http.Request) string {
 	)
 }
 
-func noMatchedRouteRoundTrip(t *testing.T, req *http.Request) (*http.Response, error) {
+// makeNoMatchedRouteMsgWithCandidates returns the failure message of the request which no route matches
+// with the routes closest to the request.
+func makeNoMatchedRouteMsgWithCandidates(t testing.TB, req *http.Request, services []Service) string {
+	msg := makeNoMatchedRouteMsg(t, req)
+	if c := makeCandidatesMsg(req, services); c != "" {
+		msg += "\n" + c
+	}
+	return msg
+}
+
+func noMatchedRouteRoundTrip(t testing.TB, req *http.Request, services []Service) (*http.Response, error) {
 	if t != nil {
-		require.Fail(t, makeNoMatchedRouteMsg(t, req))
+		// RoundTrip may be called in a goroutine other than the test, where FailNow must not be called
+		assert.Fail(t, makeNoMatchedRouteMsgWithCandidates(t, req, services))
 	}
 	return &http.Response{
 		Request:    req,
@@ -105,3 +253,21 @@ func noMatchedRouteRoundTrip(t *testing.T, req *http.Request) (*http.Response, e
 		Body:       io.NopCloser(strings.NewReader(`{"message": "no route matches the request"}`)),
 	}, nil
 }
+
+// NewTransport returns a new Transport.
+// If t isn't nil, the expectations of the routes and the orders are verified when the test ends.
+// The returned Transport is verified as it is at the end of the test,
+// so the services and orders set after NewTransport are verified too.
+// *Transport implements http.RoundTripper and can be shared by goroutines and parallel tests.
+func NewTransport(t testing.TB, services ...Service) *Transport {
+	transport := &Transport{
+		T:        t,
+		Services: services,
+	}
+	if t != nil {
+		t.Cleanup(func() {
+			transport.Verify(t)
+		})
+	}
+	return transport
+}
@@ -54,7 +54,7 @@ body:
 
 func Test_noMatchedRouteRoundTrip(t *testing.T) {
 	data := []struct {
-		t          *testing.T
+		t          testing.TB
 		title      string
 		req        *http.Request
 		statusCode int
@@ -73,7 +73,7 @@ func Test_noMatchedRouteRoundTrip(t *testing.T) {
 	for _, d := range data {
 		d := d
 		t.Run(d.title, func(t *testing.T) {
-			resp, err := noMatchedRouteRoundTrip(d.t, d.req)
+			resp, err := noMatchedRouteRoundTrip(d.t, d.req, nil)
 			if resp != nil && resp.Body != nil {
 				_, _ = io.Copy(io.Discard, resp.Body)
 				resp.Body.Close()
@@ -87,3 +87,26 @@ func Test_noMatchedRouteRoundTrip(t *testing.T) {
 		})
 	}
 }
+
+// failNowTB is a fakeTB which records whether FailNow is called.
+type failNowTB struct {
+	*fakeTB
+	failNow bool
+}
+
+func (tb *failNowTB) FailNow() {
+	tb.failNow = true
+}
+
+func Test_noMatchedRouteRoundTrip_doesNotFailNow(t *testing.T) {
+	tb := &failNowTB{fakeTB: newFakeTB(t)}
+	resp, err := noMatchedRouteRoundTrip(tb, &http.Request{
+		Method: http.MethodGet,
+		URL:    &url.URL{Scheme: "http", Host: "example.com", Path: "/users"},
+	}, nil)
+	require.NoError(t, err)
+	resp.Body.Close()
+	require.Equal(t, http.StatusNotFound, resp.StatusCode)
+	require.False(t, tb.failNow)
+	require.Len(t, tb.Errors(), 1)
+}
@@ -1,13 +1,23 @@
 package flute_test
 
 import (
+	"bytes"
+	"compress/gzip"
+	"context"
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/hex"
 	"errors"
+	"fmt"
 	"io"
 	"net/http"
+	"net/http/cookiejar"
 	"net/url"
 	"strings"
+	"sync"
 	"testing"
 
+	"github.com/stretchr/testify/assert"
 	"github.com/stretchr/testify/require"
 	"github.com/suzuki-shunsuke/flute/v2/flute"
 	"github.com/suzuki-shunsuke/gomic/gomic"
@@ -231,6 +241,7 @@ func TestTransport_RoundTrip(t *testing.T) { //nolint:funlen
 func BenchmarkTransport_RoundTrip(b *testing.B) { //nolint:funlen
 	token := "XXXXX"
 	transport := flute.Transport{
+		T: b,
 		Services: []flute.Service{
 			{
 				Endpoint: "http://example.org",
@@ -292,3 +303,1529 @@ func BenchmarkTransport_RoundTrip(b *testing.B) { //nolint:funlen
 		resp.Body.Close()
 	}
 }
+
+func TestTransport_Verify(t *testing.T) {
+	transport := flute.Transport{
+		T: t,
+		Services: []flute.Service{
+			{
+				Endpoint: "http://example.com",
+				Routes: []flute.Route{
+					{
+						Name: "create a user",
+						Matcher: flute.Matcher{
+							Method: http.MethodPost,
+							Path:   "/users",
+						},
+						Response: flute.Response{
+							Base: http.Response{
+								StatusCode: http.StatusCreated,
+							},
+						},
+						Expect: flute.Once(),
+					},
+					{
+						Name: "delete a user",
+						Matcher: flute.Matcher{
+							Method: http.MethodDelete,
+						},
+						Expect: flute.Never(),
+					},
+					{
+						Name: "get a user",
+						Matcher: flute.Matcher{
+							Method: http.MethodGet,
+						},
+						Expect: flute.AtMost(1),
+					},
+				},
+			},
+		},
+	}
+	transport.VerifyAtCleanup(t)
+	resp, err := transport.RoundTrip(&http.Request{
+		URL: &url.URL{
+			Scheme: "http",
+			Host:   "example.com",
+			Path:   "/users",
+		},
+		Method: http.MethodPost,
+	})
+	require.NoError(t, err)
+	resp.Body.Close()
+	require.Equal(t, http.StatusCreated, resp.StatusCode)
+	require.Equal(t, 1, transport.Services[0].Routes[0].Expect.Count())
+	require.Equal(t, 0, transport.Services[0].Routes[1].Expect.Count())
+}
+
+func TestTransport_RoundTrip_testingTB(t *testing.T) {
+	tb := flute.NewFakeTB(t)
+	transport := flute.Transport{
+		T: tb,
+		Services: []flute.Service{
+			{
+				Endpoint: "http://example.com",
+				Routes: []flute.Route{
+					{
+						Name: "create a user",
+						Matcher: flute.Matcher{
+							Method: http.MethodPost,
+						},
+						Tester: flute.Tester{
+							Path: "/users",
+							TestTB: func(tb testing.TB, req *http.Request, service flute.Service, route flute.Route) {
+								tb.Errorf("custom test is called")
+							},
+							Test: func(t *testing.T, req *http.Request, service flute.Service, route flute.Route) { //nolint:staticcheck
+								t.Errorf("deprecated custom test is called")
+							},
+						},
+						Expect: flute.Never(),
+					},
+				},
+			},
+		},
+	}
+	for _, p := range []string{"/users", "/groups"} {
+		resp, err := transport.RoundTrip(&http.Request{
+			URL: &url.URL{
+				Scheme: "http",
+				Host:   "example.com",
+				Path:   p,
+			},
+			Method: http.MethodPost,
+		})
+		require.NoError(t, err)
+		resp.Body.Close()
+	}
+	transport.Verify(tb)
+
+	errs := tb.Errors()
+	require.Len(t, errs, 6)
+	require.Contains(t, errs[0], "custom test is called")
+	require.Contains(t, errs[1], "Tester.Test requires *testing.T")
+	require.Contains(t, errs[2], "request path should match")
+	require.Contains(t, errs[3], "custom test is called")
+	require.Contains(t, errs[4], "Tester.Test requires *testing.T")
+	require.Contains(t, errs[5], "the route should be called exactly 0 times, but it was called 2 times")
+}
+
+func TestTransport_RoundTrip_body(t *testing.T) { //nolint:funlen
+	body := `{"name": "foo"}`
+	readAll := func(t testing.TB, req *http.Request) string {
+		b, err := io.ReadAll(req.Body)
+		require.NoError(t, err)
+		return string(b)
+	}
+	transport := flute.Transport{
+		T: t,
+		Services: []flute.Service{
+			{
+				Endpoint: "http://example.com",
+				Routes: []flute.Route{
+					{
+						Matcher: flute.Matcher{
+							BodyString: "bar",
+						},
+					},
+					{
+						Name: "create a user",
+						Matcher: flute.Matcher{
+							Match: func(req *http.Request) (bool, error) {
+								return readAll(t, req) == body, nil
+							},
+							BodyJSONString: body,
+						},
+						Tester: flute.Tester{
+							BodyString:     body,
+							BodyJSONString: body,
+							TestTB: func(tb testing.TB, req *http.Request, service flute.Service, route flute.Route) {
+								require.Equal(tb, body, readAll(tb, req))
+							},
+						},
+						Response: flute.Response{
+							Response: func(req *http.Request) (*http.Response, error) {
+								require.Equal(t, body, readAll(t, req))
+								b, err := req.GetBody()
+								require.NoError(t, err)
+								require.Equal(t, body, readAll(t, &http.Request{Body: b}))
+								return &http.Response{
+									StatusCode: http.StatusCreated,
+									Body:       http.NoBody,
+								}, nil
+							},
+						},
+					},
+				},
+			},
+		},
+		Transport: flute.NewMockRoundTripper(t, gomic.DoNothing).
+			SetFuncRoundTrip(func(req *http.Request) (*http.Response, error) {
+				require.Equal(t, body, readAll(t, req))
+				return &http.Response{
+					StatusCode: http.StatusNotFound,
+					Body:       http.NoBody,
+				}, nil
+			}),
+	}
+	req := &http.Request{
+		URL: &url.URL{
+			Scheme: "http",
+			Host:   "example.com",
+			Path:   "/users",
+		},
+		Method: http.MethodPost,
+		Body:   io.NopCloser(strings.NewReader(body)),
+	}
+	origBody := req.Body
+	resp, err := transport.RoundTrip(req)
+	require.NoError(t, err)
+	resp.Body.Close()
+	require.Equal(t, http.StatusCreated, resp.StatusCode)
+	require.Equal(t, origBody, req.Body, "RoundTrip shouldn't replace the original request body")
+
+	resp, err = transport.RoundTrip(&http.Request{
+		URL: &url.URL{
+			Scheme: "http",
+			Host:   "example.org",
+		},
+		Method: http.MethodPost,
+		Body:   io.NopCloser(strings.NewReader(body)),
+	})
+	require.NoError(t, err)
+	resp.Body.Close()
+	require.Equal(t, http.StatusNotFound, resp.StatusCode)
+}
+
+func TestTransport_RoundTrip_conditionReadsBody(t *testing.T) { //nolint:funlen
+	bodyIs := func(s string) flute.RequestMatcher {
+		return flute.MatchFunc(fmt.Sprintf("body is %q", s), func(req *http.Request) (bool, error) {
+			b, err := io.ReadAll(req.Body)
+			if err != nil {
+				return false, err
+			}
+			return string(b) == s, nil
+		})
+	}
+	tb := flute.NewFakeTB(t)
+	transport := flute.Transport{
+		T: tb,
+		Services: []flute.Service{
+			{
+				Endpoint: "http://example.com",
+				Routes: []flute.Route{
+					{
+						Name: "any of the functions reading the body",
+						Matcher: flute.Matcher{
+							Path:      "/any",
+							Condition: flute.AnyOf(bodyIs("a"), bodyIs("b")),
+						},
+						Response: flute.Response{
+							Base: http.Response{
+								StatusCode: http.StatusOK,
+							},
+						},
+					},
+					{
+						Name: "condition and match reading the body",
+						Matcher: flute.Matcher{
+							Path:      "/both",
+							Condition: bodyIs("b"),
+							Match: func(req *http.Request) (bool, error) {
+								b, err := io.ReadAll(req.Body)
+								if err != nil {
+									return false, err
+								}
+								return string(b) == "b", nil
+							},
+						},
+						Response: flute.Response{
+							Base: http.Response{
+								StatusCode: http.StatusCreated,
+							},
+						},
+					},
+				},
+			},
+		},
+	}
+	for path, statusCode := range map[string]int{
+		"/any":  http.StatusOK,
+		"/both": http.StatusCreated,
+	} {
+		req, err := http.NewRequest(http.MethodPost, "http://example.com"+path, strings.NewReader("b"))
+		require.NoError(t, err)
+		resp, err := transport.RoundTrip(req)
+		require.NoError(t, err)
+		resp.Body.Close()
+		require.Equal(t, statusCode, resp.StatusCode, path)
+	}
+	require.Empty(t, tb.Errors())
+}
+
+func TestTransport_RoundTrip_sequence(t *testing.T) { //nolint:funlen
+	tb := flute.NewFakeTB(t)
+	transport := flute.Transport{
+		T: tb,
+		Services: []flute.Service{
+			{
+				Endpoint: "http://example.com",
+				Routes: []flute.Route{
+					{
+						Name: "get a user",
+						Matcher: flute.Matcher{
+							Method: http.MethodGet,
+						},
+						Tester: flute.Tester{
+							Path: "/users/1",
+						},
+						Sequence: &flute.Sequence{
+							AfterLast: flute.FailAfterLast,
+							Steps: []flute.Step{
+								{
+									Response: flute.Response{
+										Base: http.Response{
+											StatusCode: http.StatusServiceUnavailable,
+										},
+									},
+								},
+								{
+									Tester: flute.Tester{
+										PartOfHeader: http.Header{
+											"X-Retry": nil,
+										},
+									},
+									Response: flute.Response{
+										Base: http.Response{
+											StatusCode: http.StatusOK,
+										},
+									},
+								},
+							},
+						},
+					},
+				},
+			},
+		},
+	}
+	for _, d := range []struct {
+		statusCode int
+		header     http.Header
+		isErr      bool
+	}{
+		{statusCode: http.StatusServiceUnavailable},
+		{statusCode: http.StatusOK, header: http.Header{"X-Retry": []string{"1"}}},
+		{isErr: true},
+	} {
+		resp, err := transport.RoundTrip(&http.Request{
+			URL: &url.URL{
+				Scheme: "http",
+				Host:   "example.com",
+				Path:   "/users/1",
+			},
+			Method: http.MethodGet,
+			Header: d.header,
+		})
+		if d.isErr {
+			require.Error(t, err)
+			continue
+		}
+		require.NoError(t, err)
+		resp.Body.Close()
+		require.Equal(t, d.statusCode, resp.StatusCode)
+	}
+	errs := tb.Errors()
+	require.Len(t, errs, 1)
+	require.Contains(t, errs[0], "the route is called more times than the number of the sequence steps (2)")
+}
+
+func TestTransport_RoundTrip_order(t *testing.T) { //nolint:funlen
+	tb := flute.NewFakeTB(t)
+	order := &flute.Order{
+		Name: "commit",
+		Routes: []flute.RouteRef{
+			{Name: "put"},
+			{Name: "commit"},
+		},
+	}
+	transport := flute.Transport{
+		T:      tb,
+		Orders: []*flute.Order{order},
+		Services: []flute.Service{
+			{
+				Endpoint: "http://example.com",
+				Routes: []flute.Route{
+					{
+						Name: "put",
+						Matcher: flute.Matcher{
+							Method: http.MethodPut,
+						},
+					},
+					{
+						Name: "commit",
+						Matcher: flute.Matcher{
+							Method: http.MethodPost,
+							Path:   "/commit",
+						},
+					},
+				},
+			},
+		},
+	}
+	for _, method := range []string{http.MethodPost, http.MethodPut, http.MethodPost} {
+		resp, err := transport.RoundTrip(&http.Request{
+			URL: &url.URL{
+				Scheme: "http",
+				Host:   "example.com",
+				Path:   "/commit",
+			},
+			Method: method,
+		})
+		require.NoError(t, err)
+		resp.Body.Close()
+	}
+	errs := tb.Errors()
+	require.Len(t, errs, 1)
+	require.Contains(t, errs[0], "expected order: put -> commit")
+	require.Contains(t, errs[0], "observed order: commit")
+
+	transport.Verify(tb)
+	require.Len(t, tb.Errors(), 1)
+	order.Reset()
+	transport.Verify(tb)
+	errs = tb.Errors()
+	require.Len(t, errs, 2)
+	require.Contains(t, errs[1], "the following routes aren't called: put, commit")
+}
+
+func TestNewTransport_concurrent(t *testing.T) { //nolint:funlen
+	const n = 50
+	journal := &flute.Journal{}
+	scenario := &flute.Scenario{Name: "user"}
+	seq := &flute.Sequence{
+		AfterLast: flute.Cycle,
+		Steps: []flute.Step{
+			{Response: flute.Response{Base: http.Response{StatusCode: http.StatusOK}}},
+			{Response: flute.Response{Base: http.Response{StatusCode: http.StatusAccepted}}},
+		},
+	}
+	transport := flute.NewTransport(t, flute.Service{
+		Endpoint: "http://example.com",
+		Routes: []flute.Route{
+			{
+				Name: "create a user",
+				Matcher: flute.Matcher{
+					Method: http.MethodPost,
+				},
+				Scenario:         scenario,
+				ScenarioState:    flute.ScenarioStarted,
+				NewScenarioState: "created",
+				Response: flute.Response{
+					Base: http.Response{StatusCode: http.StatusCreated},
+				},
+				Expect: flute.Once(),
+			},
+			{
+				Name: "the user already exists",
+				Matcher: flute.Matcher{
+					Method: http.MethodPost,
+				},
+				Response: flute.Response{
+					Base: http.Response{StatusCode: http.StatusConflict},
+				},
+				Expect: flute.Times(n - 1),
+			},
+			{
+				Name: "get a user",
+				Matcher: flute.Matcher{
+					Method: http.MethodGet,
+				},
+				Sequence: seq,
+				Expect:   flute.Times(n),
+			},
+		},
+	})
+	transport.Journal = journal
+	client := &http.Client{Transport: transport}
+
+	var wg sync.WaitGroup
+	statusCodes := make(chan int, 2*n)
+	for i := 0; i < n; i++ {
+		for _, method := range []string{http.MethodPost, http.MethodGet} {
+			wg.Add(1)
+			go func(method string) {
+				defer wg.Done()
+				req, err := http.NewRequestWithContext(
+					context.Background(), method, "http://example.com/users", strings.NewReader("foo"))
+				if !assert.NoError(t, err) {
+					return
+				}
+				resp, err := client.Do(req)
+				if !assert.NoError(t, err) {
+					return
+				}
+				resp.Body.Close()
+				statusCodes <- resp.StatusCode
+			}(method)
+		}
+	}
+	wg.Wait()
+	close(statusCodes)
+
+	counts := map[int]int{}
+	for code := range statusCodes {
+		counts[code]++
+	}
+	require.Equal(t, map[int]int{
+		http.StatusCreated:  1,
+		http.StatusConflict: n - 1,
+		http.StatusOK:       n / 2,
+		http.StatusAccepted: n / 2,
+	}, counts)
+	require.Equal(t, "created", scenario.State())
+	require.Equal(t, 2*n, journal.Len())
+	require.Len(t, journal.ByRoute("get a user"), n)
+}
+
+func TestNewTransport_parallel(t *testing.T) {
+	transport := flute.NewTransport(nil, flute.Service{
+		Endpoint: "http://example.com",
+		Routes: []flute.Route{
+			{
+				Name: "get a user",
+				Response: flute.Response{
+					BodyString: "foo",
+				},
+				Expect: flute.Times(3),
+			},
+		},
+	})
+	t.Cleanup(func() {
+		transport.Verify(t)
+	})
+	for i := 0; i < 3; i++ {
+		t.Run("parallel", func(t *testing.T) {
+			t.Parallel()
+			resp, err := transport.RoundTrip(&http.Request{
+				URL: &url.URL{
+					Scheme: "http",
+					Host:   "example.com",
+				},
+			})
+			require.NoError(t, err)
+			defer resp.Body.Close()
+			b, err := io.ReadAll(resp.Body)
+			require.NoError(t, err)
+			require.Equal(t, "foo", string(b))
+		})
+	}
+}
+
+func TestNewTransport_verifyAtCleanup(t *testing.T) {
+	var tb interface {
+		Errors() []string
+	}
+	t.Run("set the orders and services after NewTransport", func(t *testing.T) {
+		fake := flute.NewFakeTB(t)
+		tb = fake
+		transport := flute.NewTransport(fake, flute.Service{
+			Endpoint: "http://example.com",
+			Routes: []flute.Route{
+				{
+					Name:   "create a user",
+					Expect: flute.Once(),
+				},
+			},
+		})
+		transport.Orders = []*flute.Order{
+			{
+				Name: "login",
+				Routes: []flute.RouteRef{
+					{Name: "issue a token"},
+					{Name: "create a user"},
+				},
+			},
+		}
+		transport.Services = append(transport.Services, flute.Service{
+			Endpoint: "http://auth.example.com",
+			Routes: []flute.Route{
+				{
+					Name:   "issue a token",
+					Expect: flute.Once(),
+				},
+			},
+		})
+	})
+	errs := tb.Errors()
+	require.Len(t, errs, 3)
+	require.Contains(t, errs[0], "service: http://example.com")
+	require.Contains(t, errs[1], "service: http://auth.example.com")
+	require.Contains(t, errs[2], "the order isn't finished, the following routes aren't called: issue a token, create a user")
+}
+
+func TestTransport_RoundTrip_pathPattern(t *testing.T) {
+	transport := flute.Transport{
+		T: t,
+		Services: []flute.Service{
+			{
+				Endpoint: "http://example.com",
+				Routes: []flute.Route{
+					{
+						Name: "get a user",
+						Matcher: flute.Matcher{
+							Method: http.MethodGet,
+							Path:   "/users/{id}",
+						},
+						Tester: flute.Tester{
+							TestTB: func(tb testing.TB, req *http.Request, service flute.Service, route flute.Route) {
+								require.NotEmpty(tb, flute.PathValue(req, "id"))
+							},
+						},
+						Response: flute.Response{
+							Response: func(req *http.Request) (*http.Response, error) {
+								return &http.Response{
+									StatusCode: http.StatusOK,
+									Body:       io.NopCloser(strings.NewReader(`{"id": ` + flute.PathValue(req, "id") + `}`)),
+								}, nil
+							},
+						},
+					},
+				},
+			},
+		},
+	}
+	for _, id := range []string{"1", "2"} {
+		resp, err := transport.RoundTrip(&http.Request{
+			URL: &url.URL{
+				Scheme: "http",
+				Host:   "example.com",
+				Path:   "/users/" + id,
+			},
+			Method: http.MethodGet,
+		})
+		require.NoError(t, err)
+		b, err := io.ReadAll(resp.Body)
+		resp.Body.Close()
+		require.NoError(t, err)
+		require.Equal(t, `{"id": `+id+`}`, string(b))
+	}
+}
+
+func TestTransport_RoundTrip_basePath(t *testing.T) { //nolint:funlen
+	journal := &flute.Journal{}
+	transport := flute.Transport{
+		T:       t,
+		Journal: journal,
+		Services: []flute.Service{
+			{
+				Endpoint:  "https://example.com/api/v2",
+				Endpoints: []string{"http://localhost:8080/api/v2"},
+				Routes: []flute.Route{
+					{
+						Name: "get a user",
+						Matcher: flute.Matcher{
+							Method: http.MethodGet,
+							Path:   "/users/{id}",
+						},
+						Tester: flute.Tester{
+							Path: "/users/10",
+						},
+						Response: flute.Response{
+							Response: func(req *http.Request) (*http.Response, error) {
+								if !strings.HasPrefix(req.URL.Path, "/api/v2/") {
+									return nil, errors.New("the response should get the URL which the client sent: " + req.URL.String())
+								}
+								return &http.Response{
+									StatusCode: http.StatusOK,
+									Body:       io.NopCloser(strings.NewReader(`{"id": ` + flute.PathValue(req, "id") + `}`)),
+								}, nil
+							},
+						},
+					},
+					{
+						Name: "list users",
+						Matcher: flute.Matcher{
+							Method: http.MethodGet,
+							Path:   "/users",
+						},
+						Response: flute.Response{
+							Base: http.Response{
+								StatusCode: http.StatusOK,
+							},
+						},
+					},
+				},
+			},
+		},
+	}
+	for _, u := range []string{
+		"https://example.com:443/api/v2/users/10",
+		"http://localhost:8080/api/v2/users/10",
+	} {
+		req, err := http.NewRequest(http.MethodGet, u, nil)
+		require.NoError(t, err)
+		resp, err := transport.RoundTrip(req)
+		require.NoError(t, err)
+		b, err := io.ReadAll(resp.Body)
+		resp.Body.Close()
+		require.NoError(t, err)
+		require.Equal(t, `{"id": 10}`, string(b))
+		require.Equal(t, u, req.URL.String(), "the request shouldn't be changed")
+	}
+	entry, ok := journal.Last()
+	require.True(t, ok)
+	require.Equal(t, "/api/v2/users/10", entry.Request.URL.Path, "the journal records the original request")
+
+	resp, err := transport.RoundTrip(newRequest(t, http.MethodGet, "https://example.com/api/v2/users"))
+	require.NoError(t, err)
+	resp.Body.Close()
+	require.Equal(t, "https://example.com/api/v2/users", resp.Request.URL.String())
+}
+
+func TestTransport_RoundTrip_invalidEndpoint(t *testing.T) {
+	tb := flute.NewFakeTB(t)
+	transport := flute.Transport{
+		T: tb,
+		Services: []flute.Service{
+			{
+				Endpoint:  "example.com",
+				Endpoints: []string{"http://example.com"},
+				Routes: []flute.Route{
+					{
+						Name: "list users",
+						Matcher: flute.Matcher{
+							Path: "/users",
+						},
+						Response: flute.Response{
+							Base: http.Response{
+								StatusCode: http.StatusOK,
+							},
+						},
+					},
+				},
+			},
+		},
+	}
+	resp, err := transport.RoundTrip(newRequest(t, http.MethodGet, "http://example.com/users"))
+	require.NoError(t, err)
+	resp.Body.Close()
+	require.Equal(t, http.StatusOK, resp.StatusCode, "the endpoint after the invalid endpoint is checked")
+	errs := tb.Errors()
+	require.Len(t, errs, 1)
+	require.Contains(t, errs[0], `the service has an invalid endpoint: the endpoint "example.com" should be "scheme://host"`)
+}
+
+func TestTransport_RoundTrip_contentEncoding(t *testing.T) { //nolint:funlen
+	buf := &bytes.Buffer{}
+	w := gzip.NewWriter(buf)
+	_, err := w.Write([]byte(`{"name": "foo"}`))
+	require.NoError(t, err)
+	require.NoError(t, w.Close())
+	compressed := buf.Bytes()
+
+	tb := flute.NewFakeTB(t)
+	transport := flute.Transport{
+		T: tb,
+		Services: []flute.Service{
+			{
+				Endpoint: "http://example.com",
+				Routes: []flute.Route{
+					{
+						Name: "create a user",
+						Matcher: flute.Matcher{
+							BodyJSONString: `{"name": "foo"}`,
+						},
+						Tester: flute.Tester{
+							ContentEncoding: "gzip",
+							TestTB: func(t testing.TB, req *http.Request, service flute.Service, route flute.Route) {
+								assert.Equal(t, int64(len(`{"name": "foo"}`)), req.ContentLength, "ContentLength is the length of the decoded body")
+							},
+						},
+						Response: flute.Response{
+							Base: http.Response{
+								StatusCode: http.StatusCreated,
+							},
+						},
+					},
+				},
+			},
+		},
+		Transport: flute.NewMockRoundTripper(t, gomic.DoNothing).
+			SetFuncRoundTrip(func(req *http.Request) (*http.Response, error) {
+				b, err := io.ReadAll(req.Body)
+				require.NoError(t, err)
+				require.Equal(t, compressed, b, "the body isn't decoded for the fallback transport")
+				require.Equal(t, int64(len(compressed)), req.ContentLength)
+				return &http.Response{
+					StatusCode: http.StatusOK,
+					Body:       http.NoBody,
+				}, nil
+			}),
+	}
+	for _, d := range []struct {
+		url        string
+		encoding   string
+		statusCode int
+	}{
+		{url: "http://example.com/users", encoding: "gzip", statusCode: http.StatusCreated},
+		{url: "http://example.org/users", encoding: "gzip", statusCode: http.StatusOK},
+	} {
+		req, err := http.NewRequest(http.MethodPost, d.url, bytes.NewReader(compressed))
+		require.NoError(t, err)
+		req.Header.Set("Content-Encoding", d.encoding)
+		resp, err := transport.RoundTrip(req)
+		require.NoError(t, err)
+		resp.Body.Close()
+		require.Equal(t, d.statusCode, resp.StatusCode)
+	}
+	require.Empty(t, tb.Errors())
+
+	// the body isn't compressed although the header says gzip
+	req, err := http.NewRequest(http.MethodPost, "http://example.com/users", strings.NewReader(`{"name": "foo"}`))
+	require.NoError(t, err)
+	req.Header.Set("Content-Encoding", "gzip")
+	resp, err := transport.RoundTrip(req)
+	require.NoError(t, err)
+	resp.Body.Close()
+	errs := tb.Errors()
+	require.Len(t, errs, 1)
+	require.Contains(t, errs[0], `the request body should be encoded with "gzip"`)
+}
+
+func TestTransport_RoundTrip_contentEncodingNoMatchedRoute(t *testing.T) {
+	buf := &bytes.Buffer{}
+	w := gzip.NewWriter(buf)
+	_, err := w.Write([]byte(`{"name": "foo"}`))
+	require.NoError(t, err)
+	require.NoError(t, w.Close())
+
+	tb := flute.NewFakeTB(t)
+	transport := flute.Transport{
+		T: tb,
+		Services: []flute.Service{
+			{
+				Endpoint: "http://example.com",
+				Routes: []flute.Route{
+					{
+						Name: "create a user",
+						Matcher: flute.Matcher{
+							Method:         http.MethodPost,
+							BodyJSONString: `{"name": "foo"}`,
+						},
+					},
+				},
+			},
+		},
+	}
+	req, err := http.NewRequest(http.MethodPut, "http://example.com/users", bytes.NewReader(buf.Bytes()))
+	require.NoError(t, err)
+	req.Header.Set("Content-Encoding", "gzip")
+	resp, err := transport.RoundTrip(req)
+	require.NoError(t, err)
+	resp.Body.Close()
+	require.Equal(t, http.StatusNotFound, resp.StatusCode)
+	errs := tb.Errors()
+	require.Len(t, errs, 1)
+	require.Contains(t, errs[0], "(passed 2 of 3 conditions)")
+	require.Contains(t, errs[0], `expected: "POST"`)
+	require.NotContains(t, errs[0], "failed to check the condition")
+}
+
+func TestTransport_RoundTrip_graphQLBatch(t *testing.T) { //nolint:funlen
+	tb := flute.NewFakeTB(t)
+	journal := &flute.Journal{}
+	session := &flute.Session{}
+	getUser := flute.GraphQLResponse(map[string]interface{}{
+		"user": map[string]interface{}{"id": "1"},
+	})
+	getUser.Cookies = []*http.Cookie{{Name: "session_id", Value: "xxx"}}
+	transport := flute.Transport{
+		T:       tb,
+		Journal: journal,
+		Session: session,
+		Services: []flute.Service{
+			{
+				Endpoint: "http://example.com",
+				Routes: []flute.Route{
+					{
+						Name: "get a user",
+						Matcher: flute.Matcher{
+							Path: "/graphql",
+							GraphQL: &flute.GraphQL{
+								OperationName: "GetUser",
+							},
+						},
+						Tester: flute.Tester{
+							GraphQL: &flute.GraphQL{
+								Variables: map[string]interface{}{"id": "1"},
+							},
+						},
+						Response: getUser,
+					},
+					{
+						Name: "list users",
+						Matcher: flute.Matcher{
+							Path: "/graphql",
+							GraphQL: &flute.GraphQL{
+								OperationName: "ListUsers",
+							},
+						},
+						Response: flute.GraphQLResponse(nil, flute.GraphQLError{
+							Message: "forbidden",
+							Path:    []interface{}{"users"},
+						}),
+					},
+					{
+						Name: "create items",
+						Matcher: flute.Matcher{
+							Method:         http.MethodPost,
+							Path:           "/items",
+							BodyJSONString: `[{"name": "foo"}]`,
+						},
+						Response: flute.Response{
+							Base: http.Response{
+								StatusCode: http.StatusCreated,
+							},
+						},
+					},
+				},
+			},
+		},
+	}
+	req, err := http.NewRequest(http.MethodPost, "http://example.com/graphql", strings.NewReader(`[
+  {"query": "query GetUser($id: ID!) { user(id: $id) { id } }", "variables": {"id": "1"}},
+  {"query": "query ListUsers { users { id } }"},
+  {"query": "query Unknown { unknown }"}
+]`))
+	require.NoError(t, err)
+	resp, err := transport.RoundTrip(req)
+	require.NoError(t, err)
+	defer resp.Body.Close()
+	require.Equal(t, http.StatusOK, resp.StatusCode)
+	require.Equal(t, "application/json", resp.Header.Get("Content-Type"))
+	require.Equal(t, []string{"session_id=xxx"}, resp.Header.Values("Set-Cookie"))
+	b, err := io.ReadAll(resp.Body)
+	require.NoError(t, err)
+	require.JSONEq(t, `[
+  {"data": {"user": {"id": "1"}}},
+  {"data": null, "errors": [{"message": "forbidden", "path": ["users"]}]},
+  {"data": null, "errors": [{"message": "no route matches the GraphQL operation"}]}
+]`, string(b))
+	errs := tb.Errors()
+	require.Len(t, errs, 1)
+	require.Contains(t, errs[0], "no route matches the request")
+	require.Contains(t, errs[0], "query Unknown")
+	require.Len(t, session.Cookies(), 1)
+
+	entries := journal.Entries()
+	require.Len(t, entries, 1, "the batch request is recorded as a request")
+	require.False(t, entries[0].Matched)
+	require.Len(t, entries[0].Operations, 3)
+	require.Equal(t, "list users", entries[0].Operations[1].Route.Name)
+	require.False(t, entries[0].Operations[2].Matched)
+	require.Len(t, journal.ByRoute("list users"), 1)
+
+	// the JSON array body of the route without GraphQL isn't split
+	resp, err = transport.RoundTrip(newRequest(t, http.MethodPost, "http://example.com/items"))
+	require.NoError(t, err)
+	resp.Body.Close()
+	require.Equal(t, http.StatusNotFound, resp.StatusCode)
+	req, err = http.NewRequest(http.MethodPost, "http://example.com/items", strings.NewReader(`[{"name": "foo"}]`))
+	require.NoError(t, err)
+	resp, err = transport.RoundTrip(req)
+	require.NoError(t, err)
+	resp.Body.Close()
+	require.Equal(t, http.StatusCreated, resp.StatusCode)
+}
+
+func TestTransport_RoundTrip_graphQLBatchFallback(t *testing.T) {
+	body := `[{"query": "query Unknown { unknown }"}, {"query": "query Other { other }"}]`
+	calls := 0
+	transport := flute.Transport{
+		T: t,
+		Services: []flute.Service{
+			{
+				Endpoint: "http://example.com",
+				Routes: []flute.Route{
+					{
+						Name: "get a user",
+						Matcher: flute.Matcher{
+							Path: "/graphql",
+							GraphQL: &flute.GraphQL{
+								OperationName: "GetUser",
+							},
+						},
+					},
+				},
+			},
+		},
+		Transport: flute.NewMockRoundTripper(t, gomic.DoNothing).
+			SetFuncRoundTrip(func(req *http.Request) (*http.Response, error) {
+				calls++
+				b, err := io.ReadAll(req.Body)
+				require.NoError(t, err)
+				require.Equal(t, body, string(b), "the batch request is sent as it is")
+				return &http.Response{
+					StatusCode: http.StatusOK,
+					Body:       http.NoBody,
+				}, nil
+			}),
+	}
+	req, err := http.NewRequest(http.MethodPost, "http://example.com/graphql", strings.NewReader(body))
+	require.NoError(t, err)
+	resp, err := transport.RoundTrip(req)
+	require.NoError(t, err)
+	resp.Body.Close()
+	require.Equal(t, 1, calls)
+}
+
+func TestTransport_RoundTrip_graphQLBatchNoResponse(t *testing.T) {
+	transport := flute.Transport{
+		Services: []flute.Service{
+			{
+				Endpoint: "http://example.com",
+				Routes: []flute.Route{
+					{
+						Name: "get a user",
+						Matcher: flute.Matcher{
+							Path: "/graphql",
+							GraphQL: &flute.GraphQL{
+								OperationName: "GetUser",
+							},
+						},
+						Response: flute.Response{
+							Response: func(req *http.Request) (*http.Response, error) {
+								return nil, nil
+							},
+						},
+					},
+				},
+			},
+		},
+	}
+	req, err := http.NewRequest(http.MethodPost, "http://example.com/graphql", strings.NewReader(
+		`[{"query": "query GetUser { user { id } }"}]`))
+	require.NoError(t, err)
+	resp, err := transport.RoundTrip(req) //nolint:bodyclose
+	require.EqualError(t, err, "the operation 0 of the batch request returned no response")
+	require.Nil(t, resp)
+}
+
+func TestTransport_RoundTrip_jsonRPCBatch(t *testing.T) { //nolint:funlen
+	tb := flute.NewFakeTB(t)
+	transport := flute.Transport{
+		T: tb,
+		Services: []flute.Service{
+			{
+				Endpoint: "http://example.com",
+				Routes: []flute.Route{
+					{
+						Name: "get the balance",
+						Matcher: flute.Matcher{
+							JSONRPC: &flute.JSONRPC{
+								Method: "eth_getBalance",
+							},
+						},
+						Tester: flute.Tester{
+							JSONRPC: &flute.JSONRPC{
+								Params: []string{"0x1", "latest"},
+							},
+						},
+						Response: flute.JSONRPCResult("0x10"),
+					},
+					{
+						Name: "notify",
+						Matcher: flute.Matcher{
+							JSONRPC: &flute.JSONRPC{
+								Method: "notify",
+							},
+						},
+						Response: flute.JSONRPCResult(nil),
+					},
+					{
+						Name: "unknown method",
+						Matcher: flute.Matcher{
+							JSONRPC: &flute.JSONRPC{},
+						},
+						Response: flute.JSONRPCErrorResponse(flute.JSONRPCMethodNotFound()),
+					},
+				},
+			},
+		},
+	}
+	for _, d := range []struct {
+		title      string
+		body       string
+		statusCode int
+		exp        string
+	}{
+		{
+			title: "batch",
+			body: `[
+  {"jsonrpc": "2.0", "method": "foo", "id": "a"},
+  {"jsonrpc": "2.0", "method": "notify", "params": [1]},
+  {"jsonrpc": "2.0", "method": "eth_getBalance", "params": ["0x1", "latest"], "id": 2}
+]`,
+			statusCode: http.StatusOK,
+			exp: `[
+  {"jsonrpc": "2.0", "error": {"code": -32601, "message": "Method not found"}, "id": "a"},
+  {"jsonrpc": "2.0", "result": "0x10", "id": 2}
+]`,
+		},
+		{
+			title:      "single call",
+			body:       `{"jsonrpc": "2.0", "method": "eth_getBalance", "params": ["0x1", "latest"], "id": 1}`,
+			statusCode: http.StatusOK,
+			exp:        `{"jsonrpc": "2.0", "result": "0x10", "id": 1}`,
+		},
+		{
+			title:      "batch of notifications",
+			body:       `[{"jsonrpc": "2.0", "method": "notify"}, {"jsonrpc": "2.0", "method": "notify"}]`,
+			statusCode: http.StatusNoContent,
+		},
+	} {
+		d := d
+		t.Run(d.title, func(t *testing.T) {
+			req, err := http.NewRequest(http.MethodPost, "http://example.com", strings.NewReader(d.body))
+			require.NoError(t, err)
+			resp, err := transport.RoundTrip(req)
+			require.NoError(t, err)
+			defer resp.Body.Close()
+			require.Equal(t, d.statusCode, resp.StatusCode)
+			b, err := io.ReadAll(resp.Body)
+			require.NoError(t, err)
+			if d.exp == "" {
+				require.Empty(t, b)
+				return
+			}
+			require.JSONEq(t, d.exp, string(b))
+		})
+	}
+	require.Empty(t, tb.Errors())
+}
+
+func TestTransport_RoundTrip_jsonRPCBatchUnmatched(t *testing.T) { //nolint:funlen
+	tb := flute.NewFakeTB(t)
+	transport := flute.Transport{
+		T: tb,
+		Services: []flute.Service{
+			{
+				Endpoint: "http://example.com",
+				Routes: []flute.Route{
+					{
+						Name: "get the balance",
+						Matcher: flute.Matcher{
+							Path: "/rpc",
+							JSONRPC: &flute.JSONRPC{
+								Method: "eth_getBalance",
+							},
+						},
+						Response: flute.JSONRPCResult("0x10"),
+					},
+					{
+						Name: "create items",
+						Matcher: flute.Matcher{
+							Method: http.MethodPost,
+							Path:   "/items",
+						},
+						Response: flute.Response{
+							Base: http.Response{
+								StatusCode: http.StatusCreated,
+							},
+						},
+					},
+				},
+			},
+		},
+	}
+	req, err := http.NewRequest(http.MethodPost, "http://example.com/rpc", strings.NewReader(`[
+  {"jsonrpc": "2.0", "method": "eth_getBalance", "id": 1},
+  {"jsonrpc": "2.0", "method": "foo", "id": "a"},
+  {"jsonrpc": "2.0", "method": "notify"}
+]`))
+	require.NoError(t, err)
+	resp, err := transport.RoundTrip(req)
+	require.NoError(t, err)
+	defer resp.Body.Close()
+	require.Equal(t, http.StatusOK, resp.StatusCode)
+	b, err := io.ReadAll(resp.Body)
+	require.NoError(t, err)
+	require.JSONEq(t, `[
+  {"jsonrpc": "2.0", "result": "0x10", "id": 1},
+  {"jsonrpc": "2.0", "error": {"code": -32601, "message": "Method not found"}, "id": "a"}
+]`, string(b))
+	require.Len(t, tb.Errors(), 2)
+
+	// the JSON array body of the route without JSONRPC isn't split
+	req, err = http.NewRequest(http.MethodPost, "http://example.com/items", strings.NewReader(`[{"name": "foo"}]`))
+	require.NoError(t, err)
+	resp, err = transport.RoundTrip(req)
+	require.NoError(t, err)
+	resp.Body.Close()
+	require.Equal(t, http.StatusCreated, resp.StatusCode)
+	require.Len(t, tb.Errors(), 2)
+}
+
+func TestTransport_RoundTrip_jsonRPCBatchNoResponse(t *testing.T) {
+	tb := flute.NewFakeTB(t)
+	transport := flute.Transport{
+		T: tb,
+		Services: []flute.Service{
+			{
+				Endpoint: "http://example.com",
+				Routes: []flute.Route{
+					{
+						Name: "get the balance",
+						Matcher: flute.Matcher{
+							Path: "/rpc",
+							JSONRPC: &flute.JSONRPC{
+								Method: "eth_getBalance",
+							},
+						},
+						Response: flute.Response{
+							Response: func(req *http.Request) (*http.Response, error) {
+								return nil, nil
+							},
+						},
+					},
+				},
+			},
+		},
+	}
+	req, err := http.NewRequest(http.MethodPost, "http://example.com/rpc", strings.NewReader(`[
+  {"jsonrpc": "2.0", "method": "foo", "id": 1},
+  {"jsonrpc": "2.0", "method": "eth_getBalance", "params": ["0x1", "latest"], "id": 2}
+]`))
+	require.NoError(t, err)
+	resp, err := transport.RoundTrip(req) //nolint:bodyclose
+	require.EqualError(t, err, "the operation 1 of the batch request returned no response")
+	require.Nil(t, resp)
+	errs := tb.Errors()
+	require.Len(t, errs, 1, "the unmatched call is still reported")
+	require.Contains(t, errs[0], "no route matches the request")
+}
+
+func TestTransport_RoundTrip_jsonRPCUnmatched(t *testing.T) { //nolint:funlen
+	tb := flute.NewFakeTB(t)
+	transport := flute.Transport{
+		T: tb,
+		Services: []flute.Service{
+			{
+				Endpoint: "http://example.com",
+				Routes: []flute.Route{
+					{
+						Name: "get the balance",
+						Matcher: flute.Matcher{
+							Method: http.MethodPost,
+							Path:   "/rpc",
+							JSONRPC: &flute.JSONRPC{
+								Method: "eth_getBalance",
+							},
+						},
+						Response: flute.JSONRPCResult("0x10"),
+					},
+				},
+			},
+		},
+	}
+	data := []struct {
+		title      string
+		path       string
+		body       string
+		statusCode int
+		exp        string
+	}{
+		{
+			title:      "unknown method",
+			path:       "/rpc",
+			body:       `{"jsonrpc": "2.0", "method": "foo", "id": 7}`,
+			statusCode: http.StatusOK,
+			exp:        `{"jsonrpc": "2.0", "error": {"code": -32601, "message": "Method not found"}, "id": 7}`,
+		},
+		{
+			title:      "notification",
+			path:       "/rpc",
+			body:       `{"jsonrpc": "2.0", "method": "foo"}`,
+			statusCode: http.StatusNoContent,
+		},
+		{
+			title:      "not a JSON-RPC call",
+			path:       "/rpc",
+			body:       `{"name": "foo"}`,
+			statusCode: http.StatusNotFound,
+		},
+		{
+			title:      "path of no JSON-RPC route",
+			path:       "/items",
+			body:       `{"jsonrpc": "2.0", "method": "foo", "id": 7}`,
+			statusCode: http.StatusNotFound,
+		},
+	}
+	for i, d := range data {
+		req, err := http.NewRequest(http.MethodPost, "http://example.com"+d.path, strings.NewReader(d.body))
+		require.NoError(t, err, d.title)
+		resp, err := transport.RoundTrip(req)
+		require.NoError(t, err, d.title)
+		b, err := io.ReadAll(resp.Body)
+		resp.Body.Close()
+		require.NoError(t, err, d.title)
+		require.Equal(t, d.statusCode, resp.StatusCode, d.title)
+		if d.exp != "" {
+			require.JSONEq(t, d.exp, string(b), d.title)
+		}
+		errs := tb.Errors()
+		require.Len(t, errs, i+1, d.title)
+		require.Contains(t, errs[i], "no route matches the request", d.title)
+	}
+}
+
+func TestTransport_RoundTrip_hmacOfCompressedBody(t *testing.T) { //nolint:funlen
+	buf := &bytes.Buffer{}
+	w := gzip.NewWriter(buf)
+	_, err := w.Write([]byte(`{"action": "opened"}`))
+	require.NoError(t, err)
+	require.NoError(t, w.Close())
+	compressed := buf.Bytes()
+	mac := hmac.New(sha256.New, []byte("webhook-secret"))
+	mac.Write(compressed)
+
+	tb := flute.NewFakeTB(t)
+	transport := flute.Transport{
+		T: tb,
+		Services: []flute.Service{
+			{
+				Endpoint: "http://example.com",
+				Routes: []flute.Route{
+					{
+						Name: "receive the webhook",
+						Matcher: flute.Matcher{
+							BodyJSONString: `{"action": "opened"}`,
+							Auth: flute.HMACSignature(flute.HMAC{
+								Secret: "webhook-secret",
+								Header: "X-Hub-Signature-256",
+								Prefix: "sha256=",
+							}),
+						},
+						Response: flute.Response{
+							Base: http.Response{
+								StatusCode: http.StatusNoContent,
+							},
+						},
+					},
+					{
+						Name: "receive the webhook with the custom canonical string",
+						Matcher: flute.Matcher{
+							Path:           "/hooks/custom",
+							BodyJSONString: `{"action": "opened"}`,
+							Auth: flute.HMACSignature(flute.HMAC{
+								Secret: "webhook-secret",
+								Header: "X-Signature",
+								CanonicalString: func(req *http.Request) (string, error) {
+									b, err := io.ReadAll(req.Body)
+									if err != nil {
+										return "", err
+									}
+									return req.Method + "\n" + string(b), nil
+								},
+							}),
+						},
+						Response: flute.Response{
+							Base: http.Response{
+								StatusCode: http.StatusAccepted,
+							},
+						},
+					},
+				},
+			},
+		},
+	}
+	req, err := http.NewRequest(http.MethodPost, "http://example.com/hooks", bytes.NewReader(compressed))
+	require.NoError(t, err)
+	req.Header.Set("Content-Encoding", "gzip")
+	req.Header.Set("X-Hub-Signature-256", "sha256="+hex.EncodeToString(mac.Sum(nil)))
+	resp, err := transport.RoundTrip(req)
+	require.NoError(t, err)
+	resp.Body.Close()
+	require.Equal(t, http.StatusNoContent, resp.StatusCode, "the signature of the body as it was sent is verified")
+	require.Empty(t, tb.Errors())
+
+	// the custom canonical string gets the body as it was sent too
+	mac = hmac.New(sha256.New, []byte("webhook-secret"))
+	mac.Write([]byte(http.MethodPost + "\n" + string(compressed)))
+	req, err = http.NewRequest(http.MethodPost, "http://example.com/hooks/custom", bytes.NewReader(compressed))
+	require.NoError(t, err)
+	req.Header.Set("Content-Encoding", "gzip")
+	req.Header.Set("X-Signature", hex.EncodeToString(mac.Sum(nil)))
+	resp, err = transport.RoundTrip(req)
+	require.NoError(t, err)
+	resp.Body.Close()
+	require.Equal(t, http.StatusAccepted, resp.StatusCode)
+	require.Empty(t, tb.Errors())
+}
+
+func TestTransport_RoundTrip_hmacWithBasePath(t *testing.T) {
+	tb := flute.NewFakeTB(t)
+	transport := flute.Transport{
+		T: tb,
+		Services: []flute.Service{
+			{
+				Endpoint: "http://example.com/api/v2",
+				Routes: []flute.Route{
+					{
+						Name: "create a user",
+						Matcher: flute.Matcher{
+							Method: http.MethodPost,
+							Path:   "/users",
+							Auth: flute.HMACSignature(flute.HMAC{
+								Secret: "secret",
+								Header: "X-Signature",
+								CanonicalString: func(req *http.Request) (string, error) {
+									b, err := io.ReadAll(req.Body)
+									if err != nil {
+										return "", err
+									}
+									return req.Method + "\n" + req.URL.Path + "\n" + string(b), nil
+								},
+							}),
+						},
+						Response: flute.Response{
+							Base: http.Response{
+								StatusCode: http.StatusCreated,
+							},
+						},
+					},
+				},
+			},
+		},
+	}
+	body := `{"name": "foo"}`
+	mac := hmac.New(sha256.New, []byte("secret"))
+	mac.Write([]byte(http.MethodPost + "\n/api/v2/users\n" + body))
+	req, err := http.NewRequest(http.MethodPost, "http://example.com/api/v2/users", strings.NewReader(body))
+	require.NoError(t, err)
+	req.Header.Set("X-Signature", hex.EncodeToString(mac.Sum(nil)))
+	resp, err := transport.RoundTrip(req)
+	require.NoError(t, err)
+	resp.Body.Close()
+	require.Equal(t, http.StatusCreated, resp.StatusCode, "the canonical string is built from the path which the client sent")
+	require.Empty(t, tb.Errors())
+}
+
+func TestTransport_RoundTrip_session(t *testing.T) { //nolint:funlen
+	tb := flute.NewFakeTB(t)
+	transport := &flute.Transport{
+		T:       tb,
+		Session: &flute.Session{},
+		Services: []flute.Service{
+			{
+				Endpoint: "http://example.com",
+				Routes: []flute.Route{
+					{
+						Name: "login",
+						Matcher: flute.Matcher{
+							Method: http.MethodPost,
+							Path:   "/login",
+						},
+						Tester: flute.Tester{
+							AbsentCookies: []string{"session"},
+						},
+						Response: flute.Response{
+							Base: http.Response{
+								StatusCode: http.StatusNoContent,
+							},
+							Cookies: []*http.Cookie{
+								{Name: "session", Value: "abc", Path: "/", HttpOnly: true},
+							},
+						},
+					},
+					{
+						Name: "logout",
+						Matcher: flute.Matcher{
+							Method: http.MethodPost,
+							Path:   "/logout",
+						},
+						Response: flute.Response{
+							Base: http.Response{
+								StatusCode: http.StatusNoContent,
+							},
+							Cookies: []*http.Cookie{
+								{Name: "session", Path: "/", MaxAge: -1},
+							},
+						},
+					},
+					{
+						Name: "get the profile",
+						Matcher: flute.Matcher{
+							Method: http.MethodGet,
+							Path:   "/me",
+							Cookie: map[string]flute.ValueMatcher{
+								"session": flute.Equal("abc"),
+							},
+						},
+						Response: flute.Response{
+							Base: http.Response{
+								StatusCode: http.StatusOK,
+							},
+						},
+					},
+					{
+						Name: "unauthorized",
+						Matcher: flute.Matcher{
+							Method: http.MethodGet,
+							Path:   "/me",
+						},
+						Response: flute.Response{
+							Base: http.Response{
+								StatusCode: http.StatusUnauthorized,
+							},
+						},
+					},
+				},
+			},
+		},
+	}
+	jar, err := cookiejar.New(nil)
+	require.NoError(t, err)
+	client := &http.Client{
+		Transport: transport,
+		Jar:       jar,
+	}
+	for _, d := range []struct {
+		method     string
+		path       string
+		statusCode int
+	}{
+		{method: http.MethodGet, path: "/me", statusCode: http.StatusUnauthorized},
+		{method: http.MethodPost, path: "/login", statusCode: http.StatusNoContent},
+		{method: http.MethodGet, path: "/me", statusCode: http.StatusOK},
+		{method: http.MethodPost, path: "/logout", statusCode: http.StatusNoContent},
+		{method: http.MethodGet, path: "/me", statusCode: http.StatusUnauthorized},
+	} {
+		req, err := http.NewRequest(d.method, "http://example.com"+d.path, nil)
+		require.NoError(t, err)
+		resp, err := client.Do(req)
+		require.NoError(t, err)
+		resp.Body.Close()
+		require.Equal(t, d.statusCode, resp.StatusCode, d.method+" "+d.path)
+	}
+	require.Empty(t, tb.Errors())
+	require.Empty(t, transport.Session.Cookies())
+
+	// the client which doesn't keep the cookies fails the test
+	resp, err := transport.RoundTrip(newRequest(t, http.MethodPost, "http://example.com/login"))
+	require.NoError(t, err)
+	resp.Body.Close()
+	resp, err = transport.RoundTrip(newRequest(t, http.MethodPost, "http://example.com/logout"))
+	require.NoError(t, err)
+	resp.Body.Close()
+	errs := tb.Errors()
+	require.Len(t, errs, 1)
+	require.Contains(t, errs[0], `the request cookie "session" set by the route "login" is required`)
+}
+
+func newRequest(t *testing.T, method, u string) *http.Request {
+	t.Helper()
+	req, err := http.NewRequest(method, u, nil)
+	require.NoError(t, err)
+	return req
+}
@@ -0,0 +1,188 @@
+package flute
+
+import (
+	"fmt"
+	"net/http"
+	"regexp"
+	"sort"
+	"strings"
+)
+
+type (
+	// ValueMatcher is a condition of a value such as a path, a header value, and a query parameter.
+	ValueMatcher interface {
+		// MatchValue returns whether the value meets the condition.
+		MatchValue(v string) bool
+		// String returns the description of the condition such as `match regexp "^foo"`.
+		// The description is embedded in the failure message.
+		String() string
+	}
+
+	valueMatcher struct {
+		match       func(string) bool
+		description string
+	}
+)
+
+func (vm valueMatcher) MatchValue(v string) bool {
+	return vm.match(v)
+}
+
+func (vm valueMatcher) String() string {
+	return vm.description
+}
+
+// Equal returns the ValueMatcher which matches the value equal to s.
+func Equal(s string) ValueMatcher {
+	return valueMatcher{
+		match: func(v string) bool {
+			return v == s
+		},
+		description: fmt.Sprintf("equal %q", s),
+	}
+}
+
+// Regexp returns the ValueMatcher which matches the value matching the regular expression.
+// Regexp panics if the expression can't be parsed, like regexp.MustCompile.
+func Regexp(expr string) ValueMatcher {
+	re := regexp.MustCompile(expr)
+	return valueMatcher{
+		match:       re.MatchString,
+		description: fmt.Sprintf("match regexp %q", expr),
+	}
+}
+
+// Prefix returns the ValueMatcher which matches the value starting with prefix.
+func Prefix(prefix string) ValueMatcher {
+	return valueMatcher{
+		match: func(v string) bool {
+			return strings.HasPrefix(v, prefix)
+		},
+		description: fmt.Sprintf("have prefix %q", prefix),
+	}
+}
+
+// Glob returns the ValueMatcher which matches the value matching the glob pattern.
+// "*" matches any sequence of characters including "/", and "?" matches any single character.
+func Glob(pattern string) ValueMatcher {
+	var b strings.Builder
+	b.WriteString("^")
+	for _, c := range pattern {
+		switch c {
+		case '*':
+			b.WriteString(".*")
+		case '?':
+			b.WriteString(".")
+		default:
+			b.WriteString(regexp.QuoteMeta(string(c)))
+		}
+	}
+	b.WriteString("$")
+	re := regexp.MustCompile(b.String())
+	return valueMatcher{
+		match:       re.MatchString,
+		description: fmt.Sprintf("match glob %q", pattern),
+	}
+}
+
+// NonEmpty returns the ValueMatcher which matches any non-empty value.
+func NonEmpty() ValueMatcher {
+	return valueMatcher{
+		match: func(v string) bool {
+			return v != ""
+		},
+		description: "be non-empty",
+	}
+}
+
+// Predicate returns the ValueMatcher which matches the value if f returns true.
+// description is embedded in the failure message, so it should describe the condition such as "be a RFC3339 timestamp".
+func Predicate(description string, f func(v string) bool) ValueMatcher {
+	return valueMatcher{
+		match:       f,
+		description: description,
+	}
+}
+
+// matchValues returns whether all values match the ValueMatcher.
+// If vm is nil, matchValues only checks the values exist.
+func matchValues(vm ValueMatcher, values []string, ok bool) bool {
+	if !ok {
+		return false
+	}
+	if vm == nil {
+		return true
+	}
+	if len(values) == 0 {
+		return false
+	}
+	for _, v := range values {
+		if !vm.MatchValue(v) {
+			return false
+		}
+	}
+	return true
+}
+
+// valueMismatch is a key whose values don't match the ValueMatcher.
+type valueMismatch struct {
+	key    string
+	vm     ValueMatcher
+	values []string
+	found  bool
+}
+
+// expected returns the description of the expected value.
+func (m valueMismatch) expected() string {
+	if m.vm == nil {
+		return "present"
+	}
+	return m.vm.String()
+}
+
+// actual returns the description of the actual value.
+func (m valueMismatch) actual() string {
+	if !m.found {
+		return "missing"
+	}
+	return fmt.Sprintf("%q", m.values)
+}
+
+// findValueMismatches returns the keys whose values don't match the ValueMatchers in the order of the keys.
+// get returns the values of the key and whether the key exists.
+func findValueMismatches(matchers map[string]ValueMatcher, get func(key string) ([]string, bool)) []valueMismatch {
+	keys := make([]string, 0, len(matchers))
+	for k := range matchers {
+		keys = append(keys, k)
+	}
+	sort.Strings(keys)
+	var mismatches []valueMismatch
+	for _, k := range keys {
+		values, ok := get(k)
+		if matchValues(matchers[k], values, ok) {
+			continue
+		}
+		mismatches = append(mismatches, valueMismatch{
+			key:    k,
+			vm:     matchers[k],
+			values: values,
+			found:  ok,
+		})
+	}
+	return mismatches
+}
+
+func headerValues(req *http.Request) func(string) ([]string, bool) {
+	return func(key string) ([]string, bool) {
+		values, ok := req.Header[http.CanonicalHeaderKey(key)]
+		return values, ok
+	}
+}
+
+func queryValues(req *http.Request) func(string) ([]string, bool) {
+	query := req.URL.Query()
+	return func(key string) ([]string, bool) {
+		values, ok := query[key]
+		return values, ok
+	}
+}
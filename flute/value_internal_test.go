@@ -0,0 +1,192 @@
+package flute
+
+import (
+	"net/http"
+	"net/url"
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/require"
+)
+
+func TestValueMatcher(t *testing.T) { //nolint:funlen
+	data := []struct {
+		title       string
+		vm          ValueMatcher
+		value       string
+		exp         bool
+		description string
+	}{
+		{
+			title:       "equal",
+			vm:          Equal("foo"),
+			value:       "foo",
+			exp:         true,
+			description: `equal "foo"`,
+		},
+		{
+			title:       "regexp",
+			vm:          Regexp(`^our-sdk/\d+`),
+			value:       "our-sdk/12 (linux)",
+			exp:         true,
+			description: `match regexp "^our-sdk/\\d+"`,
+		},
+		{
+			title: "regexp doesn't match",
+			vm:    Regexp(`^our-sdk/\d+`),
+			value: "curl/8.0",
+		},
+		{
+			title:       "prefix",
+			vm:          Prefix("Bearer "),
+			value:       "Bearer XXXXX",
+			exp:         true,
+			description: `have prefix "Bearer "`,
+		},
+		{
+			title: "prefix doesn't match",
+			vm:    Prefix("Bearer "),
+			value: "token XXXXX",
+		},
+		{
+			title:       "glob",
+			vm:          Glob("*/v?/users"),
+			value:       "/api/v2/users",
+			exp:         true,
+			description: `match glob "*/v?/users"`,
+		},
+		{
+			title: "glob doesn't match",
+			vm:    Glob("*/v?/users"),
+			value: "/api/v10/users",
+		},
+		{
+			title: "glob escapes regexp meta characters",
+			vm:    Glob("a.b"),
+			value: "axb",
+		},
+		{
+			title:       "non empty",
+			vm:          NonEmpty(),
+			value:       "1700000000",
+			exp:         true,
+			description: "be non-empty",
+		},
+		{
+			title: "empty",
+			vm:    NonEmpty(),
+		},
+		{
+			title: "predicate",
+			vm: Predicate("be a lower case string", func(v string) bool {
+				return strings.ToLower(v) == v
+			}),
+			value:       "foo",
+			exp:         true,
+			description: "be a lower case string",
+		},
+	}
+
+	for _, d := range data {
+		d := d
+		t.Run(d.title, func(t *testing.T) {
+			require.Equal(t, d.exp, d.vm.MatchValue(d.value))
+			if d.description != "" {
+				require.Equal(t, d.description, d.vm.String())
+			}
+		})
+	}
+}
+
+func Test_matchHeaderMatcher(t *testing.T) {
+	data := []struct {
+		title   string
+		header  http.Header
+		matcher Matcher
+		exp     bool
+	}{
+		{
+			title: "all values match",
+			header: http.Header{
+				"User-Agent":    []string{"our-sdk/1"},
+				"Authorization": []string{"Bearer XXXXX"},
+			},
+			matcher: Matcher{
+				HeaderMatcher: map[string]ValueMatcher{
+					"user-agent":    Regexp(`^our-sdk/\d+`),
+					"Authorization": nil,
+				},
+			},
+			exp: true,
+		},
+		{
+			title: "the key is missing",
+			header: http.Header{
+				"User-Agent": []string{"our-sdk/1"},
+			},
+			matcher: Matcher{
+				HeaderMatcher: map[string]ValueMatcher{
+					"Authorization": nil,
+				},
+			},
+		},
+		{
+			title: "one of the values doesn't match",
+			header: http.Header{
+				"Authorization": []string{"Bearer XXXXX", "token XXXXX"},
+			},
+			matcher: Matcher{
+				HeaderMatcher: map[string]ValueMatcher{
+					"Authorization": Prefix("Bearer "),
+				},
+			},
+		},
+	}
+
+	for _, d := range data {
+		d := d
+		t.Run(d.title, func(t *testing.T) {
+			b, err := matchHeaderMatcher(&http.Request{Header: d.header}, d.matcher)
+			require.NoError(t, err)
+			require.Equal(t, d.exp, b)
+		})
+	}
+}
+
+func Test_testValueMatchers(t *testing.T) {
+	tb := newFakeTB(t)
+	req := &http.Request{
+		URL: &url.URL{
+			Path:     "/users",
+			RawQuery: "ts=",
+		},
+		Header: http.Header{
+			"Authorization": []string{"token XXXXX"},
+		},
+	}
+	route := Route{
+		Name: "list users",
+		Tester: Tester{
+			PathMatcher: Prefix("/api/"),
+			HeaderMatcher: map[string]ValueMatcher{
+				"Authorization": Prefix("Bearer "),
+				"User-Agent":    nil,
+			},
+			QueryMatcher: map[string]ValueMatcher{
+				"ts": NonEmpty(),
+			},
+		},
+	}
+	testRequest(tb, req, Service{Endpoint: "http://example.com"}, route)
+	errs := tb.Errors()
+	exps := []string{
+		`request path should have prefix "/api/"`,
+		`the request header "Authorization" should have prefix "Bearer "`,
+		`the following request header is required: User-Agent`,
+		`the request query "ts" should be non-empty`,
+	}
+	require.Len(t, errs, len(exps))
+	for i, exp := range exps {
+		require.Contains(t, errs[i], exp)
+	}
+}
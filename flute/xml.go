@@ -0,0 +1,279 @@
+package flute
+
+import (
+	"bytes"
+	"encoding/xml"
+	"errors"
+	"fmt"
+	"io"
+	"mime"
+	"net/http"
+	"sort"
+	"strings"
+)
+
+type (
+	// xmlNode is the element or the text of the canonical XML.
+	// Namespace prefixes, the attribute order, comments, and whitespace between elements are ignored.
+	// The attribute values which are QNames such as xsi:type="ns1:Foo" are resolved to "{namespace}local",
+	// so the prefixes bound to the same namespace are equal.
+	xmlNode struct {
+		name  xml.Name
+		attrs []xml.Attr
+		// children are the child elements and texts in the document order.
+		children []*xmlNode
+		// isText is true if the node is the text between the elements.
+		isText bool
+		// text is the character data of the text node without leading and trailing whitespace.
+		text string
+	}
+)
+
+// resolveQName resolves the prefix of the attribute value such as "ns1:Foo" to "{namespace}Foo".
+// If the value isn't a QName with the prefix bound in spaces, resolveQName returns the value as it is.
+func resolveQName(value string, spaces map[string]string) string {
+	prefix, local, ok := strings.Cut(value, ":")
+	if !ok || prefix == "" || local == "" || strings.ContainsAny(local, ":/") {
+		return value
+	}
+	space, ok := spaces[prefix]
+	if !ok {
+		return value
+	}
+	return "{" + space + "}" + local
+}
+
+// namespaceBindings returns the prefixes in the scope of the element.
+// parent is the prefixes in the scope of the parent element and isn't changed.
+func namespaceBindings(parent map[string]string, attrs []xml.Attr) map[string]string {
+	spaces := parent
+	copied := false
+	for _, attr := range attrs {
+		if attr.Name.Space != "xmlns" {
+			continue
+		}
+		if !copied {
+			spaces = make(map[string]string, len(parent)+1)
+			for k, v := range parent {
+				spaces[k] = v
+			}
+			copied = true
+		}
+		spaces[attr.Name.Local] = attr.Value
+	}
+	return spaces
+}
+
+// parseXML parses the XML document and returns the root element.
+func parseXML(b []byte) (*xmlNode, error) {
+	decoder := xml.NewDecoder(bytes.NewReader(b))
+	var root *xmlNode
+	var stack []*xmlNode
+	// scopes are the prefixes in the scope of the elements in stack
+	scopes := []map[string]string{{"xml": "http://www.w3.org/XML/1998/namespace"}}
+	// text is the character data after the last start or end tag
+	text := ""
+	flushText := func() {
+		if s := strings.TrimSpace(text); s != "" && len(stack) != 0 {
+			parent := stack[len(stack)-1]
+			parent.children = append(parent.children, &xmlNode{isText: true, text: s})
+		}
+		text = ""
+	}
+	for {
+		token, err := decoder.Token()
+		if errors.Is(err, io.EOF) {
+			break
+		}
+		if err != nil {
+			return nil, fmt.Errorf("failed to parse XML: %w", err)
+		}
+		switch t := token.(type) {
+		case xml.StartElement:
+			flushText()
+			node := &xmlNode{name: t.Name}
+			spaces := namespaceBindings(scopes[len(scopes)-1], t.Attr)
+			for _, attr := range t.Attr {
+				if attr.Name.Space == "xmlns" || (attr.Name.Space == "" && attr.Name.Local == "xmlns") {
+					// namespace declarations are resolved by the decoder
+					continue
+				}
+				attr.Value = resolveQName(attr.Value, spaces)
+				node.attrs = append(node.attrs, attr)
+			}
+			sort.Slice(node.attrs, func(i, j int) bool {
+				a, b := node.attrs[i].Name, node.attrs[j].Name
+				if a.Space != b.Space {
+					return a.Space < b.Space
+				}
+				return a.Local < b.Local
+			})
+			if len(stack) == 0 {
+				if root != nil {
+					return nil, errors.New("failed to parse XML: multiple root elements")
+				}
+				root = node
+			} else {
+				parent := stack[len(stack)-1]
+				parent.children = append(parent.children, node)
+			}
+			stack = append(stack, node)
+			scopes = append(scopes, spaces)
+		case xml.EndElement:
+			flushText()
+			stack = stack[:len(stack)-1]
+			scopes = scopes[:len(scopes)-1]
+		case xml.CharData:
+			text += string(t)
+		}
+	}
+	if root == nil {
+		return nil, errors.New("failed to parse XML: no root element")
+	}
+	return root, nil
+}
+
+// write writes the canonical form of the element or the text.
+// The namespace is written as the default namespace only when it differs from the parent's one.
+func (node *xmlNode) write(b *strings.Builder, parentSpace string, depth int) {
+	indent := strings.Repeat("  ", depth)
+	if node.isText {
+		b.WriteString(indent)
+		xml.EscapeText(b, []byte(node.text)) //nolint:errcheck
+		b.WriteString("\n")
+		return
+	}
+	b.WriteString(indent + "<" + node.name.Local)
+	if node.name.Space != parentSpace {
+		fmt.Fprintf(b, " xmlns=%q", node.name.Space)
+	}
+	for _, attr := range node.attrs {
+		if attr.Name.Space != "" {
+			fmt.Fprintf(b, " {%s}%s=%q", attr.Name.Space, attr.Name.Local, attr.Value)
+			continue
+		}
+		fmt.Fprintf(b, " %s=%q", attr.Name.Local, attr.Value)
+	}
+	if len(node.children) == 0 {
+		b.WriteString("/>\n")
+		return
+	}
+	b.WriteString(">")
+	if len(node.children) == 1 && node.children[0].isText {
+		xml.EscapeText(b, []byte(node.children[0].text)) //nolint:errcheck
+		b.WriteString("</" + node.name.Local + ">\n")
+		return
+	}
+	b.WriteString("\n")
+	for _, child := range node.children {
+		child.write(b, node.name.Space, depth+1)
+	}
+	b.WriteString(indent + "</" + node.name.Local + ">\n")
+}
+
+// canonicalXML returns the canonical form of the XML document.
+// Two documents are semantically equal if their canonical forms are equal.
+func canonicalXML(b []byte) (string, error) {
+	root, err := parseXML(b)
+	if err != nil {
+		return "", err
+	}
+	s := &strings.Builder{}
+	root.write(s, "", 0)
+	return s.String(), nil
+}
+
+// prettyXML formats the XML string in the canonical form.
+// If s isn't a valid XML, prettyXML returns s as it is.
+func prettyXML(s string) string {
+	c, err := canonicalXML([]byte(s))
+	if err != nil {
+		return s
+	}
+	return c
+}
+
+// bodyXML returns the expected XML of BodyXML and BodyXMLString.
+// If the condition isn't set, bodyXML returns nil.
+// If both are set, bodyXML returns an error.
+func bodyXML(body interface{}, bodyString string) ([]byte, error) {
+	if body != nil && bodyString != "" {
+		return nil, errors.New("BodyXML and BodyXMLString can't be set at the same time")
+	}
+	if bodyString != "" {
+		return []byte(bodyString), nil
+	}
+	if body == nil {
+		return nil, nil
+	}
+	b, err := xml.Marshal(body)
+	if err != nil {
+		return nil, fmt.Errorf("failed to marshal BodyXML as XML: %w", err)
+	}
+	return b, nil
+}
+
+// equalXML returns whether the XML documents are semantically equal.
+// If the expected XML is invalid, equalXML returns an error.
+func equalXML(expected, actual []byte) (bool, error) {
+	exp, err := canonicalXML(expected)
+	if err != nil {
+		return false, fmt.Errorf("the expected body is invalid: %w", err)
+	}
+	act, err := canonicalXML(actual)
+	if err != nil {
+		return false, nil //nolint:nilerr
+	}
+	return exp == act, nil
+}
+
+// soapAction returns the SOAP action of the request.
+// SOAP 1.1 uses the SOAPAction header, and SOAP 1.2 uses the action parameter of Content-Type.
+func soapAction(req *http.Request) string {
+	if v := req.Header.Get("SOAPAction"); v != "" {
+		return strings.Trim(v, `"`)
+	}
+	if _, params, err := mime.ParseMediaType(req.Header.Get("Content-Type")); err == nil {
+		return params["action"]
+	}
+	return ""
+}
+
+// soapOperation returns the first element of the SOAP body such as "{http://example.com/stock}GetPrice".
+func soapOperation(body []byte) (xml.Name, error) {
+	root, err := parseXML(body)
+	if err != nil {
+		return xml.Name{}, err
+	}
+	if root.name.Local != "Envelope" {
+		return xml.Name{}, fmt.Errorf("the root element should be Envelope but %s", root.name.Local)
+	}
+	for _, child := range root.children {
+		if child.isText || child.name.Local != "Body" || child.name.Space != root.name.Space {
+			continue
+		}
+		for _, op := range child.children {
+			if !op.isText {
+				return op.name, nil
+			}
+		}
+		return xml.Name{}, errors.New("the SOAP body is empty")
+	}
+	return xml.Name{}, errors.New("the SOAP envelope doesn't have the body")
+}
+
+// matchSOAPOperationName returns whether the operation element has the name.
+// name is either the local name such as "GetPrice" or "{namespace}local" such as "{http://example.com/stock}GetPrice".
+func matchSOAPOperationName(name string, op xml.Name) bool {
+	if strings.HasPrefix(name, "{") {
+		return name == "{"+op.Space+"}"+op.Local
+	}
+	return name == op.Local
+}
+
+func formatXMLName(name xml.Name) string {
+	if name.Space == "" {
+		return name.Local
+	}
+	return "{" + name.Space + "}" + name.Local
+}
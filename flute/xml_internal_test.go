@@ -0,0 +1,239 @@
+package flute
+
+import (
+	"encoding/xml"
+	"io"
+	"net/http"
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/require"
+)
+
+func Test_equalXML(t *testing.T) { //nolint:funlen
+	data := []struct {
+		title    string
+		expected string
+		actual   string
+		isErr    bool
+		exp      bool
+	}{
+		{
+			title:    "whitespace, attribute order, and comments are ignored",
+			expected: `<user id="1" role="admin"><name>foo</name></user>`,
+			actual: `<?xml version="1.0"?>
+<!-- created by the client -->
+<user role="admin" id="1">
+  <name> foo </name>
+</user>`,
+			exp: true,
+		},
+		{
+			title:    "namespace prefixes are ignored",
+			expected: `<s:Envelope xmlns:s="http://schemas.xmlsoap.org/soap/envelope/"><s:Body/></s:Envelope>`,
+			actual:   `<soapenv:Envelope xmlns:soapenv="http://schemas.xmlsoap.org/soap/envelope/"><soapenv:Body></soapenv:Body></soapenv:Envelope>`,
+			exp:      true,
+		},
+		{
+			title:    "default namespace and prefix",
+			expected: `<Envelope xmlns="http://schemas.xmlsoap.org/soap/envelope/"><Body/></Envelope>`,
+			actual:   `<s:Envelope xmlns:s="http://schemas.xmlsoap.org/soap/envelope/"><s:Body/></s:Envelope>`,
+			exp:      true,
+		},
+		{
+			title:    "namespace is different",
+			expected: `<Envelope xmlns="http://www.w3.org/2003/05/soap-envelope"><Body/></Envelope>`,
+			actual:   `<s:Envelope xmlns:s="http://schemas.xmlsoap.org/soap/envelope/"><s:Body/></s:Envelope>`,
+		},
+		{
+			title:    "prefixes of QName attribute values are ignored",
+			expected: `<item xmlns:xsi="http://www.w3.org/2001/XMLSchema-instance" xmlns:ns1="http://example.com/types" xsi:type="ns1:Foo"/>`,
+			actual:   `<item xmlns:i="http://www.w3.org/2001/XMLSchema-instance" xmlns:t="http://example.com/types" i:type="t:Foo"/>`,
+			exp:      true,
+		},
+		{
+			title:    "namespaces of QName attribute values are different",
+			expected: `<item xmlns:xsi="http://www.w3.org/2001/XMLSchema-instance" xmlns:ns1="http://example.com/types" xsi:type="ns1:Foo"/>`,
+			actual:   `<item xmlns:xsi="http://www.w3.org/2001/XMLSchema-instance" xmlns:ns1="http://example.com/other" xsi:type="ns1:Foo"/>`,
+		},
+		{
+			title:    "mixed content keeps the order of texts and elements",
+			expected: `<a>x<b/>y</a>`,
+			actual:   `<a>x<!-- comment --><b/> y </a>`,
+			exp:      true,
+		},
+		{
+			title:    "texts aren't joined across elements",
+			expected: `<a>x<b/>y</a>`,
+			actual:   `<a>xy<b/></a>`,
+		},
+		{
+			title:    "text is different",
+			expected: `<user><name>foo</name></user>`,
+			actual:   `<user><name>bar</name></user>`,
+		},
+		{
+			title:    "element order matters",
+			expected: `<user><name>foo</name><age>10</age></user>`,
+			actual:   `<user><age>10</age><name>foo</name></user>`,
+		},
+		{
+			title:    "actual is invalid",
+			expected: `<user/>`,
+			actual:   `<user>`,
+		},
+		{
+			title:    "expected is invalid",
+			expected: `<user>`,
+			actual:   `<user/>`,
+			isErr:    true,
+		},
+	}
+
+	for _, d := range data {
+		d := d
+		t.Run(d.title, func(t *testing.T) {
+			b, err := equalXML([]byte(d.expected), []byte(d.actual))
+			if d.isErr {
+				require.Error(t, err)
+				return
+			}
+			require.NoError(t, err)
+			require.Equal(t, d.exp, b)
+		})
+	}
+}
+
+func Test_isMatchSOAP(t *testing.T) { //nolint:funlen
+	body := `<soap:Envelope xmlns:soap="http://schemas.xmlsoap.org/soap/envelope/">
+  <soap:Header/>
+  <soap:Body>
+    <m:GetPrice xmlns:m="https://example.com/stock">
+      <m:Item>Apples</m:Item>
+    </m:GetPrice>
+  </soap:Body>
+</soap:Envelope>`
+	type item struct {
+		XMLName xml.Name `xml:"https://example.com/stock Item"`
+		Value   string   `xml:",chardata"`
+	}
+	data := []struct {
+		title   string
+		header  http.Header
+		matcher Matcher
+		exp     bool
+	}{
+		{
+			title: "SOAP 1.1 action and operation",
+			header: http.Header{
+				"Soapaction": []string{`"https://example.com/stock/GetPrice"`},
+			},
+			matcher: Matcher{
+				SOAPAction:    "https://example.com/stock/GetPrice",
+				SOAPOperation: "GetPrice",
+			},
+			exp: true,
+		},
+		{
+			title: "SOAP 1.2 action",
+			header: http.Header{
+				"Content-Type": []string{`application/soap+xml; charset=utf-8; action="https://example.com/stock/GetPrice"`},
+			},
+			matcher: Matcher{
+				SOAPAction:    "https://example.com/stock/GetPrice",
+				SOAPOperation: "{https://example.com/stock}GetPrice",
+			},
+			exp: true,
+		},
+		{
+			title: "operation doesn't match",
+			matcher: Matcher{
+				SOAPOperation: "GetStock",
+			},
+		},
+		{
+			title: "operation namespace doesn't match",
+			matcher: Matcher{
+				SOAPOperation: "{https://example.com/order}GetPrice",
+			},
+		},
+		{
+			title: "action doesn't match",
+			header: http.Header{
+				"Soapaction": []string{`"https://example.com/stock/GetStock"`},
+			},
+			matcher: Matcher{
+				SOAPAction: "https://example.com/stock/GetPrice",
+			},
+		},
+		{
+			title: "body xml",
+			matcher: Matcher{
+				BodyXMLString: `<Envelope xmlns="http://schemas.xmlsoap.org/soap/envelope/">
+  <Header/>
+  <Body><GetPrice xmlns="https://example.com/stock"><Item>Apples</Item></GetPrice></Body>
+</Envelope>`,
+			},
+			exp: true,
+		},
+		{
+			title: "body xml doesn't match",
+			matcher: Matcher{
+				BodyXML: item{Value: "Apples"},
+			},
+		},
+	}
+
+	for _, d := range data {
+		d := d
+		t.Run(d.title, func(t *testing.T) {
+			b, err := isMatch(&http.Request{
+				Header: d.header,
+				Body:   io.NopCloser(strings.NewReader(body)),
+			}, d.matcher)
+			require.NoError(t, err)
+			require.Equal(t, d.exp, b)
+		})
+	}
+}
+
+func Test_testBodyXML(t *testing.T) {
+	tb := newFakeTB(t)
+	testBodyXML(tb, &http.Request{
+		Body: io.NopCloser(strings.NewReader(`<user id="1"><name>bar</name></user>`)),
+	}, Service{Endpoint: "http://example.com"}, Route{
+		Name: "create a user",
+		Tester: Tester{
+			BodyXMLString: `<user id="1"><name>foo</name></user>`,
+		},
+	})
+	errs := tb.Errors()
+	require.Len(t, errs, 1)
+	require.Contains(t, errs[0], "request body should match as XML")
+	require.Contains(t, errs[0], "-  <name>foo</name>")
+	require.Contains(t, errs[0], "+  <name>bar</name>")
+}
+
+func Test_testBodyXML_conflict(t *testing.T) {
+	tb := newFakeTB(t)
+	req := &http.Request{
+		Body: io.NopCloser(strings.NewReader(`<user><name>foo</name></user>`)),
+	}
+	route := Route{
+		Name: "create a user",
+		Matcher: Matcher{
+			BodyXML:       struct{ Name string }{Name: "foo"},
+			BodyXMLString: `<user><name>foo</name></user>`,
+		},
+		Tester: Tester{
+			BodyXML:       struct{ Name string }{Name: "foo"},
+			BodyXMLString: `<user><name>foo</name></user>`,
+		},
+	}
+	_, err := matchBodyXML(req, route.Matcher)
+	require.EqualError(t, err, "BodyXML and BodyXMLString can't be set at the same time")
+	testBodyXML(tb, req, Service{Endpoint: "http://example.com"}, route)
+	errs := tb.Errors()
+	require.Len(t, errs, 1)
+	require.Contains(t, errs[0], "BodyXML and BodyXMLString can't be set at the same time")
+}
@@ -3,6 +3,10 @@ module github.com/suzuki-shunsuke/flute/v2
 go 1.19
 
 require (
+	github.com/andybalholm/brotli v1.1.1
+	github.com/jmespath/go-jmespath v0.4.0
+	github.com/klauspost/compress v1.17.6
+	github.com/pmezard/go-difflib v1.0.0
 	github.com/stretchr/testify v1.10.0
 	github.com/suzuki-shunsuke/go-dataeq/v2 v2.0.0
 	github.com/suzuki-shunsuke/gomic v0.6.0
@@ -10,6 +14,5 @@ require (
 
 require (
 	github.com/davecgh/go-spew v1.1.1 // indirect
-	github.com/pmezard/go-difflib v1.0.0 // indirect
 	gopkg.in/yaml.v3 v3.0.1 // indirect
 )